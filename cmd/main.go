@@ -2,17 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"Personal-Notes/internal/blob"
 	"Personal-Notes/internal/config"
+	"Personal-Notes/internal/keyring"
 	"Personal-Notes/internal/logging"
 	"Personal-Notes/internal/logging/zaplog"
+	"Personal-Notes/internal/markdown"
+	"Personal-Notes/internal/password"
+	"Personal-Notes/internal/realtime"
 	"Personal-Notes/internal/repository/postgres"
+	"Personal-Notes/internal/server"
+	"Personal-Notes/internal/service"
+	"Personal-Notes/internal/token"
+	"Personal-Notes/internal/transport/rest"
+	"Personal-Notes/internal/worker"
 )
 
 func main() {
@@ -20,10 +35,130 @@ func main() {
 	logger := initLogger(cfg.AppEnv, cfg.LogFormat)
 
 	db := initDBConnection(cfg, logger)
-	defer func() {
-		db.Close()
-		logger.Info("shutdown[db]: db connection closed", logging.NewField("database", cfg.DBName))
+
+	tokenManager := initTokenManager(cfg, logger)
+
+	passwordHasher := password.NewHasher(password.Params{
+		Memory:      cfg.PasswordArgon2Memory,
+		Iterations:  cfg.PasswordArgon2Iterations,
+		Parallelism: cfg.PasswordArgon2Parallelism,
+		SaltLength:  cfg.PasswordArgon2SaltLength,
+		KeyLength:   cfg.PasswordArgon2KeyLength,
+	})
+
+	blobStore := initBlobStore(cfg, logger)
+
+	keys := initKeyring(cfg, logger)
+
+	repos := postgres.NewRepository(db, keys, logger)
+	hub := realtime.NewHub(postgres.NewChangeListener(db, logger), cfg.EventsSubscriberBuffer, logger)
+	services := service.NewServices(service.Deps{
+		Repos:           repos,
+		PasswordHasher:  passwordHasher,
+		TokenManager:    tokenManager,
+		ShareLinkTokens: tokenManager,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		RevisionRetention: service.RevisionRetention{
+			KeepLast: cfg.NoteRevisionKeepLast,
+			KeepDays: cfg.NoteRevisionKeepDays,
+		},
+		TrashRetention: cfg.NoteTrashRetention,
+		BlobStore:      blobStore,
+		AttachmentLimits: service.AttachmentLimits{
+			MaxSize:    cfg.AttachmentMaxSize,
+			UserQuota:  cfg.AttachmentUserQuota,
+			PendingTTL: cfg.AttachmentPendingTTL,
+		},
+		Markdown:          markdown.NewRenderer(),
+		MarkdownCacheSize: cfg.MarkdownCacheSize,
+		EventHub:          hub,
+		Collab: service.CollabSettings{
+			MaterializeInterval: cfg.CollabMaterializeInterval,
+			SessionBuffer:       cfg.CollabSessionBuffer,
+		},
+		Logger: logger,
+	})
+	handler := rest.NewHandler(services, tokenManager, logger, cfg)
+
+	workers := worker.NewRunner(logger)
+	workers.Go("note_events", hub.Run)
+	workers.Every("collab_flush", cfg.CollabSaveInterval, services.Collab.Flush)
+	workers.Every("refresh_token_cleanup", cfg.RefreshTokenCleanupInterval, services.Token.Cleanup)
+	workers.Every("note_revision_prune", cfg.NoteRevisionCleanupInterval, services.NoteRevision.Prune)
+	workers.Every("note_trash_purge", cfg.NoteTrashPurgeInterval, services.Note.PurgeTrash)
+	workers.Every("attachment_gc", cfg.AttachmentGCInterval, services.Attachment.CollectGarbage)
+	if keys != nil {
+		workers.Every("body_encryption", cfg.EncryptionRotationInterval, services.BodyEncryption.Rotate)
+	}
+
+	srv := server.NewServer(cfg, handler.InitRoutes())
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("init[server]: starting http server", logging.NewField("port", cfg.Port))
+		if err := srv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
 	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case sig := <-quit:
+		logger.Info("shutdown[app]: signal received", logging.NewField("signal", sig.String()))
+	case err := <-serverErr:
+		logger.Error("fail[server]: http server stopped unexpectedly", logging.NewField("error", err))
+	}
+
+	shutdown(cfg, logger, srv, hub, services.Collab, workers, db)
+}
+
+func shutdown(
+	cfg *config.Config,
+	logger *zaplog.ZapLogger,
+	srv *server.Server,
+	hub *realtime.Hub,
+	collab service.Collab,
+	workers *worker.Runner,
+	db *pgxpool.Pool,
+) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Event streams never finish on their own, so they are ended first.
+	hub.Close()
+	logger.Info("shutdown[events]: event streams closed")
+
+	// So are collaboration sessions, once their documents are written to
+	// the note bodies.
+	if err := collab.Close(ctx); err != nil {
+		logger.Error("fail[collab]: failed to write documents being edited", logging.NewField("error", err))
+	} else {
+		logger.Info("shutdown[collab]: collaboration sessions closed")
+	}
+
+	logger.Info("shutdown[server]: draining in-flight requests",
+		logging.NewField("timeout", cfg.ShutdownTimeout),
+	)
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("fail[server]: failed to shut down http server gracefully", logging.NewField("error", err))
+	} else {
+		logger.Info("shutdown[server]: http server stopped")
+	}
+
+	if err := workers.Stop(ctx); err != nil {
+		logger.Error("fail[workers]: background workers did not stop in time", logging.NewField("error", err))
+	} else {
+		logger.Info("shutdown[workers]: background workers stopped")
+	}
+
+	db.Close()
+	logger.Info("shutdown[db]: db connection closed", logging.NewField("database", cfg.DBName))
+
+	logger.Info("shutdown[logger]: flushing logs")
+	// Sync returns ENOTTY/EINVAL for stdout/stderr on some platforms, which is harmless.
+	_ = logger.Sync()
 }
 
 func initConfig() *config.Config {
@@ -84,3 +219,96 @@ func initDBConnection(cfg *config.Config, logger logging.Logger) *pgxpool.Pool {
 	)
 	return db
 }
+
+func initTokenManager(cfg *config.Config, logger logging.Logger) *token.Manager {
+	tokenManager, err := token.NewManager(cfg)
+	if err != nil {
+		logger.Fatal("fail[token]: failed to initialize token manager", logging.NewField("error", err))
+	}
+
+	logger.Info("init[token]: successfully initialized token manager",
+		logging.NewField("signing_method", cfg.JWTSigningMethod),
+	)
+	return tokenManager
+}
+
+func initBlobStore(cfg *config.Config, logger logging.Logger) service.BlobStore {
+	switch cfg.BlobStore {
+	case "local":
+		store, err := blob.NewLocalStore(cfg.BlobLocalDir)
+		if err != nil {
+			logger.Fatal("fail[blob]: failed to initialize local blob store", logging.NewField("error", err))
+		}
+
+		logger.Info("init[blob]: successfully initialized local blob store",
+			logging.NewField("dir", cfg.BlobLocalDir),
+		)
+		return store
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		store, err := blob.NewS3Store(ctx, blob.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			Bucket:          cfg.S3Bucket,
+			Region:          cfg.S3Region,
+			UseSSL:          cfg.S3UseSSL,
+		})
+		if err != nil {
+			logger.Fatal("fail[blob]: failed to initialize s3 blob store", logging.NewField("error", err))
+		}
+
+		logger.Info("init[blob]: successfully initialized s3 blob store",
+			logging.NewField("endpoint", cfg.S3Endpoint),
+			logging.NewField("bucket", cfg.S3Bucket),
+		)
+		return store
+	default:
+		logger.Fatal("fail[blob]: unknown blob store", logging.NewField("blob_store", cfg.BlobStore))
+		return nil
+	}
+}
+
+// initKeyring returns the master keys for encryption at rest, or nil when none
+// are configured and note bodies are stored in plain text.
+func initKeyring(cfg *config.Config, logger logging.Logger) *keyring.Keyring {
+	if cfg.EncryptionMasterKeys == "" && cfg.EncryptionKeyFile == "" {
+		logger.Warn("init[keyring]: no master keys configured, note bodies are stored in plain text")
+		return nil
+	}
+
+	keys, err := keyring.Parse(cfg.EncryptionMasterKeys)
+	if err != nil {
+		logger.Fatal("fail[keyring]: failed to parse master keys", logging.NewField("error", err))
+	}
+	if cfg.EncryptionKeyFile != "" {
+		fileKeys, err := keyring.LoadFile(cfg.EncryptionKeyFile)
+		if err != nil {
+			logger.Fatal("fail[keyring]: failed to load master key file",
+				logging.NewField("path", cfg.EncryptionKeyFile),
+				logging.NewField("error", err),
+			)
+		}
+		for version, key := range fileKeys {
+			if _, ok := keys[version]; ok {
+				logger.Fatal("fail[keyring]: master key version is configured twice",
+					logging.NewField("version", version),
+				)
+			}
+			keys[version] = key
+		}
+	}
+
+	ring, err := keyring.New(keys, cfg.EncryptionActiveKey)
+	if err != nil {
+		logger.Fatal("fail[keyring]: failed to initialize keyring", logging.NewField("error", err))
+	}
+
+	logger.Info("init[keyring]: successfully initialized keyring",
+		logging.NewField("versions", len(keys)),
+		logging.NewField("active_version", ring.Active()),
+	)
+	return ring
+}
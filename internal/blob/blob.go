@@ -0,0 +1,37 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// keyPattern allows slash separated lowercase names such as ab/cd/abcd0123,
+// which keeps keys safe to use as file paths and object names.
+var keyPattern = regexp.MustCompile(`^[a-z0-9]+(/[a-z0-9]+)*$`)
+
+func validateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// contextReader stops a copy as soon as ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
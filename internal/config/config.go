@@ -1,6 +1,9 @@
 package config
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -14,6 +17,67 @@ type Config struct {
 	DBPassword string `env:"DB_PASSWORD"`
 	DBName     string `env:"DB_NAME"`
 	DBSSLMode  string `env:"DB_SSLMODE" env-default:"disable"`
+
+	HTTPReadTimeout    time.Duration `env:"HTTP_READ_TIMEOUT" env-default:"10s"`
+	HTTPWriteTimeout   time.Duration `env:"HTTP_WRITE_TIMEOUT" env-default:"10s"`
+	HTTPIdleTimeout    time.Duration `env:"HTTP_IDLE_TIMEOUT" env-default:"60s"`
+	HTTPRequestTimeout time.Duration `env:"HTTP_REQUEST_TIMEOUT" env-default:"5s"`
+
+	CookieSecure bool `env:"COOKIE_SECURE" env-default:"true"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" env-default:"15s"`
+
+	JWTSigningMethod  string        `env:"JWT_SIGNING_METHOD" env-default:"HS256"`
+	JWTSigningKey     string        `env:"JWT_SIGNING_KEY"`
+	JWTPrivateKeyPath string        `env:"JWT_PRIVATE_KEY_PATH"`
+	JWTPublicKeyPath  string        `env:"JWT_PUBLIC_KEY_PATH"`
+	JWTIssuer         string        `env:"JWT_ISSUER" env-default:"personal_notes_api"`
+	AccessTokenTTL    time.Duration `env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL   time.Duration `env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+
+	PasswordArgon2Memory      uint32 `env:"PASSWORD_ARGON2_MEMORY" env-default:"65536"`
+	PasswordArgon2Iterations  uint32 `env:"PASSWORD_ARGON2_ITERATIONS" env-default:"3"`
+	PasswordArgon2Parallelism uint8  `env:"PASSWORD_ARGON2_PARALLELISM" env-default:"2"`
+	PasswordArgon2SaltLength  uint32 `env:"PASSWORD_ARGON2_SALT_LENGTH" env-default:"16"`
+	PasswordArgon2KeyLength   uint32 `env:"PASSWORD_ARGON2_KEY_LENGTH" env-default:"32"`
+
+	RefreshTokenCleanupInterval time.Duration `env:"REFRESH_TOKEN_CLEANUP_INTERVAL" env-default:"1h"`
+
+	NoteRevisionKeepLast        int           `env:"NOTE_REVISION_KEEP_LAST" env-default:"100"`
+	NoteRevisionKeepDays        int           `env:"NOTE_REVISION_KEEP_DAYS" env-default:"0"`
+	NoteRevisionCleanupInterval time.Duration `env:"NOTE_REVISION_CLEANUP_INTERVAL" env-default:"1h"`
+
+	NoteTrashRetention     time.Duration `env:"NOTE_TRASH_RETENTION" env-default:"720h"`
+	NoteTrashPurgeInterval time.Duration `env:"NOTE_TRASH_PURGE_INTERVAL" env-default:"1h"`
+
+	MarkdownCacheSize int `env:"MARKDOWN_CACHE_SIZE" env-default:"1000"`
+
+	BlobStore         string `env:"BLOB_STORE" env-default:"local"`
+	BlobLocalDir      string `env:"BLOB_LOCAL_DIR" env-default:"data/blobs"`
+	S3Endpoint        string `env:"S3_ENDPOINT"`
+	S3AccessKeyID     string `env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `env:"S3_SECRET_ACCESS_KEY"`
+	S3Bucket          string `env:"S3_BUCKET" env-default:"personal-notes-attachments"`
+	S3Region          string `env:"S3_REGION"`
+	S3UseSSL          bool   `env:"S3_USE_SSL" env-default:"true"`
+
+	AttachmentMaxSize         int64         `env:"ATTACHMENT_MAX_SIZE" env-default:"104857600"`
+	AttachmentUserQuota       int64         `env:"ATTACHMENT_USER_QUOTA" env-default:"1073741824"`
+	AttachmentTransferTimeout time.Duration `env:"ATTACHMENT_TRANSFER_TIMEOUT" env-default:"10m"`
+	AttachmentPendingTTL      time.Duration `env:"ATTACHMENT_PENDING_TTL" env-default:"1h"`
+	AttachmentGCInterval      time.Duration `env:"ATTACHMENT_GC_INTERVAL" env-default:"1h"`
+
+	EncryptionMasterKeys       string        `env:"ENCRYPTION_MASTER_KEYS"`
+	EncryptionKeyFile          string        `env:"ENCRYPTION_KEY_FILE"`
+	EncryptionActiveKey        int           `env:"ENCRYPTION_ACTIVE_KEY" env-default:"0"`
+	EncryptionRotationInterval time.Duration `env:"ENCRYPTION_ROTATION_INTERVAL" env-default:"1h"`
+
+	EventsHeartbeatInterval time.Duration `env:"EVENTS_HEARTBEAT_INTERVAL" env-default:"30s"`
+	EventsSubscriberBuffer  int           `env:"EVENTS_SUBSCRIBER_BUFFER" env-default:"64"`
+
+	CollabSaveInterval        time.Duration `env:"COLLAB_SAVE_INTERVAL" env-default:"5s"`
+	CollabMaterializeInterval time.Duration `env:"COLLAB_MATERIALIZE_INTERVAL" env-default:"30s"`
+	CollabSessionBuffer       int           `env:"COLLAB_SESSION_BUFFER" env-default:"256"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -23,5 +87,34 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.validateDurations(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+// validateDurations checks that the durations that can't work at zero are
+// positive: a ticker needs a positive interval, and a shutdown needs time to
+// drain.
+func (cfg *Config) validateDurations() error {
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout},
+		{"REFRESH_TOKEN_CLEANUP_INTERVAL", cfg.RefreshTokenCleanupInterval},
+		{"NOTE_REVISION_CLEANUP_INTERVAL", cfg.NoteRevisionCleanupInterval},
+		{"NOTE_TRASH_PURGE_INTERVAL", cfg.NoteTrashPurgeInterval},
+		{"ATTACHMENT_GC_INTERVAL", cfg.AttachmentGCInterval},
+		{"ENCRYPTION_ROTATION_INTERVAL", cfg.EncryptionRotationInterval},
+		{"EVENTS_HEARTBEAT_INTERVAL", cfg.EventsHeartbeatInterval},
+		{"COLLAB_SAVE_INTERVAL", cfg.CollabSaveInterval},
+	}
+	for _, d := range durations {
+		if d.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", d.name, d.value)
+		}
+	}
+	return nil
+}
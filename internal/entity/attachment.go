@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// Attachment is a file attached to a note. The content lives in a blob store
+// under BlobKey; the row is pending until the upload has completed.
+type Attachment struct {
+	ID          int
+	NoteID      int
+	OwnerID     int
+	BlobKey     string
+	FileName    string
+	ContentType string
+	Size        int64
+	SHA256      *string
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+type ChangeKind string
+
+const (
+	ChangeCreate ChangeKind = "create"
+	ChangeUpdate ChangeKind = "update"
+	ChangeDelete ChangeKind = "delete"
+)
+
+// Change is an entry in the change feed of a user who owns a note or has it
+// shared with them. Seq numbers the changes of each user in the order they
+// were committed.
+type Change struct {
+	UserID    int
+	Seq       int64
+	NoteID    int
+	Kind      ChangeKind
+	CreatedAt time.Time
+}
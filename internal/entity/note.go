@@ -2,11 +2,22 @@ package entity
 
 import "time"
 
+// Note is a note of OwnerID. When Encrypted is set the title and body are
+// ciphertext under a per-note key, which is stored in NoteKey wrapped by the
+// owner's user key; the server never sees the plaintext.
 type Note struct {
-	ID        int
-	OwnerID   int
-	Title     string
-	Body      *string
-	CreatedAt time.Time
-	UpdatedAt *time.Time
+	ID         int
+	OwnerID    int
+	NotebookID *int
+	Title      string
+	Body       *string
+	Version    int
+	CreatedAt  time.Time
+	UpdatedAt  *time.Time
+	DeletedAt  *time.Time
+	PinnedAt   *time.Time
+	ArchivedAt *time.Time
+	StarredAt  *time.Time
+	Encrypted  bool
+	NoteKey    []byte
 }
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// NoteDocument is the collaborative editing state of a note body, encoded by
+// pkg/crdt. BaseVersion is the note version whose body the marked text of the
+// state matches. Generation counts the writes of the document, so a writer
+// holding an older one can't overwrite it.
+type NoteDocument struct {
+	NoteID      int
+	State       []byte
+	BaseVersion int
+	Generation  int64
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,12 @@
+package entity
+
+// NoteLink is a wiki link from the body of a note to another note of the same
+// owner, either by id or by title. Exactly one of TargetNoteID and
+// TargetTitle is set. A title link points to the oldest note with that title.
+type NoteLink struct {
+	ID           int
+	SourceNoteID int
+	OwnerID      int
+	TargetNoteID *int
+	TargetTitle  *string
+}
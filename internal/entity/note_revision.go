@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// NoteRevision is a snapshot of a note's content. Revisions are numbered per
+// note starting at 1, and the latest one always matches the note itself.
+type NoteRevision struct {
+	ID        int
+	NoteID    int
+	OwnerID   int
+	Revision  int
+	Title     string
+	Body      *string
+	CreatedAt time.Time
+}
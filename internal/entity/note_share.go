@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+type ShareRole string
+
+// Viewers and commenters can read a shared note, editors can also change its
+// title and body. Only the owner can delete, share or reorganize a note.
+const (
+	ShareRoleViewer    ShareRole = "viewer"
+	ShareRoleCommenter ShareRole = "commenter"
+	ShareRoleEditor    ShareRole = "editor"
+)
+
+// NoteShare grants UserID access to a note owned by someone else.
+type NoteShare struct {
+	NoteID    int
+	UserID    int
+	Role      ShareRole
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
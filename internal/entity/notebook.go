@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+type Notebook struct {
+	ID        int
+	OwnerID   int
+	ParentID  *int
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// ShareLink publishes a note read-only at a public URL. Only the hash of the
+// URL token is stored.
+type ShareLink struct {
+	ID           int
+	NoteID       int
+	OwnerID      int
+	TokenHash    string
+	PasswordHash *string
+	ExpiresAt    *time.Time
+	ViewCount    int64
+	CreatedAt    time.Time
+	RevokedAt    *time.Time
+}
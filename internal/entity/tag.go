@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+type Tag struct {
+	ID        int
+	OwnerID   int
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
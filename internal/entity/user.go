@@ -3,11 +3,12 @@ package entity
 import "time"
 
 type User struct {
-	ID          int
-	Name        string
-	Email       string
-	Password    string
-	CreatedAt   time.Time
-	UpdatedAt   *time.Time
-	LastLoginAt *time.Time
+	ID             int
+	Name           string
+	Email          string
+	Password       string
+	SearchLanguage string
+	CreatedAt      time.Time
+	UpdatedAt      *time.Time
+	LastLoginAt    *time.Time
 }
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// UserKey is the envelope of a user's key for encrypted notes: the key is
+// wrapped by a key derived from the user's passphrase with KDF and its
+// parameters. Only clients that know the passphrase can unwrap it.
+type UserKey struct {
+	UserID         int
+	KDF            string
+	KDFSalt        []byte
+	KDFMemory      int
+	KDFIterations  int
+	KDFParallelism int
+	WrappedKey     []byte
+	CreatedAt      time.Time
+	UpdatedAt      *time.Time
+}
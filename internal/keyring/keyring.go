@@ -0,0 +1,162 @@
+// Package keyring holds the master keys that wrap the data keys used to
+// encrypt note bodies at rest. Master keys are numbered by version; new data
+// keys are wrapped by the active version, older versions are only kept to
+// unwrap data keys until they have been rewrapped.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const KeySize = 32
+
+var (
+	ErrUnknownKey = errors.New("unknown master key version")
+	ErrDecrypt    = errors.New("decryption failed")
+)
+
+type Keyring struct {
+	keys   map[int]cipher.AEAD
+	active int
+}
+
+// New returns a keyring of AES-256 master keys by version. An active version
+// of zero picks the highest one.
+func New(keys map[int][]byte, active int) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no master keys")
+	}
+
+	k := &Keyring{keys: make(map[int]cipher.AEAD, len(keys)), active: active}
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("master key version %d must be positive", version)
+		}
+		aead, err := NewAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %d: %w", version, err)
+		}
+		k.keys[version] = aead
+		if active == 0 && version > k.active {
+			k.active = version
+		}
+	}
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("%w: active version %d", ErrUnknownKey, k.active)
+	}
+	return k, nil
+}
+
+// Parse reads master keys written as version:base64 pairs separated by commas
+// or newlines. Blank lines and lines starting with # are skipped.
+func Parse(spec string) (map[int][]byte, error) {
+	keys := make(map[int][]byte)
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		v, b64, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, errors.New("master key must be written as version:base64")
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key version %q", v)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+		if err != nil {
+			return nil, fmt.Errorf("master key %d: %w", version, err)
+		}
+		if _, ok := keys[version]; ok {
+			return nil, fmt.Errorf("duplicate master key version %d", version)
+		}
+		keys[version] = key
+	}
+	return keys, nil
+}
+
+// LoadFile reads master keys from path in the format of Parse, one per line.
+func LoadFile(path string) (map[int][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(data))
+}
+
+// Active returns the version that wraps new data keys.
+func (k *Keyring) Active() int {
+	return k.active
+}
+
+// Wrap encrypts a data key with the active master key.
+func (k *Keyring) Wrap(dataKey []byte) ([]byte, error) {
+	return Seal(k.keys[k.active], dataKey, wrapAD(k.active))
+}
+
+// Unwrap decrypts a data key wrapped by master key version.
+func (k *Keyring) Unwrap(version int, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, version)
+	}
+	return Open(aead, wrapped, wrapAD(version))
+}
+
+// NewDataKey returns a random AES-256 key.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext and returns the random nonce followed by the
+// ciphertext.
+func Seal(aead cipher.AEAD, plaintext []byte, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// Open reverses Seal. Any failure, including a truncated input, is
+// ErrDecrypt.
+func Open(aead cipher.AEAD, sealed []byte, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	n := aead.NonceSize()
+	plaintext, err := aead.Open(nil, sealed[:n], sealed[n:], ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// NewAEAD returns AES-256-GCM under key, for use with Seal and Open.
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func wrapAD(version int) []byte {
+	return []byte("data-key:" + strconv.Itoa(version))
+}
@@ -51,3 +51,7 @@ func toZapFields(fields []logging.Field) []zapcore.Field {
 	}
 	return zapFields
 }
+
+func (l *ZapLogger) Sync() error {
+	return l.logger.Sync()
+}
@@ -0,0 +1,176 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// Source delivers the changes committed to the database. Listen calls ready
+// once it receives changes and then publish for each one, until ctx is done
+// or its connection fails.
+type Source interface {
+	Listen(ctx context.Context, ready func(), publish func(entity.Change)) error
+}
+
+// Hub fans the changes from a Source out to the subscriptions of the users
+// they belong to. It never blocks on a subscriber: one that falls behind is
+// dropped and has to subscribe again, replaying what it missed from the
+// change feed.
+type Hub struct {
+	source Source
+	buffer int
+	logger logging.Logger
+
+	mu     sync.Mutex
+	subs   map[int]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub(source Source, buffer int, logger logging.Logger) *Hub {
+	return &Hub{
+		source: source,
+		buffer: buffer,
+		logger: logger,
+		subs:   make(map[int]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the changes in the feed of one user as they are
+// committed.
+type Subscription struct {
+	hub    *Hub
+	userID int
+	events chan entity.Change
+}
+
+// Events is closed when the subscription is dropped: it fell behind, the hub
+// lost changes while reconnecting to its source, or the hub was closed.
+func (s *Subscription) Events() <-chan entity.Change {
+	return s.events
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s.userID][s]; ok {
+		s.hub.drop(s)
+	}
+}
+
+// Subscribe starts a subscription to the changes of userID. After Close the
+// subscription comes back already dropped.
+func (h *Hub) Subscribe(userID int) *Subscription {
+	sub := &Subscription{
+		hub:    h,
+		userID: userID,
+		events: make(chan entity.Change, h.buffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Publish hands change to the subscriptions of its user.
+func (h *Hub) Publish(change entity.Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[change.UserID] {
+		select {
+		case sub.events <- change:
+		default:
+			h.logger.Warn("fail[realtime]: subscriber fell behind, dropping it",
+				logging.NewField("user_id", change.UserID),
+				logging.NewField("seq", change.Seq),
+			)
+			h.drop(sub)
+		}
+	}
+}
+
+// Run feeds the hub from its source until ctx is done, reconnecting with a
+// growing delay when the source fails. Changes committed while the source is
+// down are never published, so every subscription is dropped once it is back
+// and the subscribers catch up from the change feed.
+func (h *Hub) Run(ctx context.Context) error {
+	delay := minRetryDelay
+	for {
+		start := time.Now()
+		err := h.source.Listen(ctx, h.reset, h.Publish)
+		if ctx.Err() != nil {
+			h.reset()
+			return nil
+		}
+
+		if time.Since(start) > maxRetryDelay {
+			delay = minRetryDelay
+		}
+		h.logger.Error("fail[realtime]: change source stopped, reconnecting",
+			logging.NewField("retry_in", delay),
+			logging.NewField("error", err),
+		)
+
+		select {
+		case <-ctx.Done():
+			h.reset()
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// Close drops every subscription and refuses new ones, which ends the event
+// streams so the server can shut down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	h.dropAll()
+}
+
+func (h *Hub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.dropAll()
+}
+
+// dropAll and drop must be called with mu held.
+func (h *Hub) dropAll() {
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.drop(sub)
+		}
+	}
+}
+
+func (h *Hub) drop(sub *Subscription) {
+	delete(h.subs[sub.userID], sub)
+	if len(h.subs[sub.userID]) == 0 {
+		delete(h.subs, sub.userID)
+	}
+	close(sub.events)
+}
@@ -0,0 +1,8 @@
+package repository
+
+// OrphanedBlob is an attachment whose blob can be deleted: its note or owner
+// is gone, or its upload never completed.
+type OrphanedBlob struct {
+	AttachmentID int
+	BlobKey      string
+}
@@ -0,0 +1,12 @@
+package repository
+
+import "Personal-Notes/internal/entity"
+
+// NoteChange is the latest change of a note in a change feed together with
+// the note as it is now. For a tombstone Note is nil and the kind is
+// entity.ChangeDelete, also when the note went away after a later create or
+// update.
+type NoteChange struct {
+	Change entity.Change
+	Note   *entity.Note
+}
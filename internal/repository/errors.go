@@ -1,10 +1,36 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrNotFound     = errors.New("not found")
 	ErrAlreadyExist = errors.New("already exists")
 	ErrDB           = errors.New("database error")
 	ErrTimeout      = errors.New("database query timeout")
+	ErrCycle        = errors.New("would create a cycle")
+	ErrConflict     = errors.New("version conflict")
+	ErrForbidden    = errors.New("permission denied")
+	ErrQuota        = errors.New("storage quota exceeded")
+	ErrDecrypt      = errors.New("stored data can't be decrypted")
 )
+
+// DecryptError reports a value encrypted at rest that can't be decrypted,
+// because the master key of its data key is not configured or the value has
+// been tampered with. It matches ErrDecrypt and Err.
+type DecryptError struct {
+	Table string
+	ID    int
+	KeyID int
+	Err   error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("%v: %s %d with data key %d: %v", ErrDecrypt, e.Table, e.ID, e.KeyID, e.Err)
+}
+
+func (e *DecryptError) Unwrap() []error {
+	return []error{ErrDecrypt, e.Err}
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"time"
+
+	"Personal-Notes/internal/entity"
+)
+
+// GraphParams selects the notes of a graph. NotebookID limits it to a
+// notebook and its descendants, TagIDs to notes with any of the tags; tags
+// outside of TagIDs are left out of the graph as well.
+type GraphParams struct {
+	OwnerID    int
+	NotebookID *int
+	TagIDs     []int
+}
+
+// GraphNote is the part of a note needed to draw it in a graph. The title of
+// an encrypted note is ciphertext.
+type GraphNote struct {
+	ID         int
+	Title      string
+	NotebookID *int
+	CreatedAt  time.Time
+	UpdatedAt  *time.Time
+	Encrypted  bool
+}
+
+// GraphLink is a resolved wiki link between two notes of the graph.
+type GraphLink struct {
+	SourceID int
+	TargetID int
+}
+
+// GraphTagging connects a note of the graph to one of its tags.
+type GraphTagging struct {
+	NoteID int
+	TagID  int
+}
+
+// NoteGraph holds the notes of an owner together with the links between them
+// and their tags.
+type NoteGraph struct {
+	Notes    []GraphNote
+	Tags     []entity.Tag
+	Links    []GraphLink
+	Taggings []GraphTagging
+}
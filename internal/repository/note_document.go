@@ -0,0 +1,12 @@
+package repository
+
+import "Personal-Notes/internal/entity"
+
+// NoteDocumentAccess is a note opened for collaborative editing by a user:
+// the note, whether the user may edit its body and its document, which is nil
+// until the note is first edited collaboratively.
+type NoteDocumentAccess struct {
+	Note     entity.Note
+	CanEdit  bool
+	Document *entity.NoteDocument
+}
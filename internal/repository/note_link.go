@@ -0,0 +1,10 @@
+package repository
+
+import "Personal-Notes/internal/entity"
+
+// BrokenLink is a link whose target note is missing or in the trash,
+// together with the title of the note it is written in.
+type BrokenLink struct {
+	Link        entity.NoteLink
+	SourceTitle string
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"time"
+
+	"Personal-Notes/internal/entity"
+)
+
+type NoteSortField string
+
+const (
+	NoteSortCreatedAt NoteSortField = "created_at"
+	NoteSortUpdatedAt NoteSortField = "updated_at"
+	NoteSortTitle     NoteSortField = "title"
+)
+
+// ArchivedFilter selects how archived notes take part in a listing.
+type ArchivedFilter string
+
+const (
+	ArchivedExclude ArchivedFilter = "exclude"
+	ArchivedOnly    ArchivedFilter = "only"
+	ArchivedInclude ArchivedFilter = "include"
+)
+
+// NoteCursor points at the last note of the previous page. Only the field
+// matching the sort field is used, together with ID as a tie breaker. Pinned
+// is used when pinned notes are listed first.
+type NoteCursor struct {
+	ID        int
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+	Title     string
+	Pinned    bool
+}
+
+// NoteListParams selects a page of an owner's notes. Date ranges are
+// inclusive of From and exclusive of To. NotebookID limits the listing to
+// notes filed directly in that notebook. A note must carry at least one of
+// AnyTagIDs and every one of AllTagIDs. Pinned and Starred, when set, keep
+// only notes in or out of that state, and archived notes are left out unless
+// Archived says otherwise. When sorting by updated_at, notes that were never
+// updated come last in either direction. PinnedFirst puts pinned notes ahead
+// of all others.
+type NoteListParams struct {
+	OwnerID     int
+	SortBy      NoteSortField
+	Desc        bool
+	PinnedFirst bool
+	Limit       int
+	After       *NoteCursor
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	NotebookID  *int
+	Pinned      *bool
+	Starred     *bool
+	Archived    ArchivedFilter
+	AnyTagIDs   []int
+	AllTagIDs   []int
+}
+
+// TagCount is the number of notes matching a listing that carry Tag.
+type TagCount struct {
+	Tag   entity.Tag
+	Count int
+}
+
+// NoteStateChange sets or clears the pinned, archived and starred states of
+// notes. Nil fields are left unchanged.
+type NoteStateChange struct {
+	Pinned   *bool
+	Archived *bool
+	Starred  *bool
+}
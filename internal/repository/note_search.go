@@ -0,0 +1,36 @@
+package repository
+
+import "Personal-Notes/internal/entity"
+
+type SearchTermKind int
+
+const (
+	SearchTermWord SearchTermKind = iota
+	SearchTermPhrase
+	SearchTermPrefix
+)
+
+type SearchTerm struct {
+	Kind SearchTermKind
+	Text string
+}
+
+// NoteSearchParams matches notes containing all Terms. Language is the text
+// search configuration the terms are normalized with.
+type NoteSearchParams struct {
+	OwnerID  int
+	Terms    []SearchTerm
+	Language string
+	Limit    int
+	Offset   int
+}
+
+// NoteSearchHit is a matched note with its rank. TitleHighlight and Snippet
+// are raw ts_headline output with matches wrapped in <mark></mark>; the rest
+// of the text is not escaped.
+type NoteSearchHit struct {
+	Note           entity.Note
+	Rank           float32
+	TitleHighlight string
+	Snippet        string
+}
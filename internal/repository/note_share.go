@@ -0,0 +1,16 @@
+package repository
+
+import "Personal-Notes/internal/entity"
+
+// NoteShareItem is a share of a note together with the email of the user it
+// was granted to.
+type NoteShareItem struct {
+	Share entity.NoteShare
+	Email string
+}
+
+// SharedNote is a note shared with a user and the role they were granted.
+type SharedNote struct {
+	Note entity.Note
+	Role entity.ShareRole
+}
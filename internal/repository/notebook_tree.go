@@ -0,0 +1,11 @@
+package repository
+
+import "Personal-Notes/internal/entity"
+
+// NotebookTreeItem is one notebook of an owner's tree. Items are returned
+// parents first, ordered by depth and then by name.
+type NotebookTreeItem struct {
+	Notebook  entity.Notebook
+	Depth     int
+	NoteCount int
+}
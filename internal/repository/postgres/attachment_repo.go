@@ -0,0 +1,576 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlCreatePendingAttachment = `
+		INSERT INTO attachments (note_id, owner_id, blob_key, file_name, content_type, created_at)
+		SELECT n.id, n.owner_id, $3, $4, $5, $6
+		FROM notes n
+		WHERE n.id = $1 AND n.deleted_at IS NULL
+			AND (n.owner_id = $2 OR EXISTS (
+				SELECT 1 FROM note_shares WHERE note_id = $1 AND user_id = $2 AND role = 'editor'))
+		RETURNING id, note_id, owner_id, blob_key, file_name, content_type, size, sha256, created_at, completed_at
+	`
+	sqlCanReadNote = `
+		SELECT EXISTS (
+			SELECT 1 FROM notes
+			WHERE id = $1 AND deleted_at IS NULL
+				AND (owner_id = $2 OR EXISTS (SELECT 1 FROM note_shares WHERE note_id = $1 AND user_id = $2))
+		)
+	`
+	sqlLockUser = `
+		SELECT id
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`
+	sqlGetStorageUsage = `
+		SELECT COALESCE(SUM(size), 0)::bigint
+		FROM attachments
+		WHERE owner_id = $1 AND note_id IS NOT NULL AND completed_at IS NOT NULL
+	`
+	sqlCompleteAttachment = `
+		UPDATE attachments
+		SET content_type = $2,
+			size = $3,
+			sha256 = $4,
+			completed_at = $5
+		WHERE id = $1 AND note_id IS NOT NULL AND completed_at IS NULL
+		RETURNING id, note_id, owner_id, blob_key, file_name, content_type, size, sha256, created_at, completed_at
+	`
+	sqlDeletePendingAttachment = `
+		DELETE FROM attachments
+		WHERE id = $1 AND completed_at IS NULL
+	`
+	sqlGetAttachment = `
+		SELECT id, note_id, owner_id, blob_key, file_name, content_type, size, sha256, created_at, completed_at
+		FROM attachments
+		WHERE id = $1 AND note_id = $2 AND completed_at IS NOT NULL
+	`
+	sqlListAttachmentsByNoteID = `
+		SELECT id, note_id, owner_id, blob_key, file_name, content_type, size, sha256, created_at, completed_at
+		FROM attachments
+		WHERE note_id = $1 AND completed_at IS NOT NULL
+		ORDER BY created_at, id
+	`
+	// Deleting detaches the attachment from its note, the garbage collector
+	// deletes the blob and the row.
+	sqlDetachAttachment = `
+		UPDATE attachments a
+		SET note_id = NULL
+		FROM notes n
+		WHERE a.id = $1 AND a.note_id = $2 AND a.completed_at IS NOT NULL
+			AND n.id = a.note_id AND n.deleted_at IS NULL
+			AND (n.owner_id = $3 OR EXISTS (
+				SELECT 1 FROM note_shares WHERE note_id = $2 AND user_id = $3 AND role = 'editor'))
+	`
+	sqlListOrphanedAttachments = `
+		SELECT id, blob_key
+		FROM attachments
+		WHERE note_id IS NULL OR owner_id IS NULL OR (completed_at IS NULL AND created_at < $1)
+		ORDER BY id
+		LIMIT $2
+	`
+	sqlDeleteAttachmentsByIDs = `
+		DELETE FROM attachments
+		WHERE id = ANY($1)
+	`
+)
+
+type AttachmentRepository struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewAttachmentRepository(db *pgxpool.Pool, logger logging.Logger) *AttachmentRepository {
+	return &AttachmentRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreatePending records an upload to a note userID can edit before its blob
+// is written. The attachment belongs to, and counts against the quota of,
+// the owner of the note.
+func (r *AttachmentRepository) CreatePending(
+	ctx context.Context,
+	userID int,
+	attachment entity.Attachment,
+) (entity.Attachment, error) {
+	start := time.Now()
+
+	attachment.CreatedAt = start
+
+	r.logger.Debug("monitor[attachment]: starting pending attachment db insertion",
+		logging.NewField("note_id", attachment.NoteID),
+		logging.NewField("user_id", userID),
+		logging.NewField("file_name", attachment.FileName),
+	)
+
+	var resp entity.Attachment
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, sqlCreatePendingAttachment,
+			attachment.NoteID, userID, attachment.BlobKey, attachment.FileName, attachment.ContentType,
+			attachment.CreatedAt).
+			Scan(attachmentDest(&resp)...)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var readable bool
+		if err := tx.QueryRow(ctx, sqlCanReadNote, attachment.NoteID, userID).Scan(&readable); err != nil {
+			return err
+		}
+		if readable {
+			return fmt.Errorf("%w: user %d can't edit note %d", repository.ErrForbidden, userID, attachment.NoteID)
+		}
+		return fmt.Errorf("%w: note %d", repository.ErrNotFound, attachment.NoteID)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrForbidden) {
+			r.logger.Warn(fmt.Sprintf("fail[attachment]: %v", repository.ErrForbidden),
+				logging.NewField("note_id", attachment.NoteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "insert_pending"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", attachment.NoteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "insert_pending"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", attachment.NoteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "insert_pending"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("note_id", attachment.NoteID),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "insert_pending"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: pending attachment inserted successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("owner_id", resp.OwnerID),
+	)
+	return resp, nil
+}
+
+// Complete marks an upload as finished once its blob is stored. The owner's
+// row is locked while the usage is summed, so concurrent uploads can't
+// together go over quota.
+func (r *AttachmentRepository) Complete(
+	ctx context.Context,
+	attachment entity.Attachment,
+	quota int64,
+) (entity.Attachment, error) {
+	start := time.Now()
+
+	completedAt := start
+
+	r.logger.Debug("monitor[attachment]: starting attachment db completion",
+		logging.NewField("id", attachment.ID),
+		logging.NewField("owner_id", attachment.OwnerID),
+		logging.NewField("size", attachment.Size),
+		logging.NewField("content_type", attachment.ContentType),
+	)
+
+	var resp entity.Attachment
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var ownerID int
+		err := tx.QueryRow(ctx, sqlLockUser, attachment.OwnerID).Scan(&ownerID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: user %d", repository.ErrNotFound, attachment.OwnerID)
+		}
+		if err != nil {
+			return err
+		}
+
+		var usage int64
+		if err := tx.QueryRow(ctx, sqlGetStorageUsage, attachment.OwnerID).Scan(&usage); err != nil {
+			return err
+		}
+		if usage+attachment.Size > quota {
+			return fmt.Errorf("%w: %d of %d bytes used, %d more requested",
+				repository.ErrQuota, usage, quota, attachment.Size)
+		}
+
+		err = tx.QueryRow(ctx, sqlCompleteAttachment,
+			attachment.ID, attachment.ContentType, attachment.Size, attachment.SHA256, completedAt).
+			Scan(attachmentDest(&resp)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: pending attachment %d", repository.ErrNotFound, attachment.ID)
+		}
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrQuota) {
+			r.logger.Warn(fmt.Sprintf("fail[attachment]: %v", repository.ErrQuota),
+				logging.NewField("id", attachment.ID),
+				logging.NewField("owner_id", attachment.OwnerID),
+				logging.NewField("operation", "complete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrNotFound),
+				logging.NewField("id", attachment.ID),
+				logging.NewField("owner_id", attachment.OwnerID),
+				logging.NewField("operation", "complete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("id", attachment.ID),
+				logging.NewField("operation", "complete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("id", attachment.ID),
+			logging.NewField("operation", "complete"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: completed successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("size", resp.Size),
+	)
+	return resp, nil
+}
+
+// DeletePending removes the row of an upload that failed after its blob was
+// deleted.
+func (r *AttachmentRepository) DeletePending(ctx context.Context, id int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting pending attachment db delete",
+		logging.NewField("id", id),
+	)
+
+	if _, err := r.db.Exec(ctx, sqlDeletePendingAttachment, id); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "delete_pending"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "delete_pending"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: pending attachment deleted successfully",
+		logging.NewField("id", id),
+	)
+	return nil
+}
+
+// Get returns a completed attachment of a note. Access to the note is
+// checked by the caller.
+func (r *AttachmentRepository) Get(ctx context.Context, id int, noteID int) (entity.Attachment, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting attachment db get",
+		logging.NewField("id", id),
+		logging.NewField("note_id", noteID),
+	)
+
+	var resp entity.Attachment
+
+	err := r.db.QueryRow(ctx, sqlGetAttachment, id, noteID).Scan(attachmentDest(&resp)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("note_id", noteID),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "get"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Attachment{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: got successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("note_id", resp.NoteID),
+	)
+	return resp, nil
+}
+
+// ListByNoteID returns the completed attachments of a note, oldest first.
+// Access to the note is checked by the caller.
+func (r *AttachmentRepository) ListByNoteID(ctx context.Context, noteID int) ([]entity.Attachment, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting attachment db list by note id",
+		logging.NewField("note_id", noteID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListAttachmentsByNoteID, noteID)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Attachment, error) {
+		var attachment entity.Attachment
+		err := row.Scan(attachmentDest(&attachment)...)
+		return attachment, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("operation", "list_by_note_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("operation", "list_by_note_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: listed by note id successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// Delete detaches an attachment from a note userID can edit. The blob is
+// deleted later by the garbage collector.
+func (r *AttachmentRepository) Delete(ctx context.Context, id int, noteID int, userID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting attachment db delete",
+		logging.NewField("id", id),
+		logging.NewField("note_id", noteID),
+		logging.NewField("user_id", userID),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlDetachAttachment, id, noteID, userID)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "delete"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+	if tag.RowsAffected() == 0 {
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrNotFound),
+			logging.NewField("id", id),
+			logging.NewField("note_id", noteID),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "delete"),
+			logging.NewField("duration", time.Since(start)),
+		)
+		return fmt.Errorf("%w: attachment %d", repository.ErrNotFound, id)
+	}
+
+	r.logger.Info("done[attachment]: deleted successfully",
+		logging.NewField("id", id),
+		logging.NewField("note_id", noteID),
+	)
+	return nil
+}
+
+// Usage returns the bytes stored in the owner's completed attachments.
+func (r *AttachmentRepository) Usage(ctx context.Context, ownerID int) (int64, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting storage usage db get",
+		logging.NewField("owner_id", ownerID),
+	)
+
+	var usage int64
+	if err := r.db.QueryRow(ctx, sqlGetStorageUsage, ownerID).Scan(&usage); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "usage"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return 0, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "usage"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return 0, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: got storage usage successfully",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("usage", usage),
+	)
+	return usage, nil
+}
+
+// ListOrphaned returns up to limit attachments whose blob is no longer
+// needed: detached ones, ones whose note or owner was deleted and uploads
+// still pending since before pendingBefore.
+func (r *AttachmentRepository) ListOrphaned(
+	ctx context.Context,
+	pendingBefore time.Time,
+	limit int,
+) ([]repository.OrphanedBlob, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting orphaned attachment db list",
+		logging.NewField("pending_before", pendingBefore),
+		logging.NewField("limit", limit),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListOrphanedAttachments, pendingBefore, limit)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.OrphanedBlob, error) {
+		var orphan repository.OrphanedBlob
+		err := row.Scan(&orphan.AttachmentID, &orphan.BlobKey)
+		return orphan, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "list_orphaned"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("operation", "list_orphaned"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: listed orphaned attachments successfully",
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func (r *AttachmentRepository) DeleteByIDs(ctx context.Context, ids []int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[attachment]: starting attachment db delete by ids",
+		logging.NewField("count", len(ids)),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlDeleteAttachmentsByIDs, ids)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "delete_by_ids"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[attachment]: %v", repository.ErrDB),
+			logging.NewField("operation", "delete_by_ids"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[attachment]: deleted by ids successfully",
+		logging.NewField("count", tag.RowsAffected()),
+	)
+	return nil
+}
+
+func attachmentDest(attachment *entity.Attachment) []any {
+	return []any{
+		&attachment.ID, &attachment.NoteID, &attachment.OwnerID, &attachment.BlobKey, &attachment.FileName,
+		&attachment.ContentType, &attachment.Size, &attachment.SHA256, &attachment.CreatedAt,
+		&attachment.CompletedAt,
+	}
+}
@@ -0,0 +1,287 @@
+package postgres
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/keyring"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlGetDataKey = `
+		SELECT master_key_version, wrapped_key
+		FROM data_keys
+		WHERE id = $1
+	`
+	sqlGetActiveDataKey = `
+		SELECT id, wrapped_key
+		FROM data_keys
+		WHERE master_key_version = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	sqlCreateDataKey = `
+		INSERT INTO data_keys (master_key_version, wrapped_key, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`
+)
+
+// rowAD binds a value encrypted under a data key to the row of table it is
+// stored in, so ciphertext moved to another row or table doesn't decrypt.
+func rowAD(table string, id int) []byte {
+	return []byte(fmt.Sprintf("%s/%d", table, id))
+}
+
+// storedBody is a note body as stored: in plain text, or encrypted under data
+// key keyID. An encrypted body isn't indexed for search, as anything the
+// database could match it by would give its words away.
+type storedBody struct {
+	plain      *string
+	ciphertext []byte
+	keyID      *int
+}
+
+func (b *storedBody) dest() []any {
+	return []any{&b.plain, &b.ciphertext, &b.keyID}
+}
+
+// bodyLength returns the length of body in bytes for the logs, which must not
+// see the body itself.
+func bodyLength(body *string) int {
+	if body == nil {
+		return 0
+	}
+	return len(*body)
+}
+
+// noteRow is a note as scanned from the note columns, with its body still as
+// stored.
+type noteRow struct {
+	note entity.Note
+	body storedBody
+}
+
+// dest returns the scan destinations for the note columns in the order the
+// note queries select them.
+func (row *noteRow) dest() []any {
+	n := &row.note
+	dest := []any{&n.ID, &n.OwnerID, &n.NotebookID, &n.Title}
+	dest = append(dest, row.body.dest()...)
+	return append(dest,
+		&n.Version, &n.CreatedAt, &n.UpdatedAt, &n.DeletedAt,
+		&n.PinnedAt, &n.ArchivedAt, &n.StarredAt, &n.Encrypted, &n.NoteKey,
+	)
+}
+
+// BodyCipher encrypts note bodies at rest under data keys, which are stored
+// wrapped by a master key of the keyring. Without a keyring bodies are
+// written in plain text and encrypted ones can't be read. Unwrapped data keys
+// are cached for the life of the process.
+type BodyCipher struct {
+	db   *pgxpool.Pool
+	keys *keyring.Keyring
+
+	mu       sync.Mutex
+	dataKeys map[int]cipher.AEAD
+	activeID int
+}
+
+func NewBodyCipher(db *pgxpool.Pool, keys *keyring.Keyring) *BodyCipher {
+	return &BodyCipher{
+		db:       db,
+		keys:     keys,
+		dataKeys: make(map[int]cipher.AEAD),
+	}
+}
+
+func (c *BodyCipher) enabled() bool {
+	return c.keys != nil
+}
+
+// seal returns body as it is to be stored in the row id of table.
+func (c *BodyCipher) seal(ctx context.Context, table string, id int, body *string) (storedBody, error) {
+	if body == nil || !c.enabled() {
+		return storedBody{plain: body}, nil
+	}
+
+	id, aead, err := c.activeKey(ctx)
+	if err != nil {
+		return storedBody{}, err
+	}
+	ciphertext, err := keyring.Seal(aead, []byte(*body), rowAD(table, id))
+	if err != nil {
+		return storedBody{}, err
+	}
+
+	return storedBody{ciphertext: ciphertext, keyID: &id}, nil
+}
+
+// open returns the plain text of a stored body. Failures to decrypt are
+// reported as *repository.DecryptError for the given table and row id, or for
+// the data key if that can't be unwrapped.
+func (c *BodyCipher) open(ctx context.Context, table string, id int, body storedBody) (*string, error) {
+	if body.keyID == nil {
+		return body.plain, nil
+	}
+
+	aead, err := c.dataKey(ctx, *body.keyID)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := keyring.Open(aead, body.ciphertext, rowAD(table, id))
+	if err != nil {
+		return nil, &repository.DecryptError{Table: table, ID: id, KeyID: *body.keyID, Err: err}
+	}
+	s := string(plaintext)
+	return &s, nil
+}
+
+// sealDocument returns the state of the document of noteID as it is to be
+// stored, with the id of the data key it is encrypted under if any.
+func (c *BodyCipher) sealDocument(ctx context.Context, noteID int, state []byte) ([]byte, *int, error) {
+	if !c.enabled() {
+		return state, nil, nil
+	}
+
+	id, aead, err := c.activeKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := keyring.Seal(aead, state, rowAD("note_documents", noteID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, &id, nil
+}
+
+// openDocument returns the state of the document of noteID as stored in
+// state, encrypted under data key keyID if that is set.
+func (c *BodyCipher) openDocument(ctx context.Context, noteID int, state []byte, keyID *int) ([]byte, error) {
+	if keyID == nil {
+		return state, nil
+	}
+
+	aead, err := c.dataKey(ctx, *keyID)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := keyring.Open(aead, state, rowAD("note_documents", noteID))
+	if err != nil {
+		return nil, &repository.DecryptError{Table: "note_documents", ID: noteID, KeyID: *keyID, Err: err}
+	}
+	return plaintext, nil
+}
+
+// openNotes returns the notes of rows with their bodies in plain text.
+func (c *BodyCipher) openNotes(ctx context.Context, rows []noteRow) ([]entity.Note, error) {
+	notes := make([]entity.Note, len(rows))
+	for i, row := range rows {
+		body, err := c.open(ctx, "notes", row.note.ID, row.body)
+		if err != nil {
+			return nil, err
+		}
+		notes[i] = row.note
+		notes[i].Body = body
+	}
+	return notes, nil
+}
+
+func (c *BodyCipher) openNote(ctx context.Context, row noteRow) (entity.Note, error) {
+	notes, err := c.openNotes(ctx, []noteRow{row})
+	if err != nil {
+		return entity.Note{}, err
+	}
+	return notes[0], nil
+}
+
+// dataKey returns data key id, unwrapping it on first use.
+func (c *BodyCipher) dataKey(ctx context.Context, id int) (cipher.AEAD, error) {
+	c.mu.Lock()
+	aead, ok := c.dataKeys[id]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+	if !c.enabled() {
+		return nil, &repository.DecryptError{Table: "data_keys", ID: id, KeyID: id,
+			Err: fmt.Errorf("%w: no master keys configured", keyring.ErrUnknownKey)}
+	}
+
+	var (
+		version int
+		wrapped []byte
+	)
+	if err := c.db.QueryRow(ctx, sqlGetDataKey, id).Scan(&version, &wrapped); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &repository.DecryptError{Table: "data_keys", ID: id, KeyID: id, Err: err}
+		}
+		return nil, err
+	}
+	return c.cache(id, version, wrapped)
+}
+
+// activeKey returns the data key new bodies are encrypted with: the newest
+// one wrapped by the active master key, created if there is none yet.
+func (c *BodyCipher) activeKey(ctx context.Context) (int, cipher.AEAD, error) {
+	c.mu.Lock()
+	id := c.activeID
+	aead, ok := c.dataKeys[id]
+	c.mu.Unlock()
+	if ok {
+		return id, aead, nil
+	}
+
+	version := c.keys.Active()
+	var wrapped []byte
+	err := c.db.QueryRow(ctx, sqlGetActiveDataKey, version).Scan(&id, &wrapped)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var key []byte
+		key, err = keyring.NewDataKey()
+		if err != nil {
+			return 0, nil, err
+		}
+		wrapped, err = c.keys.Wrap(key)
+		if err != nil {
+			return 0, nil, err
+		}
+		err = c.db.QueryRow(ctx, sqlCreateDataKey, version, wrapped, time.Now()).Scan(&id)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	aead, err = c.cache(id, version, wrapped)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.mu.Lock()
+	c.activeID = id
+	c.mu.Unlock()
+	return id, aead, nil
+}
+
+func (c *BodyCipher) cache(id int, version int, wrapped []byte) (cipher.AEAD, error) {
+	key, err := c.keys.Unwrap(version, wrapped)
+	if err != nil {
+		return nil, &repository.DecryptError{Table: "data_keys", ID: id, KeyID: id, Err: err}
+	}
+	aead, err := keyring.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.dataKeys[id] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
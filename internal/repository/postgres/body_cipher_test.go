@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/keyring"
+	"Personal-Notes/internal/repository"
+)
+
+func TestBodyCiphertextIsBoundToItsRow(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	keys, err := keyring.New(map[int][]byte{1: bytes.Repeat([]byte{7}, 32)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := NewRepository(db, keys, testLogger{})
+
+	user, err := repos.User.Create(ctx, entity.User{Name: "Ann", Email: "ann@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notes []entity.Note
+	for _, body := range []string{"first", "second"} {
+		note, err := repos.Note.Create(ctx, entity.Note{OwnerID: user.ID, Title: body, Body: &body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, note)
+	}
+
+	got, err := repos.Note.GetByID(ctx, notes[0].ID, user.ID)
+	if err != nil || got.Body == nil || *got.Body != "first" {
+		t.Fatalf("got body %v, %v; want first", got.Body, err)
+	}
+
+	tests := []struct {
+		name string
+		sql  string
+	}{
+		{"note to note", `
+			UPDATE notes n
+			SET body_ciphertext = o.body_ciphertext, body_key_id = o.body_key_id
+			FROM notes o
+			WHERE n.id = $1 AND o.id = $2`},
+		{"revision to note", `
+			UPDATE notes n
+			SET body_ciphertext = r.body_ciphertext, body_key_id = r.body_key_id
+			FROM note_revisions r
+			WHERE n.id = $1 AND r.note_id = $1 AND $2 > 0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.Exec(ctx, tt.sql, notes[0].ID, notes[1].ID); err != nil {
+				t.Fatal(err)
+			}
+			_, err := repos.Note.GetByID(ctx, notes[0].ID, user.ID)
+			if !errors.Is(err, repository.ErrDecrypt) {
+				t.Fatalf("got %v, want a decrypt error", err)
+			}
+		})
+	}
+}
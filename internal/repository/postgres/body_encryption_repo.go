@@ -0,0 +1,296 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlLockStaleDataKeys = `
+		SELECT id, master_key_version, wrapped_key
+		FROM data_keys
+		WHERE master_key_version <> $1
+		ORDER BY id
+		FOR UPDATE
+	`
+	sqlRewrapDataKey = `
+		UPDATE data_keys
+		SET master_key_version = $2,
+			wrapped_key = $3,
+			rewrapped_at = $4
+		WHERE id = $1
+	`
+	sqlLockPlainNoteBodies = `
+		SELECT id, body
+		FROM notes
+		WHERE body IS NOT NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	// Moving a body to ciphertext doesn't change the note, so its version
+	// and updated_at stay as they are.
+	sqlEncryptNoteBody = `
+		UPDATE notes
+		SET body = NULL,
+			body_ciphertext = $2,
+			body_key_id = $3
+		WHERE id = $1
+	`
+	sqlLockPlainRevisionBodies = `
+		SELECT id, body
+		FROM note_revisions
+		WHERE body IS NOT NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	sqlEncryptRevisionBody = `
+		UPDATE note_revisions
+		SET body = NULL,
+			body_ciphertext = $2,
+			body_key_id = $3
+		WHERE id = $1
+	`
+	sqlLockPlainNoteDocuments = `
+		SELECT note_id, state
+		FROM note_documents
+		WHERE state_key_id IS NULL
+		ORDER BY note_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	// The state itself doesn't change, so neither does its generation.
+	sqlEncryptNoteDocument = `
+		UPDATE note_documents
+		SET state = $2,
+			state_key_id = $3
+		WHERE note_id = $1
+	`
+)
+
+// BodyEncryptionRepository works through the bodies left behind by a change
+// of keys. Without a keyring there is nothing to do and every method returns
+// zero.
+type BodyEncryptionRepository struct {
+	db     *pgxpool.Pool
+	bodies *BodyCipher
+	logger logging.Logger
+}
+
+func NewBodyEncryptionRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *BodyEncryptionRepository {
+	return &BodyEncryptionRepository{
+		db:     db,
+		bodies: bodies,
+		logger: logger,
+	}
+}
+
+// RewrapDataKeys wraps every data key still wrapped by a retired master key
+// with the active one. The data keys themselves don't change, so no body has
+// to be encrypted again and the retired master key can be dropped from the
+// config once this has run.
+func (r *BodyEncryptionRepository) RewrapDataKeys(ctx context.Context) (int, error) {
+	if !r.bodies.enabled() {
+		return 0, nil
+	}
+
+	start := time.Now()
+	keys := r.bodies.keys
+
+	r.logger.Debug("monitor[body_encryption]: starting data keys db rewrap",
+		logging.NewField("master_key_version", keys.Active()),
+	)
+
+	var rewrapped int
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		type dataKey struct {
+			id      int
+			version int
+			wrapped []byte
+		}
+
+		rows, _ := tx.Query(ctx, sqlLockStaleDataKeys, keys.Active())
+		stale, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (dataKey, error) {
+			var k dataKey
+			err := row.Scan(&k.id, &k.version, &k.wrapped)
+			return k, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			key, err := keys.Unwrap(k.version, k.wrapped)
+			if err != nil {
+				return &repository.DecryptError{Table: "data_keys", ID: k.id, KeyID: k.id, Err: err}
+			}
+			wrapped, err := keys.Wrap(key)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, sqlRewrapDataKey, k.id, keys.Active(), wrapped, start); err != nil {
+				return err
+			}
+		}
+		rewrapped = len(stale)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[body_encryption]: %v", repository.ErrDecrypt),
+				logging.NewField("operation", "rewrap_data_keys"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return 0, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[body_encryption]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "rewrap_data_keys"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return 0, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[body_encryption]: %v", repository.ErrDB),
+			logging.NewField("operation", "rewrap_data_keys"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return 0, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[body_encryption]: data keys rewrapped successfully",
+		logging.NewField("master_key_version", keys.Active()),
+		logging.NewField("count", rewrapped),
+	)
+	return rewrapped, nil
+}
+
+// EncryptBodies encrypts up to limit plain text bodies of notes, up to limit
+// of note revisions and up to limit collaborative editing states, such as
+// those written before encryption at rest was switched on.
+func (r *BodyEncryptionRepository) EncryptBodies(ctx context.Context, limit int) (int, error) {
+	if !r.bodies.enabled() {
+		return 0, nil
+	}
+
+	start := time.Now()
+
+	r.logger.Debug("monitor[body_encryption]: starting plain bodies db encryption",
+		logging.NewField("limit", limit),
+	)
+
+	var encrypted int
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		type plainBody struct {
+			id   int
+			body string
+		}
+
+		rows, _ := tx.Query(ctx, sqlLockPlainNoteBodies, limit)
+		notes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (plainBody, error) {
+			var b plainBody
+			err := row.Scan(&b.id, &b.body)
+			return b, err
+		})
+		if err != nil {
+			return err
+		}
+		for _, b := range notes {
+			stored, err := r.bodies.seal(ctx, "notes", b.id, &b.body)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, sqlEncryptNoteBody, b.id, stored.ciphertext, stored.keyID); err != nil {
+				return err
+			}
+		}
+
+		rows, _ = tx.Query(ctx, sqlLockPlainRevisionBodies, limit)
+		revisions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (plainBody, error) {
+			var b plainBody
+			err := row.Scan(&b.id, &b.body)
+			return b, err
+		})
+		if err != nil {
+			return err
+		}
+		for _, b := range revisions {
+			stored, err := r.bodies.seal(ctx, "note_revisions", b.id, &b.body)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, sqlEncryptRevisionBody, b.id, stored.ciphertext, stored.keyID); err != nil {
+				return err
+			}
+		}
+
+		type plainDocument struct {
+			noteID int
+			state  []byte
+		}
+
+		rows, _ = tx.Query(ctx, sqlLockPlainNoteDocuments, limit)
+		documents, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (plainDocument, error) {
+			var d plainDocument
+			err := row.Scan(&d.noteID, &d.state)
+			return d, err
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range documents {
+			state, keyID, err := r.bodies.sealDocument(ctx, d.noteID, d.state)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, sqlEncryptNoteDocument, d.noteID, state, keyID); err != nil {
+				return err
+			}
+		}
+
+		encrypted = len(notes) + len(revisions) + len(documents)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[body_encryption]: %v", repository.ErrDecrypt),
+				logging.NewField("operation", "encrypt_bodies"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return 0, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[body_encryption]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "encrypt_bodies"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return 0, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[body_encryption]: %v", repository.ErrDB),
+			logging.NewField("operation", "encrypt_bodies"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return 0, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[body_encryption]: plain bodies encrypted successfully",
+		logging.NewField("count", encrypted),
+	)
+	return encrypted, nil
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+)
+
+// changeTimeLayout is how json_build_object formats a TIMESTAMP.
+const changeTimeLayout = "2006-01-02T15:04:05.999999"
+
+// changePayload is a change as recordChanges announces it.
+type changePayload struct {
+	UserID    int               `json:"user_id"`
+	Seq       int64             `json:"seq"`
+	NoteID    int               `json:"note_id"`
+	Kind      entity.ChangeKind `json:"kind"`
+	CreatedAt string            `json:"created_at"`
+}
+
+// ChangeListener receives the changes announced on the changes channel as
+// their transactions commit.
+type ChangeListener struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewChangeListener(db *pgxpool.Pool, logger logging.Logger) *ChangeListener {
+	return &ChangeListener{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Listen holds a connection of its own listening on the changes channel and
+// passes each change to publish until ctx is done or the connection fails.
+func (l *ChangeListener) Listen(ctx context.Context, ready func(), publish func(entity.Change)) error {
+	pooled, err := l.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	// A connection that has listened isn't fit for the pool any more.
+	conn := pooled.Hijack()
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = conn.Close(closeCtx)
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	l.logger.Info("init[change_listener]: listening for note changes",
+		logging.NewField("channel", changesChannel),
+	)
+	ready()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+
+		var payload changePayload
+		if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			l.logger.Error("fail[change_listener]: malformed change notification",
+				logging.NewField("payload", notification.Payload),
+				logging.NewField("error", err),
+			)
+			continue
+		}
+		createdAt, err := time.Parse(changeTimeLayout, payload.CreatedAt)
+		if err != nil {
+			l.logger.Error("fail[change_listener]: malformed change time",
+				logging.NewField("payload", notification.Payload),
+				logging.NewField("error", err),
+			)
+			continue
+		}
+
+		publish(entity.Change{
+			UserID:    payload.UserID,
+			Seq:       payload.Seq,
+			NoteID:    payload.NoteID,
+			Kind:      payload.Kind,
+			CreatedAt: createdAt,
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	// changesChannel is the channel every recorded change is announced on.
+	changesChannel = "note_changes"
+
+	// A change goes to the feed of the note's owner and of every user the
+	// note is shared with.
+	sqlListChangeRecipients = `
+		SELECT id, owner_id FROM notes WHERE id = ANY($1)
+		UNION
+		SELECT note_id, user_id FROM note_shares WHERE note_id = ANY($1)
+	`
+	// Taking the sequence numbers locks the user row until commit, so a
+	// reader that has seen seq n will never see a smaller one commit later.
+	// The notifications are delivered on commit, in commit order.
+	sqlCreateChanges = `
+		WITH next AS (
+			UPDATE users
+			SET change_seq = change_seq + cardinality($2::int[])
+			WHERE id = $1
+			RETURNING change_seq
+		),
+		created AS (
+			INSERT INTO changes (user_id, seq, note_id, kind, created_at)
+			SELECT $1, next.change_seq - cardinality($2::int[]) + c.n, c.note_id, $3, $4
+			FROM next, unnest($2::int[]) WITH ORDINALITY AS c (note_id, n)
+			RETURNING user_id, seq, note_id, kind, created_at
+		)
+		SELECT pg_notify('` + changesChannel + `', json_build_object(
+			'user_id', user_id,
+			'seq', seq,
+			'note_id', note_id,
+			'kind', kind,
+			'created_at', created_at
+		)::text)
+		FROM created
+	`
+	sqlListChanges = `
+		SELECT user_id, seq, note_id, kind, created_at
+		FROM (
+			SELECT DISTINCT ON (note_id) user_id, seq, note_id, kind, created_at
+			FROM changes
+			WHERE user_id = $1 AND seq > $2
+			ORDER BY note_id, seq DESC
+		) c
+		ORDER BY seq
+		LIMIT $3
+	`
+	sqlListChangesAfter = `
+		SELECT user_id, seq, note_id, kind, created_at
+		FROM changes
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
+	`
+	sqlListChangedNotes = `
+		SELECT id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
+		FROM notes
+		WHERE id = ANY($2) AND deleted_at IS NULL
+			AND (owner_id = $1 OR EXISTS (SELECT 1 FROM note_shares WHERE note_id = notes.id AND user_id = $1))
+	`
+)
+
+type ChangeRepository struct {
+	db     *pgxpool.Pool
+	bodies *BodyCipher
+	logger logging.Logger
+}
+
+func NewChangeRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *ChangeRepository {
+	return &ChangeRepository{
+		db:     db,
+		bodies: bodies,
+		logger: logger,
+	}
+}
+
+// ListSince returns up to limit notes userID owns or has been shared changed
+// after seq after, each with its latest change, in the order of those changes.
+func (r *ChangeRepository) ListSince(
+	ctx context.Context,
+	userID int,
+	after int64,
+	limit int,
+) ([]repository.NoteChange, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[change]: starting changes db list",
+		logging.NewField("user_id", userID),
+		logging.NewField("after", after),
+		logging.NewField("limit", limit),
+	)
+
+	var resp []repository.NoteChange
+
+	// Both reads see the same snapshot, so a note is never newer than the
+	// change listed for it.
+	opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	err := pgx.BeginTxFunc(ctx, r.db, opts, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(ctx, sqlListChanges, userID, after, limit)
+		changes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Change, error) {
+			var c entity.Change
+			err := row.Scan(&c.UserID, &c.Seq, &c.NoteID, &c.Kind, &c.CreatedAt)
+			return c, err
+		})
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0, len(changes))
+		for _, c := range changes {
+			if c.Kind != entity.ChangeDelete {
+				ids = append(ids, c.NoteID)
+			}
+		}
+		rows, _ = tx.Query(ctx, sqlListChangedNotes, userID, ids)
+		noteRows, err := pgx.CollectRows(rows, collectNoteRow)
+		if err != nil {
+			return err
+		}
+		notes, err := r.bodies.openNotes(ctx, noteRows)
+		if err != nil {
+			return err
+		}
+
+		byID := make(map[int]entity.Note, len(notes))
+		for _, note := range notes {
+			byID[note.ID] = note
+		}
+		resp = make([]repository.NoteChange, 0, len(changes))
+		for _, c := range changes {
+			change := repository.NoteChange{Change: c}
+			if note, ok := byID[c.NoteID]; ok && c.Kind != entity.ChangeDelete {
+				change.Note = &note
+			} else {
+				change.Change.Kind = entity.ChangeDelete
+			}
+			resp = append(resp, change)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[change]: %v", repository.ErrDecrypt),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "list_since"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[change]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "list_since"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[change]: %v", repository.ErrDB),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "list_since"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[change]: listed successfully",
+		logging.NewField("user_id", userID),
+		logging.NewField("after", after),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// ListAfter returns up to limit changes in the feed of userID after seq
+// after, in order. Unlike ListSince it keeps every change of a note and
+// doesn't load the notes.
+func (r *ChangeRepository) ListAfter(
+	ctx context.Context,
+	userID int,
+	after int64,
+	limit int,
+) ([]entity.Change, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[change]: starting changes db list after",
+		logging.NewField("user_id", userID),
+		logging.NewField("after", after),
+		logging.NewField("limit", limit),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListChangesAfter, userID, after, limit)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Change, error) {
+		var c entity.Change
+		err := row.Scan(&c.UserID, &c.Seq, &c.NoteID, &c.Kind, &c.CreatedAt)
+		return c, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[change]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "list_after"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[change]: %v", repository.ErrDB),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "list_after"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[change]: listed after successfully",
+		logging.NewField("user_id", userID),
+		logging.NewField("after", after),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// recordChanges appends a change of kind for each of noteIDs to the feeds of
+// the users who can see it: the note's owner and those it is shared with. It
+// must run last in the transaction making the change: it locks the users'
+// rows, and taking note row locks after them could deadlock with a writer
+// holding a note while waiting for one of the users. The users are locked in
+// id order so that two writers can't wait on each other either.
+func recordChanges(
+	ctx context.Context,
+	tx pgx.Tx,
+	noteIDs []int,
+	kind entity.ChangeKind,
+	at time.Time,
+) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	rows, _ := tx.Query(ctx, sqlListChangeRecipients, noteIDs)
+	byUser := make(map[int][]int)
+	var noteID, userID int
+	_, err := pgx.ForEachRow(rows, []any{&noteID, &userID}, func() error {
+		byUser[userID] = append(byUser[userID], noteID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range slices.Sorted(maps.Keys(byUser)) {
+		if err := recordUserChanges(ctx, tx, userID, byUser[userID], kind, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordUserChanges appends a change of kind for each of noteIDs to the feed
+// of userID alone, as when a note is shared with or unshared from them. The
+// same rule on running last applies as for recordChanges.
+func recordUserChanges(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID int,
+	noteIDs []int,
+	kind entity.ChangeKind,
+	at time.Time,
+) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, sqlCreateChanges, userID, noteIDs, kind, at)
+	return err
+}
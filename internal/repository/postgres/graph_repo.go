@@ -0,0 +1,184 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	// sqlGraphNotesCTE selects the notes of a graph: $1 is the owner, $2 an
+	// optional notebook whose subtree the notes must be in and $3 optional tag
+	// ids of which the notes must have one.
+	sqlGraphNotesCTE = `
+		WITH RECURSIVE subtree AS (
+			SELECT id
+			FROM notebooks
+			WHERE id = $2 AND owner_id = $1
+			UNION ALL
+			SELECT nb.id
+			FROM notebooks nb
+			JOIN subtree s ON nb.parent_id = s.id
+		),
+		graph_notes AS (
+			SELECT id, title, notebook_id, created_at, updated_at, encrypted
+			FROM notes
+			WHERE owner_id = $1 AND deleted_at IS NULL
+				AND ($2::int IS NULL OR notebook_id IN (SELECT id FROM subtree))
+				AND ($3::int[] IS NULL OR id IN (SELECT note_id FROM note_tags WHERE tag_id = ANY($3)))
+		)
+	`
+	sqlListGraphNotes = sqlGraphNotesCTE + `
+		SELECT id, title, notebook_id, created_at, updated_at, encrypted
+		FROM graph_notes
+		ORDER BY id
+	`
+	// Title links are resolved to the oldest note with the title, the same
+	// way as for backlinks, and never to encrypted notes.
+	sqlListGraphLinks = sqlGraphNotesCTE + `,
+		title_targets AS (
+			SELECT DISTINCT ON (lower(title)) id, lower(title) AS title_key
+			FROM notes
+			WHERE owner_id = $1 AND deleted_at IS NULL AND NOT encrypted
+			ORDER BY lower(title), id
+		)
+		SELECT DISTINCT e.source_id, e.target_id
+		FROM (
+			SELECT l.source_note_id AS source_id, l.target_note_id AS target_id
+			FROM note_links l
+			WHERE l.owner_id = $1 AND l.target_note_id IS NOT NULL
+			UNION ALL
+			SELECT l.source_note_id, t.id
+			FROM note_links l
+			JOIN title_targets t ON t.title_key = lower(l.target_title)
+			WHERE l.owner_id = $1 AND l.target_title IS NOT NULL
+		) e
+		WHERE e.source_id IN (SELECT id FROM graph_notes)
+			AND e.target_id IN (SELECT id FROM graph_notes)
+		ORDER BY e.source_id, e.target_id
+	`
+	sqlListGraphTaggings = sqlGraphNotesCTE + `
+		SELECT nt.note_id, t.id, t.owner_id, t.name, t.created_at, t.updated_at
+		FROM note_tags nt
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id IN (SELECT id FROM graph_notes)
+			AND ($3::int[] IS NULL OR nt.tag_id = ANY($3))
+		ORDER BY nt.note_id, t.id
+	`
+)
+
+type GraphRepository struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewGraphRepository(db *pgxpool.Pool, logger logging.Logger) *GraphRepository {
+	return &GraphRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Load returns the graph of the owner's notes selected by params. The notes,
+// links and tags are read with one query each in a single snapshot, however
+// many notes there are.
+func (r *GraphRepository) Load(ctx context.Context, params repository.GraphParams) (repository.NoteGraph, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[graph]: starting graph db load",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("notebook_id", params.NotebookID),
+		logging.NewField("tag_ids", params.TagIDs),
+	)
+
+	var resp repository.NoteGraph
+
+	txOptions := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	err := pgx.BeginTxFunc(ctx, r.db, txOptions, func(tx pgx.Tx) error {
+		args := []any{params.OwnerID, params.NotebookID, params.TagIDs}
+
+		rows, _ := tx.Query(ctx, sqlListGraphNotes, args...)
+		notes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.GraphNote, error) {
+			var note repository.GraphNote
+			err := row.Scan(&note.ID, &note.Title, &note.NotebookID, &note.CreatedAt, &note.UpdatedAt, &note.Encrypted)
+			return note, err
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, _ = tx.Query(ctx, sqlListGraphLinks, args...)
+		links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.GraphLink, error) {
+			var link repository.GraphLink
+			err := row.Scan(&link.SourceID, &link.TargetID)
+			return link, err
+		})
+		if err != nil {
+			return err
+		}
+
+		type tagging struct {
+			noteID int
+			tag    entity.Tag
+		}
+		rows, _ = tx.Query(ctx, sqlListGraphTaggings, args...)
+		taggings, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (tagging, error) {
+			var t tagging
+			err := row.Scan(&t.noteID, &t.tag.ID, &t.tag.OwnerID, &t.tag.Name, &t.tag.CreatedAt, &t.tag.UpdatedAt)
+			return t, err
+		})
+		if err != nil {
+			return err
+		}
+
+		resp = repository.NoteGraph{
+			Notes:    notes,
+			Links:    links,
+			Taggings: make([]repository.GraphTagging, 0, len(taggings)),
+		}
+		seenTags := make(map[int]bool)
+		for _, t := range taggings {
+			resp.Taggings = append(resp.Taggings, repository.GraphTagging{NoteID: t.noteID, TagID: t.tag.ID})
+			if !seenTags[t.tag.ID] {
+				seenTags[t.tag.ID] = true
+				resp.Tags = append(resp.Tags, t.tag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[graph]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", params.OwnerID),
+				logging.NewField("operation", "load"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return repository.NoteGraph{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[graph]: %v", repository.ErrDB),
+			logging.NewField("owner_id", params.OwnerID),
+			logging.NewField("operation", "load"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return repository.NoteGraph{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[graph]: loaded successfully",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("notes", len(resp.Notes)),
+		logging.NewField("links", len(resp.Links)),
+		logging.NewField("tags", len(resp.Tags)),
+		logging.NewField("duration", time.Since(start)),
+	)
+	return resp, nil
+}
@@ -0,0 +1,390 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlGetNoteDocument = `
+		SELECT note_id, state, state_key_id, base_version, generation, updated_at
+		FROM note_documents
+		WHERE note_id = $1
+	`
+	sqlGetNoteDocumentGeneration = `
+		SELECT generation
+		FROM note_documents
+		WHERE note_id = $1
+	`
+	// A document is only written for a note that still exists, and over the
+	// generation the writer read.
+	sqlSaveNoteDocument = `
+		INSERT INTO note_documents (note_id, state, state_key_id, base_version, generation, updated_at)
+		SELECT $1, $2, $3, $4, $5 + 1, $6
+		WHERE EXISTS (SELECT 1 FROM notes WHERE id = $1)
+		ON CONFLICT (note_id) DO UPDATE
+		SET state = EXCLUDED.state,
+			state_key_id = EXCLUDED.state_key_id,
+			base_version = EXCLUDED.base_version,
+			generation = EXCLUDED.generation,
+			updated_at = EXCLUDED.updated_at
+		WHERE note_documents.generation = $5
+		RETURNING generation
+	`
+	sqlLockNoteForDocument = `
+		SELECT owner_id, title, encrypted
+		FROM notes
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+)
+
+// NoteDocumentRepository stores the collaborative editing states of note
+// bodies, encrypted at rest like the bodies themselves.
+type NoteDocumentRepository struct {
+	db     *pgxpool.Pool
+	bodies *BodyCipher
+	logger logging.Logger
+}
+
+func NewNoteDocumentRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *NoteDocumentRepository {
+	return &NoteDocumentRepository{
+		db:     db,
+		bodies: bodies,
+		logger: logger,
+	}
+}
+
+// Open returns a note userID owns or has been shared along with its
+// document. Only the owner and editors can edit it.
+func (r *NoteDocumentRepository) Open(
+	ctx context.Context,
+	noteID int,
+	userID int,
+) (repository.NoteDocumentAccess, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_document]: starting note document db get",
+		logging.NewField("note_id", noteID),
+		logging.NewField("user_id", userID),
+	)
+
+	var resp repository.NoteDocumentAccess
+
+	// The note and its document are read from one snapshot, so the base
+	// version of the document can be compared with the version of the note.
+	opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	err := pgx.BeginTxFunc(ctx, r.db, opts, func(tx pgx.Tx) error {
+		var (
+			row  noteRow
+			role string
+		)
+		err := tx.QueryRow(ctx, sqlGetNoteAccess, noteID, userID).Scan(append(row.dest(), &role)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if err != nil {
+			return err
+		}
+		if resp.Note, err = r.bodies.openNote(ctx, row); err != nil {
+			return err
+		}
+		resp.CanEdit = role == "owner" || role == string(entity.ShareRoleEditor)
+
+		doc, err := getNoteDocument(ctx, tx, r.bodies, noteID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp.Document = &doc
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrDecrypt),
+				logging.NewField("note_id", noteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return repository.NoteDocumentAccess{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", noteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return repository.NoteDocumentAccess{}, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return repository.NoteDocumentAccess{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "get"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return repository.NoteDocumentAccess{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_document]: got successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("user_id", userID),
+		logging.NewField("can_edit", resp.CanEdit),
+		logging.NewField("has_document", resp.Document != nil),
+	)
+	return resp, nil
+}
+
+// Save writes doc and returns it with its new generation. The note body is
+// left as it is.
+func (r *NoteDocumentRepository) Save(ctx context.Context, doc entity.NoteDocument) (entity.NoteDocument, error) {
+	start := time.Now()
+
+	doc.UpdatedAt = start
+
+	r.logger.Debug("monitor[note_document]: starting note document db save",
+		logging.NewField("note_id", doc.NoteID),
+		logging.NewField("base_version", doc.BaseVersion),
+		logging.NewField("generation", doc.Generation),
+		logging.NewField("size", len(doc.State)),
+	)
+
+	var resp entity.NoteDocument
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var err error
+		resp, err = saveNoteDocument(ctx, tx, r.bodies, doc)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			r.logger.Warn(fmt.Sprintf("fail[note_document]: %v", repository.ErrConflict),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("generation", doc.Generation),
+				logging.NewField("operation", "save"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("operation", "save"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("operation", "save"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrDB),
+			logging.NewField("note_id", doc.NoteID),
+			logging.NewField("operation", "save"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.NoteDocument{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_document]: saved successfully",
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("generation", resp.Generation),
+	)
+	return resp, nil
+}
+
+// Materialize writes body to the note of doc as an update by its owner, then
+// saves doc with the new version of the note as its base version. If the
+// note has changed since doc.BaseVersion nothing is written and the current
+// note is returned along with repository.ErrConflict; a stale doc.Generation
+// is reported with repository.ErrConflict and no note.
+func (r *NoteDocumentRepository) Materialize(
+	ctx context.Context,
+	doc entity.NoteDocument,
+	body string,
+) (entity.NoteDocument, entity.Note, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_document]: starting note document db materialization",
+		logging.NewField("note_id", doc.NoteID),
+		logging.NewField("base_version", doc.BaseVersion),
+		logging.NewField("generation", doc.Generation),
+		logging.NewField("body_length", len(body)),
+	)
+
+	var (
+		respDoc  entity.NoteDocument
+		respNote entity.Note
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		note := entity.Note{ID: doc.NoteID, Body: &body, Version: doc.BaseVersion, UpdatedAt: &start}
+		err := tx.QueryRow(ctx, sqlLockNoteForDocument, doc.NoteID).Scan(&note.OwnerID, &note.Title, &note.Encrypted)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		// The note is locked, so the generation checked here still holds
+		// when the document is saved.
+		var generation int64
+		err = tx.QueryRow(ctx, sqlGetNoteDocumentGeneration, doc.NoteID).Scan(&generation)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if generation != doc.Generation {
+			return fmt.Errorf("%w: expected document generation %d, current generation %d",
+				repository.ErrConflict, doc.Generation, generation)
+		}
+
+		respNote, _, err = updateNote(ctx, tx, r.bodies, note, false)
+		if err != nil {
+			return err
+		}
+
+		doc.BaseVersion = respNote.Version
+		doc.UpdatedAt = *respNote.UpdatedAt
+		respDoc, err = saveNoteDocument(ctx, tx, r.bodies, doc)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrDecrypt),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("operation", "materialize"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, entity.Note{}, err
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			r.logger.Warn(fmt.Sprintf("fail[note_document]: %v", repository.ErrConflict),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("base_version", doc.BaseVersion),
+				logging.NewField("generation", doc.Generation),
+				logging.NewField("operation", "materialize"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, respNote, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("operation", "materialize"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, entity.Note{}, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", doc.NoteID),
+				logging.NewField("operation", "materialize"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteDocument{}, entity.Note{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_document]: %v", repository.ErrDB),
+			logging.NewField("note_id", doc.NoteID),
+			logging.NewField("operation", "materialize"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.NoteDocument{}, entity.Note{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_document]: materialized successfully",
+		logging.NewField("note_id", respDoc.NoteID),
+		logging.NewField("version", respNote.Version),
+		logging.NewField("generation", respDoc.Generation),
+	)
+	return respDoc, respNote, nil
+}
+
+func getNoteDocument(ctx context.Context, tx pgx.Tx, bodies *BodyCipher, noteID int) (entity.NoteDocument, error) {
+	var (
+		doc   entity.NoteDocument
+		keyID *int
+	)
+	err := tx.QueryRow(ctx, sqlGetNoteDocument, noteID).
+		Scan(&doc.NoteID, &doc.State, &keyID, &doc.BaseVersion, &doc.Generation, &doc.UpdatedAt)
+	if err != nil {
+		return entity.NoteDocument{}, err
+	}
+	if doc.State, err = bodies.openDocument(ctx, noteID, doc.State, keyID); err != nil {
+		return entity.NoteDocument{}, err
+	}
+	return doc, nil
+}
+
+// saveNoteDocument writes doc inside tx and returns it with its new
+// generation.
+func saveNoteDocument(
+	ctx context.Context,
+	tx pgx.Tx,
+	bodies *BodyCipher,
+	doc entity.NoteDocument,
+) (entity.NoteDocument, error) {
+	state, keyID, err := bodies.sealDocument(ctx, doc.NoteID, doc.State)
+	if err != nil {
+		return entity.NoteDocument{}, err
+	}
+
+	var generation int64
+	err = tx.QueryRow(ctx, sqlSaveNoteDocument,
+		doc.NoteID, state, keyID, doc.BaseVersion, doc.Generation, doc.UpdatedAt).
+		Scan(&generation)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(ctx, sqlGetNoteDocumentGeneration, doc.NoteID).Scan(&generation)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.NoteDocument{}, fmt.Errorf("%w: note %d", repository.ErrNotFound, doc.NoteID)
+		}
+		if err != nil {
+			return entity.NoteDocument{}, err
+		}
+		return entity.NoteDocument{}, fmt.Errorf("%w: expected document generation %d, current generation %d",
+			repository.ErrConflict, doc.Generation, generation)
+	}
+	if err != nil {
+		return entity.NoteDocument{}, err
+	}
+	doc.Generation = generation
+	return doc, nil
+}
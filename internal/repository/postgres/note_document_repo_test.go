@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(string, ...logging.Field)  {}
+func (testLogger) Debug(string, ...logging.Field) {}
+func (testLogger) Warn(string, ...logging.Field)  {}
+func (testLogger) Error(string, ...logging.Field) {}
+func (testLogger) Fatal(string, ...logging.Field) {}
+
+// newTestDB connects to the database in TEST_DATABASE_URL and migrates a
+// schema of its own, dropped when the test ends. Tests are skipped without a
+// database.
+func newTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		admin.Close()
+	})
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	migrations, err := filepath.Glob("../../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		sql, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(ctx, string(sql)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
+
+func TestNoteDocumentMaterialize(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repos := NewRepository(db, nil, testLogger{})
+
+	user, err := repos.User.Create(ctx, entity.User{Name: "Ann", Email: "ann@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "first"
+	note, err := repos.Note.Create(ctx, entity.Note{OwnerID: user.ID, Title: "Doc", Body: &body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	doc, materialized, err := repos.NoteDocument.Materialize(ctx, entity.NoteDocument{
+		NoteID:      note.ID,
+		State:       []byte{1, 0, 0},
+		BaseVersion: note.Version,
+	}, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if materialized.UpdatedAt == nil || materialized.UpdatedAt.Before(before.Add(-time.Second)) {
+		t.Fatalf("updated_at = %v, want about %v", materialized.UpdatedAt, before)
+	}
+	if materialized.Version != note.Version+1 {
+		t.Fatalf("version = %d, want %d", materialized.Version, note.Version+1)
+	}
+	if doc.BaseVersion != materialized.Version || doc.Generation != 1 {
+		t.Fatalf("document base version %d generation %d, want %d and 1",
+			doc.BaseVersion, doc.Generation, materialized.Version)
+	}
+
+	stored, err := repos.Note.GetByID(ctx, note.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Body == nil || *stored.Body != "second" || stored.UpdatedAt == nil {
+		t.Fatalf("stored note body %v updated_at %v", stored.Body, stored.UpdatedAt)
+	}
+
+	revisions, err := repos.NoteRevision.List(ctx, note.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("got %d revisions, want 2", len(revisions))
+	}
+	latest, err := repos.NoteRevision.Get(ctx, note.ID, user.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Body == nil || *latest.Body != "second" {
+		t.Fatalf("latest revision body = %v, want second", latest.Body)
+	}
+
+	// A document based on the old version conflicts and gets the current
+	// note back.
+	_, current, err := repos.NoteDocument.Materialize(ctx, entity.NoteDocument{
+		NoteID:      note.ID,
+		State:       []byte{1, 0, 0},
+		BaseVersion: note.Version,
+		Generation:  doc.Generation,
+	}, "third")
+	if !errors.Is(err, repository.ErrConflict) || current.Version != materialized.Version {
+		t.Fatalf("got version %d, %v; want version %d and a conflict", current.Version, err, materialized.Version)
+	}
+}
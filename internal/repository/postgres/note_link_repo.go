@@ -0,0 +1,288 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/internal/wikilink"
+)
+
+const (
+	sqlDeleteNoteLinks = `
+		DELETE FROM note_links
+		WHERE source_note_id = $1
+	`
+	sqlCreateNoteLinks = `
+		INSERT INTO note_links (source_note_id, owner_id, target_note_id, target_title)
+		SELECT $1, $2, t.target_note_id, t.target_title
+		FROM unnest($3::int[], $4::text[]) AS t (target_note_id, target_title)
+	`
+	// A title link points to the oldest note of the owner with that title,
+	// so the links to $3 only point to note $1 if no older note has it. The
+	// title of an encrypted note is ciphertext and never a link target.
+	sqlListBacklinks = `
+		SELECT s.id, s.owner_id, s.notebook_id, s.title, s.body, s.body_ciphertext, s.body_key_id, s.version,
+			s.created_at, s.updated_at, s.deleted_at, s.pinned_at, s.archived_at, s.starred_at,
+			s.encrypted, s.note_key
+		FROM notes s
+		WHERE s.id <> $1 AND s.deleted_at IS NULL
+			AND (s.owner_id = $4 OR EXISTS (SELECT 1 FROM note_shares WHERE note_id = s.id AND user_id = $4))
+			AND EXISTS (
+				SELECT 1 FROM note_links l
+				WHERE l.source_note_id = s.id AND l.owner_id = $2
+					AND (l.target_note_id = $1
+						OR (NOT $5 AND lower(l.target_title) = lower($3::text) AND NOT EXISTS (
+							SELECT 1 FROM notes o
+							WHERE o.owner_id = $2 AND o.deleted_at IS NULL AND NOT o.encrypted
+								AND lower(o.title) = lower($3::text) AND o.id < $1))))
+		ORDER BY s.title, s.id
+	`
+	sqlListBrokenLinks = `
+		SELECT l.id, l.source_note_id, l.owner_id, l.target_note_id, l.target_title, s.title
+		FROM note_links l
+		JOIN notes s ON s.id = l.source_note_id AND s.deleted_at IS NULL
+		WHERE l.owner_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM notes t
+			WHERE t.owner_id = $1 AND t.deleted_at IS NULL
+				AND (t.id = l.target_note_id OR (NOT t.encrypted AND lower(t.title) = lower(l.target_title))))
+		ORDER BY s.title, l.source_note_id, l.id
+	`
+	sqlLockIncomingLinkSources = `
+		SELECT id, title, body, body_ciphertext, body_key_id
+		FROM notes n
+		WHERE n.owner_id = $1 AND n.id <> $3 AND n.deleted_at IS NULL AND NOT n.encrypted
+			AND EXISTS (
+				SELECT 1 FROM note_links l
+				WHERE l.source_note_id = n.id AND lower(l.target_title) = lower($2::text))
+			AND NOT EXISTS (
+				SELECT 1 FROM notes o
+				WHERE o.owner_id = $1 AND o.deleted_at IS NULL AND NOT o.encrypted
+					AND lower(o.title) = lower($2::text) AND o.id < $3)
+		ORDER BY n.id
+		FOR UPDATE
+	`
+	sqlRewriteNoteBody = `
+		UPDATE notes
+		SET body = $2,
+			body_ciphertext = $4,
+			body_key_id = $5,
+			updated_at = $3,
+			version = version + 1
+		WHERE id = $1
+		RETURNING owner_id, title
+	`
+)
+
+type NoteLinkRepository struct {
+	db     *pgxpool.Pool
+	bodies *BodyCipher
+	logger logging.Logger
+}
+
+func NewNoteLinkRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *NoteLinkRepository {
+	return &NoteLinkRepository{
+		db:     db,
+		bodies: bodies,
+		logger: logger,
+	}
+}
+
+// Backlinks returns the notes linking to target that userID can read.
+func (r *NoteLinkRepository) Backlinks(ctx context.Context, target entity.Note, userID int) ([]entity.Note, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_link]: starting backlinks db list",
+		logging.NewField("note_id", target.ID),
+		logging.NewField("user_id", userID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListBacklinks, target.ID, target.OwnerID, target.Title, userID, target.Encrypted)
+	noteRows, err := pgx.CollectRows(rows, collectNoteRow)
+	var resp []entity.Note
+	if err == nil {
+		resp, err = r.bodies.openNotes(ctx, noteRows)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note_link]: %v", repository.ErrDecrypt),
+				logging.NewField("note_id", target.ID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "backlinks"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_link]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", target.ID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "backlinks"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_link]: %v", repository.ErrDB),
+			logging.NewField("note_id", target.ID),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "backlinks"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_link]: listed backlinks successfully",
+		logging.NewField("note_id", target.ID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// ListBroken returns the links in the owner's notes whose target is missing
+// or in the trash.
+func (r *NoteLinkRepository) ListBroken(ctx context.Context, ownerID int) ([]repository.BrokenLink, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_link]: starting broken links db list",
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListBrokenLinks, ownerID)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.BrokenLink, error) {
+		var item repository.BrokenLink
+		err := row.Scan(append(noteLinkDest(&item.Link), &item.SourceTitle)...)
+		return item, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_link]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list_broken"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_link]: %v", repository.ErrDB),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list_broken"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_link]: listed broken links successfully",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// replaceNoteLinks stores the links parsed from the body of note in place of
+// its previous ones. It runs inside the transaction writing the note. The
+// body of an encrypted note can't be parsed, so it has no links.
+func replaceNoteLinks(ctx context.Context, tx pgx.Tx, note entity.Note) error {
+	if _, err := tx.Exec(ctx, sqlDeleteNoteLinks, note.ID); err != nil {
+		return err
+	}
+	if note.Body == nil || note.Encrypted {
+		return nil
+	}
+
+	links := wikilink.Parse(*note.Body)
+	if len(links) == 0 {
+		return nil
+	}
+
+	targetIDs := make([]*int, len(links))
+	targetTitles := make([]*string, len(links))
+	for i, link := range links {
+		targetIDs[i] = link.TargetID
+		targetTitles[i] = link.TargetTitle
+	}
+
+	_, err := tx.Exec(ctx, sqlCreateNoteLinks, note.ID, note.OwnerID, targetIDs, targetTitles)
+	return err
+}
+
+// rewriteIncomingLinks points the title links to oldTitle at newTitle after
+// note noteID has been renamed. Links are only rewritten if they pointed to
+// the renamed note, that is if no older note still has the old title. Every
+// rewritten note gets a new version and revision. It returns the ids of the
+// rewritten notes.
+func rewriteIncomingLinks(
+	ctx context.Context,
+	tx pgx.Tx,
+	bodies *BodyCipher,
+	ownerID int,
+	noteID int,
+	oldTitle string,
+	newTitle string,
+	updatedAt time.Time,
+) ([]int, error) {
+	type source struct {
+		id    int
+		title string
+		body  storedBody
+	}
+
+	rows, _ := tx.Query(ctx, sqlLockIncomingLinkSources, ownerID, oldTitle, noteID)
+	sources, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (source, error) {
+		var s source
+		err := row.Scan(append([]any{&s.id, &s.title}, s.body.dest()...)...)
+		return s, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rewritten []int
+	for _, s := range sources {
+		oldBody, err := bodies.open(ctx, "notes", s.id, s.body)
+		if err != nil {
+			return nil, err
+		}
+		if oldBody == nil {
+			continue
+		}
+		body, count := wikilink.RenameTitle(*oldBody, oldTitle, newTitle)
+		if count == 0 {
+			continue
+		}
+
+		stored, err := bodies.seal(ctx, "notes", s.id, &body)
+		if err != nil {
+			return nil, err
+		}
+		note := entity.Note{ID: s.id, Body: &body}
+		err = tx.QueryRow(ctx, sqlRewriteNoteBody,
+			s.id, stored.plain, updatedAt, stored.ciphertext, stored.keyID).
+			Scan(&note.OwnerID, &note.Title)
+		if err != nil {
+			return nil, err
+		}
+		if err := createNoteRevision(ctx, tx, bodies, note, updatedAt); err != nil {
+			return nil, err
+		}
+		if err := replaceNoteLinks(ctx, tx, note); err != nil {
+			return nil, err
+		}
+		rewritten = append(rewritten, s.id)
+	}
+	return rewritten, nil
+}
+
+func noteLinkDest(link *entity.NoteLink) []any {
+	return []any{&link.ID, &link.SourceNoteID, &link.OwnerID, &link.TargetNoteID, &link.TargetTitle}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -16,37 +17,162 @@ import (
 
 const (
 	sqlCreateNote = `
-		INSERT INTO notes (owner_id, title, body, created_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, owner_id, title, body, created_at, updated_at
+		INSERT INTO notes (id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id,
+			created_at, search_language, encrypted, note_key)
+		SELECT $10, $1, $2, $3, $4, $5, $6, $7, u.search_language, $8, $9
+		FROM users u
+		WHERE u.id = $1
+			AND ($2::int IS NULL OR EXISTS (SELECT 1 FROM notebooks WHERE id = $2 AND owner_id = $1))
+			AND (NOT $8 OR EXISTS (SELECT 1 FROM user_keys WHERE user_id = $1))
+		RETURNING id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
 	`
 	sqlGetByIDNote = `
-		SELECT id, owner_id, title, body, created_at, updated_at
+		SELECT id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
+		FROM notes
+		WHERE id = $1 AND deleted_at IS NULL
+			AND (owner_id = $2 OR EXISTS (SELECT 1 FROM note_shares WHERE note_id = $1 AND user_id = $2))
+	`
+	sqlGetNoteAccess = `
+		SELECT id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key,
+			CASE WHEN owner_id = $2 THEN 'owner'
+				ELSE (SELECT role FROM note_shares WHERE note_id = $1 AND user_id = $2) END
+		FROM notes
+		WHERE id = $1 AND deleted_at IS NULL
+			AND (owner_id = $2 OR EXISTS (SELECT 1 FROM note_shares WHERE note_id = $1 AND user_id = $2))
+	`
+	sqlListNotes = `
+		SELECT id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
 		FROM notes
-		WHERE id = $1 AND owner_id = $2
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s
+	`
+	sqlSearchNotes = `
+		SELECT n.id, n.owner_id, n.notebook_id, n.title, n.body, n.body_ciphertext, n.body_key_id, n.version,
+			n.created_at, n.updated_at, n.deleted_at, n.pinned_at, n.archived_at, n.starred_at,
+			n.encrypted, n.note_key,
+			ts_rank_cd(n.search_vector, q.query) AS rank,
+			ts_headline(n.search_language, n.title, q.query,
+				'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+			ts_headline(n.search_language, COALESCE(n.body, ''), q.query, '` + snippetOptions + `')
+		FROM notes n, (SELECT %s AS query) q
+		WHERE n.owner_id = $1 AND n.deleted_at IS NULL AND NOT n.encrypted AND n.search_vector @@ q.query
+		ORDER BY rank DESC, n.id DESC
+		LIMIT $2 OFFSET $3
 	`
-	sqlUpdateNote = `
+	// An encrypted body is highlighted once decrypted, see
+	// NoteRepository.highlightBodies.
+	sqlSearchSnippets = `
+		SELECT ts_headline($1::regconfig, b.body, q.query, '` + snippetOptions + `')
+		FROM unnest($2::text[]) WITH ORDINALITY AS b (body, n), (SELECT %s AS query) q
+		ORDER BY b.n
+	`
+	snippetOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MinWords=10, MaxWords=30, FragmentDelimiter=" … "`
+	sqlUpdateNote  = `
 		UPDATE notes
 		SET title = $3,
 			body = $4,
-			updated_at = $5
-		WHERE id = $1 AND owner_id = $2 
-		RETURNING id, owner_id, title, body, created_at, updated_at
+			body_ciphertext = $8,
+			body_key_id = $9,
+			updated_at = $5,
+			version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($6 = 0 OR version = $6) AND encrypted = $7
+			AND (owner_id = $2 OR EXISTS (
+				SELECT 1 FROM note_shares WHERE note_id = $1 AND user_id = $2 AND role = 'editor'))
+		RETURNING id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
+	`
+	sqlLockNoteTitle = `
+		SELECT title
+		FROM notes
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	sqlUpdateNoteStates = `
+		UPDATE notes
+		SET pinned_at = CASE WHEN $3::bool IS NULL THEN pinned_at WHEN $3 THEN COALESCE(pinned_at, $6) END,
+			archived_at = CASE WHEN $4::bool IS NULL THEN archived_at WHEN $4 THEN COALESCE(archived_at, $6) END,
+			starred_at = CASE WHEN $5::bool IS NULL THEN starred_at WHEN $5 THEN COALESCE(starred_at, $6) END,
+			version = version + 1
+		WHERE id = ANY($2) AND owner_id = $1 AND deleted_at IS NULL
+		RETURNING id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
+	`
+	sqlCreateNoteRevision = `
+		INSERT INTO note_revisions (id, note_id, owner_id, revision, title, body, body_ciphertext, body_key_id, created_at)
+		SELECT $8, $1, $2, COALESCE(MAX(revision), 0) + 1, $3, $4, $5, $6, $7
+		FROM note_revisions
+		WHERE note_id = $1
+	`
+	// A body is encrypted for the row it goes in, so the id of a new note or
+	// revision is drawn before the row is written.
+	sqlNextNoteID = `
+		SELECT nextval(pg_get_serial_sequence('notes', 'id'))
+	`
+	sqlNextNoteRevisionID = `
+		SELECT nextval(pg_get_serial_sequence('note_revisions', 'id'))
+	`
+	sqlClaimSyncCreate = `
+		INSERT INTO sync_creates (user_id, client_id, note_id, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, client_id) DO NOTHING
 	`
-	sqlDeleteNote = `
+	sqlGetSyncCreate = `
+		SELECT note_id
+		FROM sync_creates
+		WHERE user_id = $1 AND client_id = $2
+	`
+	sqlTrashNote = `
+		UPDATE notes
+		SET deleted_at = $3,
+			version = version + 1
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL AND ($4 = 0 OR version = $4)
+	`
+	sqlGetNoteVersion = `
+		SELECT version, owner_id
+		FROM notes
+		WHERE id = $1 AND deleted_at IS NULL
+			AND (owner_id = $2 OR EXISTS (SELECT 1 FROM note_shares WHERE note_id = $1 AND user_id = $2))
+	`
+	sqlListTrashNotes = `
+		SELECT id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
+		FROM notes
+		WHERE owner_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC
+	`
+	sqlRestoreNote = `
+		UPDATE notes
+		SET deleted_at = NULL,
+			version = version + 1
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NOT NULL
+		RETURNING id, owner_id, notebook_id, title, body, body_ciphertext, body_key_id, version,
+			created_at, updated_at, deleted_at, pinned_at, archived_at, starred_at, encrypted, note_key
+	`
+	sqlPurgeNote = `
+		DELETE FROM notes
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NOT NULL
+	`
+	sqlPurgeTrashedNotes = `
 		DELETE FROM notes
-		WHERE id = $1 AND owner_id = $2
+		WHERE deleted_at < $1
 	`
 )
 
 type NoteRepository struct {
 	db     *pgxpool.Pool
+	bodies *BodyCipher
 	logger logging.Logger
 }
 
-func NewNoteRepository(db *pgxpool.Pool, logger logging.Logger) *NoteRepository {
+func NewNoteRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *NoteRepository {
 	return &NoteRepository{
 		db:     db,
+		bodies: bodies,
 		logger: logger,
 	}
 }
@@ -58,17 +184,44 @@ func (r *NoteRepository) Create(ctx context.Context, note entity.Note) (entity.N
 
 	r.logger.Debug("monitor[note]: starting note db insertion",
 		logging.NewField("owner_id", note.OwnerID),
+		logging.NewField("notebook_id", note.NotebookID),
 		logging.NewField("title", note.Title),
-		logging.NewField("body", note.Body),
+		logging.NewField("body_length", bodyLength(note.Body)),
+		logging.NewField("encrypted", note.Encrypted),
 		logging.NewField("created_at", note.CreatedAt),
 	)
 
 	var resp entity.Note
 
-	err := r.db.QueryRow(ctx, sqlCreateNote,
-		note.OwnerID, note.Title, note.Body, note.CreatedAt).
-		Scan(&resp.ID, &resp.OwnerID, &resp.Title, &resp.Body, &resp.CreatedAt, &resp.UpdatedAt)
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var id int
+		if err := tx.QueryRow(ctx, sqlNextNoteID).Scan(&id); err != nil {
+			return err
+		}
+		var err error
+		resp, err = createNote(ctx, tx, r.bodies, id, note)
+		return err
+	})
 	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("notebook_id", note.NotebookID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
 				logging.NewField("owner_id", note.OwnerID),
@@ -96,6 +249,125 @@ func (r *NoteRepository) Create(ctx context.Context, note entity.Note) (entity.N
 	return resp, nil
 }
 
+// CreateForClient creates note like Create, once per clientID of the owner:
+// when the owner has created a note under clientID before, that note is
+// returned as it is now instead. If it has been deleted since, the result is
+// repository.ErrConflict.
+func (r *NoteRepository) CreateForClient(ctx context.Context, note entity.Note, clientID string) (entity.Note, error) {
+	start := time.Now()
+
+	note.CreatedAt = start
+
+	r.logger.Debug("monitor[note]: starting note db insertion for client",
+		logging.NewField("owner_id", note.OwnerID),
+		logging.NewField("client_id", clientID),
+		logging.NewField("notebook_id", note.NotebookID),
+		logging.NewField("title", note.Title),
+		logging.NewField("body_length", bodyLength(note.Body)),
+		logging.NewField("encrypted", note.Encrypted),
+		logging.NewField("created_at", note.CreatedAt),
+	)
+
+	var (
+		resp     entity.Note
+		replayed bool
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var id int
+		if err := tx.QueryRow(ctx, sqlNextNoteID).Scan(&id); err != nil {
+			return err
+		}
+
+		// A concurrent create under the same client id waits here for the
+		// other to commit, then finds its note.
+		tag, err := tx.Exec(ctx, sqlClaimSyncCreate, note.OwnerID, clientID, id, note.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 1 {
+			resp, err = createNote(ctx, tx, r.bodies, id, note)
+			return err
+		}
+
+		replayed = true
+		if err := tx.QueryRow(ctx, sqlGetSyncCreate, note.OwnerID, clientID).Scan(&id); err != nil {
+			return err
+		}
+		var row noteRow
+		err = tx.QueryRow(ctx, sqlGetByIDNote, id, note.OwnerID).Scan(row.dest()...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: note %d created for client id %q has been deleted",
+				repository.ErrConflict, id, clientID)
+		}
+		if err != nil {
+			return err
+		}
+		resp, err = r.bodies.openNote(ctx, row)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("client_id", clientID),
+				logging.NewField("operation", "insert_for_client"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			r.logger.Warn(fmt.Sprintf("fail[note]: %v", repository.ErrConflict),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("client_id", clientID),
+				logging.NewField("operation", "insert_for_client"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("client_id", clientID),
+				logging.NewField("notebook_id", note.NotebookID),
+				logging.NewField("operation", "insert_for_client"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("client_id", clientID),
+				logging.NewField("operation", "insert_for_client"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("owner_id", note.OwnerID),
+			logging.NewField("client_id", clientID),
+			logging.NewField("operation", "insert_for_client"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Note{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: inserted for client successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("client_id", clientID),
+		logging.NewField("replayed", replayed),
+	)
+	return resp, nil
+}
+
+// GetByID returns a note owned by or shared with ownerID.
 func (r *NoteRepository) GetByID(ctx context.Context, id int, ownerID int) (entity.Note, error) {
 	start := time.Now()
 
@@ -104,11 +376,27 @@ func (r *NoteRepository) GetByID(ctx context.Context, id int, ownerID int) (enti
 		logging.NewField("owner_id", ownerID),
 	)
 
-	var resp entity.Note
+	var (
+		row  noteRow
+		resp entity.Note
+	)
 
 	err := r.db.QueryRow(ctx, sqlGetByIDNote, id, ownerID).
-		Scan(&resp.ID, &resp.OwnerID, &resp.Title, &resp.Body, &resp.CreatedAt, &resp.UpdatedAt)
+		Scan(row.dest()...)
+	if err == nil {
+		resp, err = r.bodies.openNote(ctx, row)
+	}
 	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "get_by_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
 		if errors.Is(err, pgx.ErrNoRows) {
 			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
 				logging.NewField("id", id),
@@ -147,7 +435,175 @@ func (r *NoteRepository) GetByID(ctx context.Context, id int, ownerID int) (enti
 	return resp, nil
 }
 
-func (r *NoteRepository) Update(ctx context.Context, note entity.Note) (entity.Note, error) {
+func (r *NoteRepository) List(ctx context.Context, params repository.NoteListParams) ([]entity.Note, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting note db list",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("sort_by", params.SortBy),
+		logging.NewField("desc", params.Desc),
+		logging.NewField("limit", params.Limit),
+	)
+
+	query, args := buildListNotesQuery(params)
+
+	// Query errors are reported again by CollectRows, which also closes rows.
+	rows, _ := r.db.Query(ctx, query, args...)
+	noteRows, err := pgx.CollectRows(rows, collectNoteRow)
+	var resp []entity.Note
+	if err == nil {
+		resp, err = r.bodies.openNotes(ctx, noteRows)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("owner_id", params.OwnerID),
+				logging.NewField("operation", "list"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", params.OwnerID),
+				logging.NewField("operation", "list"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("owner_id", params.OwnerID),
+			logging.NewField("operation", "list"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: listed successfully",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func (r *NoteRepository) Search(
+	ctx context.Context,
+	params repository.NoteSearchParams,
+) ([]repository.NoteSearchHit, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting note db search",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("terms", len(params.Terms)),
+		logging.NewField("language", params.Language),
+		logging.NewField("limit", params.Limit),
+		logging.NewField("offset", params.Offset),
+	)
+
+	query, args := buildSearchNotesQuery(params)
+
+	var bodies []storedBody
+	rows, _ := r.db.Query(ctx, query, args...)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.NoteSearchHit, error) {
+		var (
+			hit repository.NoteSearchHit
+			n   noteRow
+		)
+		err := row.Scan(append(n.dest(), &hit.Rank, &hit.TitleHighlight, &hit.Snippet)...)
+		hit.Note = n.note
+		bodies = append(bodies, n.body)
+		return hit, err
+	})
+	if err == nil {
+		err = r.highlightBodies(ctx, params, resp, bodies)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("owner_id", params.OwnerID),
+				logging.NewField("operation", "search"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", params.OwnerID),
+				logging.NewField("operation", "search"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("owner_id", params.OwnerID),
+			logging.NewField("operation", "search"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: searched successfully",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// highlightBodies decrypts the bodies of hits stored encrypted, which the
+// search query can't read, and sets their snippets.
+func (r *NoteRepository) highlightBodies(
+	ctx context.Context,
+	params repository.NoteSearchParams,
+	hits []repository.NoteSearchHit,
+	bodies []storedBody,
+) error {
+	var (
+		encrypted []int
+		plain     []string
+	)
+	for i, body := range bodies {
+		text, err := r.bodies.open(ctx, "notes", hits[i].Note.ID, body)
+		if err != nil {
+			return err
+		}
+		hits[i].Note.Body = text
+		if body.keyID != nil {
+			encrypted = append(encrypted, i)
+			plain = append(plain, *text)
+		}
+	}
+	if len(encrypted) == 0 {
+		return nil
+	}
+
+	query, args := buildSearchSnippetsQuery(params, plain)
+	rows, _ := r.db.Query(ctx, query, args...)
+	snippets, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for j, i := range encrypted {
+		hits[i].Snippet = snippets[j]
+	}
+	return nil
+}
+
+// Update overwrites the title and body of a note and bumps its version.
+// note.OwnerID is the user making the change, who must own the note or have
+// been shared it as an editor; other users with access get
+// repository.ErrForbidden. A non-zero note.Version must match the stored
+// version, otherwise nothing is written and the current note is returned
+// along with repository.ErrConflict, as happens when note.Encrypted does not
+// match the stored note. With rewriteLinks set, which only the owner may do,
+// a rename also rewrites the title links to the note in the owner's other
+// notes. The note key of an encrypted note never changes.
+func (r *NoteRepository) Update(ctx context.Context, note entity.Note, rewriteLinks bool) (entity.Note, error) {
 	start := time.Now()
 
 	note.UpdatedAt = &start
@@ -156,17 +612,57 @@ func (r *NoteRepository) Update(ctx context.Context, note entity.Note) (entity.N
 		logging.NewField("id", note.ID),
 		logging.NewField("owner_id", note.OwnerID),
 		logging.NewField("title", note.Title),
-		logging.NewField("body", note.Body),
+		logging.NewField("body_length", bodyLength(note.Body)),
+		logging.NewField("encrypted", note.Encrypted),
+		logging.NewField("version", note.Version),
+		logging.NewField("rewrite_links", rewriteLinks),
 		logging.NewField("created_at", note.CreatedAt),
 		logging.NewField("updated_at", note.UpdatedAt),
 	)
 
-	var resp entity.Note
+	var (
+		resp      entity.Note
+		rewritten []int
+	)
 
-	err := r.db.QueryRow(ctx, sqlUpdateNote, note.ID, note.OwnerID, note.Title, note.Body, note.UpdatedAt).
-		Scan(&resp.ID, &resp.OwnerID, &resp.Title, &resp.Body, &resp.CreatedAt, &resp.UpdatedAt)
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var err error
+		resp, rewritten, err = updateNote(ctx, tx, r.bodies, note, rewriteLinks)
+		return err
+	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("id", note.ID),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("operation", "update"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			r.logger.Warn(fmt.Sprintf("fail[note]: %v", repository.ErrConflict),
+				logging.NewField("id", note.ID),
+				logging.NewField("owner_id", note.OwnerID),
+				logging.NewField("version", note.Version),
+				logging.NewField("operation", "update"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return resp, err
+		}
+		if errors.Is(err, repository.ErrForbidden) {
+			r.logger.Warn(fmt.Sprintf("fail[note]: %v", repository.ErrForbidden),
+				logging.NewField("id", note.ID),
+				logging.NewField("user_id", note.OwnerID),
+				logging.NewField("operation", "update"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
 			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
 				logging.NewField("id", note.ID),
 				logging.NewField("owner_id", note.OwnerID),
@@ -174,7 +670,7 @@ func (r *NoteRepository) Update(ctx context.Context, note entity.Note) (entity.N
 				logging.NewField("duration", time.Since(start)),
 				logging.NewField("error", err),
 			)
-			return entity.Note{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+			return entity.Note{}, err
 		}
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
@@ -200,20 +696,164 @@ func (r *NoteRepository) Update(ctx context.Context, note entity.Note) (entity.N
 		logging.NewField("id", resp.ID),
 		logging.NewField("owner_id", resp.OwnerID),
 		logging.NewField("title", resp.Title),
+		logging.NewField("rewritten_note_ids", rewritten),
 	)
 	return resp, nil
 }
 
-func (r *NoteRepository) Delete(ctx context.Context, id int, ownerID int) error {
+// updateNote writes note as Update does, inside tx, and returns the updated
+// note and the notes whose links were rewritten. The note row stays locked by
+// the update until commit, so concurrent updates of one note get consecutive
+// revision numbers. On a conflict the current note is returned along with
+// repository.ErrConflict.
+func updateNote(
+	ctx context.Context,
+	tx pgx.Tx,
+	bodies *BodyCipher,
+	note entity.Note,
+	rewriteLinks bool,
+) (entity.Note, []int, error) {
+	var oldTitle string
+	if rewriteLinks {
+		err := tx.QueryRow(ctx, sqlLockNoteTitle, note.ID).Scan(&oldTitle)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return entity.Note{}, nil, err
+		}
+	}
+
+	body, err := bodies.seal(ctx, "notes", note.ID, note.Body)
+	if err != nil {
+		return entity.Note{}, nil, err
+	}
+
+	var row noteRow
+	err = tx.QueryRow(ctx, sqlUpdateNote,
+		note.ID, note.OwnerID, note.Title, body.plain, note.UpdatedAt, note.Version, note.Encrypted,
+		body.ciphertext, body.keyID).
+		Scan(row.dest()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var role string
+		err = tx.QueryRow(ctx, sqlGetNoteAccess, note.ID, note.OwnerID).
+			Scan(append(row.dest(), &role)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.Note{}, nil, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if err != nil {
+			return entity.Note{}, nil, err
+		}
+		if role != "owner" && role != string(entity.ShareRoleEditor) {
+			return entity.Note{}, nil, fmt.Errorf("%w: %s can't edit note %d", repository.ErrForbidden, role, note.ID)
+		}
+		current, err := bodies.openNote(ctx, row)
+		if err != nil {
+			return entity.Note{}, nil, err
+		}
+		if current.Encrypted != note.Encrypted {
+			return current, nil, fmt.Errorf("%w: note %d has encrypted %t",
+				repository.ErrConflict, note.ID, current.Encrypted)
+		}
+		return current, nil, fmt.Errorf("%w: expected version %d, current version %d",
+			repository.ErrConflict, note.Version, current.Version)
+	}
+	if err != nil {
+		return entity.Note{}, nil, err
+	}
+	resp := row.note
+	resp.Body = note.Body
+
+	if err := createNoteRevision(ctx, tx, bodies, resp, *resp.UpdatedAt); err != nil {
+		return entity.Note{}, nil, err
+	}
+	if err := replaceNoteLinks(ctx, tx, resp); err != nil {
+		return entity.Note{}, nil, err
+	}
+
+	var rewritten []int
+	if rewriteLinks && !strings.EqualFold(oldTitle, resp.Title) {
+		if resp.OwnerID != note.OwnerID {
+			return entity.Note{}, nil, fmt.Errorf("%w: only the owner can rewrite links to note %d",
+				repository.ErrForbidden, note.ID)
+		}
+		rewritten, err = rewriteIncomingLinks(ctx, tx, bodies,
+			resp.OwnerID, resp.ID, oldTitle, resp.Title, *resp.UpdatedAt)
+		if err != nil {
+			return entity.Note{}, nil, err
+		}
+	}
+
+	err = recordChanges(ctx, tx, append([]int{resp.ID}, rewritten...), entity.ChangeUpdate, *resp.UpdatedAt)
+	if err != nil {
+		return entity.Note{}, nil, err
+	}
+	return resp, rewritten, nil
+}
+
+// Delete moves a note to the trash. Trashed notes are hidden from every other
+// query until they are restored or purged. A non-zero version must match the
+// stored version, otherwise the note stays and repository.ErrConflict is
+// returned. A note only shared with ownerID gives repository.ErrForbidden.
+func (r *NoteRepository) Delete(ctx context.Context, id int, ownerID int, version int) error {
 	start := time.Now()
 
-	r.logger.Debug("monitor[note]: starting note db delete",
+	r.logger.Debug("monitor[note]: starting note db move to trash",
 		logging.NewField("id", id),
 		logging.NewField("owner_id", ownerID),
+		logging.NewField("version", version),
 	)
 
-	tag, err := r.db.Exec(ctx, sqlDeleteNote, id, ownerID)
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sqlTrashNote, id, ownerID, start, version)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var current, noteOwnerID int
+			err := tx.QueryRow(ctx, sqlGetNoteVersion, id, ownerID).Scan(&current, &noteOwnerID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: note %d", repository.ErrNotFound, id)
+			}
+			if err != nil {
+				return err
+			}
+			if noteOwnerID != ownerID {
+				return fmt.Errorf("%w: only the owner can delete note %d", repository.ErrForbidden, id)
+			}
+			return fmt.Errorf("%w: expected version %d, current version %d",
+				repository.ErrConflict, version, current)
+		}
+		return recordChanges(ctx, tx, []int{id}, entity.ChangeDelete, start)
+	})
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			r.logger.Warn(fmt.Sprintf("fail[note]: %v", repository.ErrConflict),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("version", version),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return err
+		}
+		if errors.Is(err, repository.ErrForbidden) {
+			r.logger.Warn(fmt.Sprintf("fail[note]: %v", repository.ErrForbidden),
+				logging.NewField("id", id),
+				logging.NewField("user_id", ownerID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return err
+		}
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
 				logging.NewField("id", id),
@@ -233,20 +873,507 @@ func (r *NoteRepository) Delete(ctx context.Context, id int, ownerID int) error
 		)
 		return fmt.Errorf("%w: %w", repository.ErrDB, err)
 	}
+
+	r.logger.Info("done[note]: moved to trash successfully",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+	return nil
+}
+
+// ListTrash returns the owner's trashed notes, most recently deleted first.
+func (r *NoteRepository) ListTrash(ctx context.Context, ownerID int) ([]entity.Note, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting note db list trash",
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListTrashNotes, ownerID)
+	noteRows, err := pgx.CollectRows(rows, collectNoteRow)
+	var resp []entity.Note
+	if err == nil {
+		resp, err = r.bodies.openNotes(ctx, noteRows)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list_trash"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list_trash"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list_trash"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: listed trash successfully",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// Restore moves a trashed note back out of the trash.
+func (r *NoteRepository) Restore(ctx context.Context, id int, ownerID int) (entity.Note, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting note db restore from trash",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	var (
+		row  noteRow
+		resp entity.Note
+	)
+
+	// A restored note comes back to synced clients as a new one.
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, sqlRestoreNote, id, ownerID).Scan(row.dest()...); err != nil {
+			return err
+		}
+		var err error
+		if resp, err = r.bodies.openNote(ctx, row); err != nil {
+			return err
+		}
+		return recordChanges(ctx, tx, []int{id}, entity.ChangeCreate, start)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "restore"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, err
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "restore"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "restore"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Note{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "restore"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Note{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: restored from trash successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+	)
+	return resp, nil
+}
+
+// PurgePermanently deletes a trashed note for good. Notes that are not in
+// the trash are reported as repository.ErrNotFound.
+func (r *NoteRepository) PurgePermanently(ctx context.Context, id int, ownerID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting note db purge",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlPurgeNote, id, ownerID)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "purge"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "purge"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
 	if tag.RowsAffected() == 0 {
 		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
 			logging.NewField("id", id),
 			logging.NewField("owner_id", ownerID),
-			logging.NewField("operation", "delete"),
+			logging.NewField("operation", "purge"),
 			logging.NewField("duration", time.Since(start)),
-			logging.NewField("error", err),
 		)
-		return fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		return fmt.Errorf("%w: note %d in trash", repository.ErrNotFound, id)
 	}
 
-	r.logger.Info("done[note]: deleted successfully",
+	r.logger.Info("done[note]: purged successfully",
 		logging.NewField("id", id),
 		logging.NewField("owner_id", ownerID),
 	)
 	return nil
 }
+
+// PurgeTrashed deletes, for every owner, the notes trashed before
+// deletedBefore.
+func (r *NoteRepository) PurgeTrashed(ctx context.Context, deletedBefore time.Time) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting trashed notes db purge",
+		logging.NewField("deleted_before", deletedBefore),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlPurgeTrashedNotes, deletedBefore)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "purge_trashed"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("operation", "purge_trashed"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: trashed notes purged successfully",
+		logging.NewField("deleted", tag.RowsAffected()),
+	)
+	return nil
+}
+
+// SetState changes the pinned, archived and starred states of the owner's
+// notes ids in one transaction and returns the updated notes. Setting a state
+// that is already set keeps its original timestamp. When any note does not
+// exist or is in the trash nothing is changed and repository.ErrNotFound is
+// returned.
+func (r *NoteRepository) SetState(
+	ctx context.Context,
+	ownerID int,
+	ids []int,
+	change repository.NoteStateChange,
+) ([]entity.Note, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note]: starting note db set state",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("ids", ids),
+		logging.NewField("pinned", change.Pinned),
+		logging.NewField("archived", change.Archived),
+		logging.NewField("starred", change.Starred),
+	)
+
+	var resp []entity.Note
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(ctx, sqlUpdateNoteStates,
+			ownerID, ids, change.Pinned, change.Archived, change.Starred, start)
+		noteRows, err := pgx.CollectRows(rows, collectNoteRow)
+		if err != nil {
+			return err
+		}
+		if len(noteRows) != len(ids) {
+			return fmt.Errorf("%w: %d of %d notes", repository.ErrNotFound, len(ids)-len(noteRows), len(ids))
+		}
+		resp, err = r.bodies.openNotes(ctx, noteRows)
+		if err != nil {
+			return err
+		}
+		return recordChanges(ctx, tx, ids, entity.ChangeUpdate, start)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDecrypt),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("ids", ids),
+				logging.NewField("operation", "set_state"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrNotFound),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("ids", ids),
+				logging.NewField("operation", "set_state"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "set_state"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note]: %v", repository.ErrDB),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "set_state"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note]: state set successfully",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func collectNoteRow(row pgx.CollectableRow) (noteRow, error) {
+	var r noteRow
+	err := row.Scan(r.dest()...)
+	return r, err
+}
+
+// createNote inserts note with id, drawn from sqlNextNoteID, inside tx and
+// returns it.
+func createNote(ctx context.Context, tx pgx.Tx, bodies *BodyCipher, id int, note entity.Note) (entity.Note, error) {
+	body, err := bodies.seal(ctx, "notes", id, note.Body)
+	if err != nil {
+		return entity.Note{}, err
+	}
+
+	var row noteRow
+	err = tx.QueryRow(ctx, sqlCreateNote,
+		note.OwnerID, note.NotebookID, note.Title, body.plain, body.ciphertext, body.keyID,
+		note.CreatedAt, note.Encrypted, note.NoteKey, id).
+		Scan(row.dest()...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.Note{}, fmt.Errorf("%w: user, notebook or user key: %w", repository.ErrNotFound, err)
+		}
+		return entity.Note{}, err
+	}
+	resp := row.note
+	resp.Body = note.Body
+
+	if err := createNoteRevision(ctx, tx, bodies, resp, resp.CreatedAt); err != nil {
+		return entity.Note{}, err
+	}
+	if err := replaceNoteLinks(ctx, tx, resp); err != nil {
+		return entity.Note{}, err
+	}
+	if err := recordChanges(ctx, tx, []int{resp.ID}, entity.ChangeCreate, resp.CreatedAt); err != nil {
+		return entity.Note{}, err
+	}
+	return resp, nil
+}
+
+// createNoteRevision records note, with its body in plain text, as the newest
+// revision of the note.
+func createNoteRevision(ctx context.Context, tx pgx.Tx, bodies *BodyCipher, note entity.Note, createdAt time.Time) error {
+	var id int
+	if err := tx.QueryRow(ctx, sqlNextNoteRevisionID).Scan(&id); err != nil {
+		return err
+	}
+	body, err := bodies.seal(ctx, "note_revisions", id, note.Body)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, sqlCreateNoteRevision,
+		note.ID, note.OwnerID, note.Title, body.plain, body.ciphertext, body.keyID, createdAt, id)
+	return err
+}
+
+// buildListNotesQuery renders sqlListNotes for params. Column names come from
+// a fixed set; every user supplied value is passed as an argument.
+func buildListNotesQuery(params repository.NoteListParams) (string, []any) {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := noteFilterConditions(params, arg)
+
+	dir, cmp := "ASC", ">"
+	if params.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	var orderBy, after string
+	c := params.After
+	switch params.SortBy {
+	case repository.NoteSortUpdatedAt:
+		orderBy = fmt.Sprintf("updated_at %s NULLS LAST, id %s", dir, dir)
+		if c != nil {
+			if c.UpdatedAt == nil {
+				after = fmt.Sprintf("(updated_at IS NULL AND id %s %s)", cmp, arg(c.ID))
+			} else {
+				after = fmt.Sprintf("(updated_at IS NULL OR (updated_at, id) %s (%s, %s))",
+					cmp, arg(*c.UpdatedAt), arg(c.ID))
+			}
+		}
+	case repository.NoteSortTitle:
+		orderBy = fmt.Sprintf("title %s, id %s", dir, dir)
+		if c != nil {
+			after = fmt.Sprintf("(title, id) %s (%s, %s)", cmp, arg(c.Title), arg(c.ID))
+		}
+	default:
+		orderBy = fmt.Sprintf("created_at %s, id %s", dir, dir)
+		if c != nil {
+			after = fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(c.CreatedAt), arg(c.ID))
+		}
+	}
+
+	// Pinned notes come first in either direction, each group in sort order.
+	if params.PinnedFirst {
+		orderBy = "(pinned_at IS NULL), " + orderBy
+		if c != nil {
+			if c.Pinned {
+				after = fmt.Sprintf("(pinned_at IS NULL OR %s)", after)
+			} else {
+				after = fmt.Sprintf("(pinned_at IS NULL AND %s)", after)
+			}
+		}
+	}
+	if after != "" {
+		where = append(where, after)
+	}
+
+	return fmt.Sprintf(sqlListNotes, strings.Join(where, " AND "), orderBy, arg(params.Limit)), args
+}
+
+// noteFilterConditions returns the WHERE conditions on notes shared by note
+// listing and the tag counts that go with it. Sorting and the cursor are left
+// to the caller.
+func noteFilterConditions(params repository.NoteListParams, arg func(any) string) []string {
+	where := []string{"owner_id = " + arg(params.OwnerID), "deleted_at IS NULL"}
+	if params.CreatedFrom != nil {
+		where = append(where, "created_at >= "+arg(*params.CreatedFrom))
+	}
+	if params.CreatedTo != nil {
+		where = append(where, "created_at < "+arg(*params.CreatedTo))
+	}
+	if params.UpdatedFrom != nil {
+		where = append(where, "updated_at >= "+arg(*params.UpdatedFrom))
+	}
+	if params.UpdatedTo != nil {
+		where = append(where, "updated_at < "+arg(*params.UpdatedTo))
+	}
+	if params.NotebookID != nil {
+		where = append(where, "notebook_id = "+arg(*params.NotebookID))
+	}
+	if params.Pinned != nil {
+		where = append(where, nullCheck("pinned_at", *params.Pinned))
+	}
+	if params.Starred != nil {
+		where = append(where, nullCheck("starred_at", *params.Starred))
+	}
+	switch params.Archived {
+	case repository.ArchivedOnly:
+		where = append(where, "archived_at IS NOT NULL")
+	case repository.ArchivedInclude:
+	default:
+		where = append(where, "archived_at IS NULL")
+	}
+	if len(params.AnyTagIDs) > 0 {
+		where = append(where, fmt.Sprintf(
+			"id IN (SELECT note_id FROM note_tags WHERE tag_id = ANY(%s))", arg(params.AnyTagIDs)))
+	}
+	if len(params.AllTagIDs) > 0 {
+		where = append(where, fmt.Sprintf(
+			"id IN (SELECT note_id FROM note_tags WHERE tag_id = ANY(%s) GROUP BY note_id HAVING COUNT(*) = %s)",
+			arg(params.AllTagIDs), arg(len(params.AllTagIDs))))
+	}
+	return where
+}
+
+// nullCheck returns a condition that holds when the timestamp column is set,
+// or when it is not set if set is false.
+func nullCheck(column string, set bool) string {
+	if set {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
+
+// buildSearchNotesQuery renders sqlSearchNotes with one tsquery per term,
+// all of which must match.
+func buildSearchNotesQuery(params repository.NoteSearchParams) (string, []any) {
+	args := []any{params.OwnerID, params.Limit, params.Offset, params.Language}
+	query, args := buildTSQuery(params.Terms, "$4", args)
+	return fmt.Sprintf(sqlSearchNotes, query), args
+}
+
+// buildSearchSnippetsQuery renders sqlSearchSnippets for params and the
+// decrypted bodies to highlight.
+func buildSearchSnippetsQuery(params repository.NoteSearchParams, bodies []string) (string, []any) {
+	args := []any{params.Language, bodies}
+	query, args := buildTSQuery(params.Terms, "$1", args)
+	return fmt.Sprintf(sqlSearchSnippets, query), args
+}
+
+// buildTSQuery renders the tsquery matching all terms, normalized with the
+// text search configuration in argument lang. Term texts are appended to
+// args.
+func buildTSQuery(terms []repository.SearchTerm, lang string, args []any) (string, []any) {
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	queries := make([]string, 0, len(terms))
+	for _, term := range terms {
+		switch term.Kind {
+		case repository.SearchTermPhrase:
+			queries = append(queries, fmt.Sprintf("phraseto_tsquery(%s::regconfig, %s)", lang, arg(term.Text)))
+		case repository.SearchTermPrefix:
+			queries = append(queries, fmt.Sprintf("to_tsquery(%s::regconfig, %s || ':*')", lang, arg(term.Text)))
+		default:
+			queries = append(queries, fmt.Sprintf("plainto_tsquery(%s::regconfig, %s)", lang, arg(term.Text)))
+		}
+	}
+	return strings.Join(queries, " && "), args
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/repository"
+)
+
+func TestNoteCreateForClientIsIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repos := NewRepository(db, nil, testLogger{})
+
+	user, err := repos.User.Create(ctx, entity.User{Name: "Ann", Email: "ann@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "offline"
+	note := entity.Note{OwnerID: user.ID, Title: "Draft", Body: &body}
+
+	first, err := repos.Note.CreateForClient(ctx, note, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := repos.Note.CreateForClient(ctx, note, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID || again.Body == nil || *again.Body != body {
+		t.Fatalf("replay got note %d with body %v, want note %d", again.ID, again.Body, first.ID)
+	}
+
+	other, err := repos.Note.CreateForClient(ctx, note, "c2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == first.ID {
+		t.Fatalf("another client id got the same note %d", other.ID)
+	}
+
+	if err := repos.Note.Delete(ctx, first.ID, user.ID, first.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Note.CreateForClient(ctx, note, "c1"); !errors.Is(err, repository.ErrConflict) {
+		t.Fatalf("replay of a deleted note got %v, want a conflict", err)
+	}
+}
@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlListNoteRevisions = `
+		SELECT id, note_id, owner_id, revision, title, created_at
+		FROM note_revisions
+		WHERE note_id = $1 AND owner_id = $2
+			AND EXISTS (SELECT 1 FROM notes WHERE id = $1 AND deleted_at IS NULL)
+		ORDER BY revision DESC
+	`
+	sqlGetNoteRevision = `
+		SELECT id, note_id, owner_id, revision, title, body, body_ciphertext, body_key_id, created_at
+		FROM note_revisions
+		WHERE note_id = $1 AND owner_id = $2 AND revision = $3
+			AND EXISTS (SELECT 1 FROM notes WHERE id = $1 AND deleted_at IS NULL)
+	`
+	sqlPruneNoteRevisions = `
+		DELETE FROM note_revisions r
+		USING (
+			SELECT id, created_at,
+				ROW_NUMBER() OVER (PARTITION BY note_id ORDER BY revision DESC) AS position
+			FROM note_revisions
+		) ranked
+		WHERE r.id = ranked.id
+			AND ranked.position > 1
+			AND (($1::int > 0 AND ranked.position > $1)
+				OR ($2::timestamp IS NOT NULL AND ranked.created_at < $2))
+	`
+)
+
+type NoteRevisionRepository struct {
+	db     *pgxpool.Pool
+	bodies *BodyCipher
+	logger logging.Logger
+}
+
+func NewNoteRevisionRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *NoteRevisionRepository {
+	return &NoteRevisionRepository{
+		db:     db,
+		bodies: bodies,
+		logger: logger,
+	}
+}
+
+// List returns the revisions of a note, newest first, without their bodies.
+// Every note keeps at least its latest revision, so an empty result means the
+// note does not exist and repository.ErrNotFound is returned.
+func (r *NoteRevisionRepository) List(ctx context.Context, noteID int, ownerID int) ([]entity.NoteRevision, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_revision]: starting note revisions db list",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListNoteRevisions, noteID, ownerID)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.NoteRevision, error) {
+		var revision entity.NoteRevision
+		err := row.Scan(&revision.ID, &revision.NoteID, &revision.OwnerID, &revision.Revision,
+			&revision.Title, &revision.CreatedAt)
+		return revision, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+	if len(resp) == 0 {
+		r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrNotFound),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list"),
+			logging.NewField("duration", time.Since(start)),
+		)
+		return nil, fmt.Errorf("%w: note %d", repository.ErrNotFound, noteID)
+	}
+
+	r.logger.Info("done[note_revision]: listed successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func (r *NoteRevisionRepository) Get(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	revision int,
+) (entity.NoteRevision, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_revision]: starting note revision db get",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("revision", revision),
+	)
+
+	var (
+		resp entity.NoteRevision
+		body storedBody
+	)
+
+	err := r.db.QueryRow(ctx, sqlGetNoteRevision, noteID, ownerID, revision).
+		Scan(append([]any{&resp.ID, &resp.NoteID, &resp.OwnerID, &resp.Revision, &resp.Title},
+			append(body.dest(), &resp.CreatedAt)...)...)
+	if err == nil {
+		resp.Body, err = r.bodies.open(ctx, "note_revisions", resp.ID, body)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrDecrypt),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("revision", revision),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteRevision{}, err
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("revision", revision),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteRevision{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("revision", revision),
+				logging.NewField("operation", "get"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteRevision{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("revision", revision),
+			logging.NewField("operation", "get"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.NoteRevision{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_revision]: got successfully",
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("revision", resp.Revision),
+	)
+	return resp, nil
+}
+
+// Prune deletes revisions beyond the keepLast newest of each note and those
+// created before createdBefore. A zero keepLast or nil createdBefore disables
+// that rule. The latest revision of a note is never deleted.
+func (r *NoteRevisionRepository) Prune(ctx context.Context, keepLast int, createdBefore *time.Time) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_revision]: starting note revisions db prune",
+		logging.NewField("keep_last", keepLast),
+		logging.NewField("created_before", createdBefore),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlPruneNoteRevisions, keepLast, createdBefore)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "prune"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_revision]: %v", repository.ErrDB),
+			logging.NewField("operation", "prune"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_revision]: pruned successfully",
+		logging.NewField("deleted", tag.RowsAffected()),
+	)
+	return nil
+}
@@ -0,0 +1,398 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlCreateNoteShare = `
+		INSERT INTO note_shares (note_id, user_id, role, created_at)
+		SELECT $1, $3, $4, $5
+		WHERE EXISTS (SELECT 1 FROM notes WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL)
+		RETURNING note_id, user_id, role, created_at, updated_at
+	`
+	sqlExistsOwnedNote = `
+		SELECT EXISTS (SELECT 1 FROM notes WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL)
+	`
+	sqlListNoteShares = `
+		SELECT s.note_id, s.user_id, s.role, s.created_at, s.updated_at, u.email
+		FROM note_shares s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.note_id = $1
+		ORDER BY u.email
+	`
+	sqlListSharedNotes = `
+		SELECT n.id, n.owner_id, n.notebook_id, n.title, n.body, n.body_ciphertext, n.body_key_id, n.version,
+			n.created_at, n.updated_at, n.deleted_at, n.pinned_at, n.archived_at, n.starred_at,
+			n.encrypted, n.note_key,
+			s.role
+		FROM note_shares s
+		JOIN notes n ON n.id = s.note_id
+		WHERE s.user_id = $1 AND n.deleted_at IS NULL
+		ORDER BY COALESCE(n.updated_at, n.created_at) DESC, n.id DESC
+	`
+	sqlUpdateNoteShareRole = `
+		UPDATE note_shares
+		SET role = $4,
+			updated_at = $5
+		WHERE note_id = $1 AND user_id = $3
+			AND EXISTS (SELECT 1 FROM notes WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL)
+		RETURNING note_id, user_id, role, created_at, updated_at
+	`
+	sqlDeleteNoteShare = `
+		DELETE FROM note_shares
+		WHERE note_id = $1 AND user_id = $3
+			AND EXISTS (SELECT 1 FROM notes WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL)
+	`
+)
+
+type NoteShareRepository struct {
+	db     *pgxpool.Pool
+	bodies *BodyCipher
+	logger logging.Logger
+}
+
+func NewNoteShareRepository(db *pgxpool.Pool, bodies *BodyCipher, logger logging.Logger) *NoteShareRepository {
+	return &NoteShareRepository{
+		db:     db,
+		bodies: bodies,
+		logger: logger,
+	}
+}
+
+// Create shares a note owned by ownerID. Sharing a note twice with the same
+// user is reported as repository.ErrAlreadyExist.
+func (r *NoteShareRepository) Create(
+	ctx context.Context,
+	ownerID int,
+	share entity.NoteShare,
+) (entity.NoteShare, error) {
+	start := time.Now()
+
+	share.CreatedAt = start
+
+	r.logger.Debug("monitor[note_share]: starting note share db insertion",
+		logging.NewField("note_id", share.NoteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("user_id", share.UserID),
+		logging.NewField("role", share.Role),
+	)
+
+	var resp entity.NoteShare
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, sqlCreateNoteShare,
+			share.NoteID, ownerID, share.UserID, share.Role, share.CreatedAt).
+			Scan(&resp.NoteID, &resp.UserID, &resp.Role, &resp.CreatedAt, &resp.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		// To the new reader the note is created.
+		return recordUserChanges(ctx, tx, resp.UserID, []int{resp.NoteID}, entity.ChangeCreate, share.CreatedAt)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", share.NoteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteShare{}, fmt.Errorf("%w: note: %w", repository.ErrNotFound, err)
+		}
+		if isUniqueViolation(err) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrAlreadyExist),
+				logging.NewField("note_id", share.NoteID),
+				logging.NewField("user_id", share.UserID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteShare{}, fmt.Errorf("%w: %w", repository.ErrAlreadyExist, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", share.NoteID),
+				logging.NewField("user_id", share.UserID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteShare{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrDB),
+			logging.NewField("note_id", share.NoteID),
+			logging.NewField("user_id", share.UserID),
+			logging.NewField("operation", "insert"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.NoteShare{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_share]: inserted successfully",
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("user_id", resp.UserID),
+		logging.NewField("role", resp.Role),
+	)
+	return resp, nil
+}
+
+// List returns the shares of a note owned by ownerID, ordered by email.
+func (r *NoteShareRepository) List(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+) ([]repository.NoteShareItem, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_share]: starting note share db list",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	var resp []repository.NoteShareItem
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var owned bool
+		if err := tx.QueryRow(ctx, sqlExistsOwnedNote, noteID, ownerID).Scan(&owned); err != nil {
+			return err
+		}
+		if !owned {
+			return fmt.Errorf("%w: note %d", repository.ErrNotFound, noteID)
+		}
+
+		rows, _ := tx.Query(ctx, sqlListNoteShares, noteID)
+		items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.NoteShareItem, error) {
+			var item repository.NoteShareItem
+			err := row.Scan(&item.Share.NoteID, &item.Share.UserID, &item.Share.Role,
+				&item.Share.CreatedAt, &item.Share.UpdatedAt, &item.Email)
+			return item, err
+		})
+		resp = items
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_share]: listed successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// ListSharedWith returns the notes other users have shared with userID, most
+// recently changed first.
+func (r *NoteShareRepository) ListSharedWith(ctx context.Context, userID int) ([]repository.SharedNote, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_share]: starting shared notes db list",
+		logging.NewField("user_id", userID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListSharedNotes, userID)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.SharedNote, error) {
+		var (
+			shared repository.SharedNote
+			n      noteRow
+		)
+		if err := row.Scan(append(n.dest(), &shared.Role)...); err != nil {
+			return shared, err
+		}
+		var err error
+		shared.Note, err = r.bodies.openNote(ctx, n)
+		return shared, err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDecrypt) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrDecrypt),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "list_shared_with"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "list_shared_with"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrDB),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "list_shared_with"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_share]: listed shared notes successfully",
+		logging.NewField("user_id", userID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func (r *NoteShareRepository) UpdateRole(
+	ctx context.Context,
+	ownerID int,
+	share entity.NoteShare,
+) (entity.NoteShare, error) {
+	start := time.Now()
+
+	updatedAt := start
+	share.UpdatedAt = &updatedAt
+
+	r.logger.Debug("monitor[note_share]: starting note share db role update",
+		logging.NewField("note_id", share.NoteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("user_id", share.UserID),
+		logging.NewField("role", share.Role),
+	)
+
+	var resp entity.NoteShare
+
+	err := r.db.QueryRow(ctx, sqlUpdateNoteShareRole,
+		share.NoteID, ownerID, share.UserID, share.Role, share.UpdatedAt).
+		Scan(&resp.NoteID, &resp.UserID, &resp.Role, &resp.CreatedAt, &resp.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", share.NoteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("user_id", share.UserID),
+				logging.NewField("operation", "update_role"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteShare{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", share.NoteID),
+				logging.NewField("user_id", share.UserID),
+				logging.NewField("operation", "update_role"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.NoteShare{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrDB),
+			logging.NewField("note_id", share.NoteID),
+			logging.NewField("user_id", share.UserID),
+			logging.NewField("operation", "update_role"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.NoteShare{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_share]: role updated successfully",
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("user_id", resp.UserID),
+		logging.NewField("role", resp.Role),
+	)
+	return resp, nil
+}
+
+func (r *NoteShareRepository) Delete(ctx context.Context, noteID int, ownerID int, userID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[note_share]: starting note share db delete",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("user_id", userID),
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sqlDeleteNoteShare, noteID, ownerID, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: share of note %d", repository.ErrNotFound, noteID)
+		}
+		// To the former reader the note is deleted.
+		return recordUserChanges(ctx, tx, userID, []int{noteID}, entity.ChangeDelete, start)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[note_share]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "delete"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[note_share]: deleted successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("user_id", userID),
+	)
+	return nil
+}
@@ -0,0 +1,540 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlCreateNotebook = `
+		INSERT INTO notebooks (owner_id, parent_id, name, created_at)
+		SELECT $1, $2, $3, $4
+		WHERE $2::int IS NULL
+			OR EXISTS (SELECT 1 FROM notebooks WHERE id = $2 AND owner_id = $1)
+		RETURNING id, owner_id, parent_id, name, created_at, updated_at
+	`
+	sqlGetByIDNotebook = `
+		SELECT id, owner_id, parent_id, name, created_at, updated_at
+		FROM notebooks
+		WHERE id = $1 AND owner_id = $2
+	`
+	sqlTreeNotebooks = `
+		WITH RECURSIVE tree AS (
+			SELECT id, 0 AS depth
+			FROM notebooks
+			WHERE owner_id = $1 AND parent_id IS NULL
+			UNION ALL
+			SELECT nb.id, t.depth + 1
+			FROM notebooks nb
+			JOIN tree t ON nb.parent_id = t.id
+		)
+		SELECT nb.id, nb.owner_id, nb.parent_id, nb.name, nb.created_at, nb.updated_at, t.depth,
+			(SELECT COUNT(*) FROM notes n WHERE n.notebook_id = nb.id AND n.deleted_at IS NULL)
+		FROM tree t
+		JOIN notebooks nb ON nb.id = t.id
+		ORDER BY t.depth, nb.name, nb.id
+	`
+	sqlExistsNotebook = `
+		SELECT EXISTS (SELECT 1 FROM notebooks WHERE id = $1 AND owner_id = $2)
+	`
+	sqlLockNotebooksByOwnerID = `
+		SELECT id
+		FROM notebooks
+		WHERE owner_id = $1
+		FOR UPDATE
+	`
+	sqlIsNotebookAncestor = `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id
+			FROM notebooks
+			WHERE id = $2
+			UNION ALL
+			SELECT nb.id, nb.parent_id
+			FROM notebooks nb
+			JOIN ancestors a ON nb.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)
+	`
+	sqlUpdateNotebookName = `
+		UPDATE notebooks
+		SET name = $3,
+			updated_at = $4
+		WHERE id = $1 AND owner_id = $2
+		RETURNING id, owner_id, parent_id, name, created_at, updated_at
+	`
+	sqlUpdateNotebookParentID = `
+		UPDATE notebooks
+		SET parent_id = $3,
+			updated_at = $4
+		WHERE id = $1 AND owner_id = $2
+	`
+	sqlUpdateNoteNotebookID = `
+		UPDATE notes
+		SET notebook_id = $3,
+			version = version + 1
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL
+			AND ($3::int IS NULL OR EXISTS (SELECT 1 FROM notebooks WHERE id = $3 AND owner_id = $2))
+	`
+	// The foreign key would unfile the notes too, but without a change
+	// their clients get to see.
+	sqlUnfileNotebookNotes = `
+		WITH RECURSIVE subtree AS (
+			SELECT id
+			FROM notebooks
+			WHERE id = $1 AND owner_id = $2
+			UNION ALL
+			SELECT nb.id
+			FROM notebooks nb
+			JOIN subtree s ON nb.parent_id = s.id
+		)
+		UPDATE notes
+		SET notebook_id = NULL,
+			updated_at = $3,
+			version = version + 1
+		WHERE notebook_id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+		RETURNING id
+	`
+	sqlDeleteNotebook = `
+		DELETE FROM notebooks
+		WHERE id = $1 AND owner_id = $2
+	`
+)
+
+type NotebookRepository struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewNotebookRepository(db *pgxpool.Pool, logger logging.Logger) *NotebookRepository {
+	return &NotebookRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create inserts notebook. A parent that doesn't exist or belongs to someone
+// else is reported as repository.ErrNotFound.
+func (r *NotebookRepository) Create(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error) {
+	start := time.Now()
+
+	notebook.CreatedAt = start
+
+	r.logger.Debug("monitor[notebook]: starting notebook db insertion",
+		logging.NewField("owner_id", notebook.OwnerID),
+		logging.NewField("parent_id", notebook.ParentID),
+		logging.NewField("name", notebook.Name),
+		logging.NewField("created_at", notebook.CreatedAt),
+	)
+
+	var resp entity.Notebook
+
+	err := r.db.QueryRow(ctx, sqlCreateNotebook,
+		notebook.OwnerID, notebook.ParentID, notebook.Name, notebook.CreatedAt).
+		Scan(&resp.ID, &resp.OwnerID, &resp.ParentID, &resp.Name, &resp.CreatedAt, &resp.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrNotFound),
+				logging.NewField("owner_id", notebook.OwnerID),
+				logging.NewField("parent_id", notebook.ParentID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Notebook{}, fmt.Errorf("%w: parent notebook: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", notebook.OwnerID),
+				logging.NewField("parent_id", notebook.ParentID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("owner_id", notebook.OwnerID),
+			logging.NewField("parent_id", notebook.ParentID),
+			logging.NewField("operation", "insert"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: inserted successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("name", resp.Name),
+	)
+	return resp, nil
+}
+
+func (r *NotebookRepository) GetByID(ctx context.Context, id int, ownerID int) (entity.Notebook, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[notebook]: starting notebook db get by id",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	var resp entity.Notebook
+
+	err := r.db.QueryRow(ctx, sqlGetByIDNotebook, id, ownerID).
+		Scan(&resp.ID, &resp.OwnerID, &resp.ParentID, &resp.Name, &resp.CreatedAt, &resp.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "get_by_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "get_by_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "get_by_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: got by id successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("name", resp.Name),
+	)
+	return resp, nil
+}
+
+func (r *NotebookRepository) Rename(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error) {
+	start := time.Now()
+
+	notebook.UpdatedAt = &start
+
+	r.logger.Debug("monitor[notebook]: starting notebook db rename",
+		logging.NewField("id", notebook.ID),
+		logging.NewField("owner_id", notebook.OwnerID),
+		logging.NewField("name", notebook.Name),
+	)
+
+	var resp entity.Notebook
+
+	err := r.db.QueryRow(ctx, sqlUpdateNotebookName,
+		notebook.ID, notebook.OwnerID, notebook.Name, notebook.UpdatedAt).
+		Scan(&resp.ID, &resp.OwnerID, &resp.ParentID, &resp.Name, &resp.CreatedAt, &resp.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrNotFound),
+				logging.NewField("id", notebook.ID),
+				logging.NewField("owner_id", notebook.OwnerID),
+				logging.NewField("operation", "rename"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("id", notebook.ID),
+				logging.NewField("owner_id", notebook.OwnerID),
+				logging.NewField("operation", "rename"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("id", notebook.ID),
+			logging.NewField("owner_id", notebook.OwnerID),
+			logging.NewField("operation", "rename"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Notebook{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: renamed successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("name", resp.Name),
+	)
+	return resp, nil
+}
+
+// Move re-parents a notebook together with its whole subtree; a nil parentID
+// makes it a root. Moving a notebook under itself or one of its descendants
+// returns repository.ErrCycle. The owner's notebooks are locked for the
+// duration so concurrent moves can't build a cycle between them.
+func (r *NotebookRepository) Move(ctx context.Context, id int, ownerID int, parentID *int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[notebook]: starting notebook db move",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("parent_id", parentID),
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sqlLockNotebooksByOwnerID, ownerID); err != nil {
+			return err
+		}
+
+		if parentID != nil {
+			var exists bool
+			if err := tx.QueryRow(ctx, sqlExistsNotebook, *parentID, ownerID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("%w: parent notebook %d", repository.ErrNotFound, *parentID)
+			}
+
+			var isAncestor bool
+			if err := tx.QueryRow(ctx, sqlIsNotebookAncestor, id, *parentID).Scan(&isAncestor); err != nil {
+				return err
+			}
+			if isAncestor {
+				return fmt.Errorf("%w: notebook %d is %d or one of its ancestors", repository.ErrCycle, id, *parentID)
+			}
+		}
+
+		tag, err := tx.Exec(ctx, sqlUpdateNotebookParentID, id, ownerID, parentID, start)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: notebook %d", repository.ErrNotFound, id)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrCycle) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", err),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("parent_id", parentID),
+				logging.NewField("operation", "move"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("parent_id", parentID),
+				logging.NewField("operation", "move"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("parent_id", parentID),
+			logging.NewField("operation", "move"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: moved successfully",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("parent_id", parentID),
+	)
+	return nil
+}
+
+// Delete removes a notebook and its subtree. Notes filed in any of them are
+// kept and become unfiled, which is recorded as an update of each.
+func (r *NotebookRepository) Delete(ctx context.Context, id int, ownerID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[notebook]: starting notebook db delete",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	var unfiled []int
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(ctx, sqlUnfileNotebookNotes, id, ownerID, start)
+		noteIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, sqlDeleteNotebook, id, ownerID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: notebook %d", repository.ErrNotFound, id)
+		}
+
+		unfiled = noteIDs
+		return recordChanges(ctx, tx, noteIDs, entity.ChangeUpdate, start)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "delete"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: deleted successfully",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("unfiled_notes", len(unfiled)),
+	)
+	return nil
+}
+
+func (r *NotebookRepository) Tree(ctx context.Context, ownerID int) ([]repository.NotebookTreeItem, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[notebook]: starting notebook db tree",
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlTreeNotebooks, ownerID)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.NotebookTreeItem, error) {
+		var item repository.NotebookTreeItem
+		err := row.Scan(&item.Notebook.ID, &item.Notebook.OwnerID, &item.Notebook.ParentID, &item.Notebook.Name,
+			&item.Notebook.CreatedAt, &item.Notebook.UpdatedAt, &item.Depth, &item.NoteCount)
+		return item, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "tree"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "tree"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: tree loaded successfully",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// MoveNote files a note into notebookID, or unfiles it when notebookID is
+// nil. Both must belong to ownerID.
+func (r *NotebookRepository) MoveNote(ctx context.Context, noteID int, ownerID int, notebookID *int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[notebook]: starting note db move",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("notebook_id", notebookID),
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sqlUpdateNoteNotebookID, noteID, ownerID, notebookID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: note %d or notebook", repository.ErrNotFound, noteID)
+		}
+		return recordChanges(ctx, tx, []int{noteID}, entity.ChangeUpdate, start)
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("notebook_id", notebookID),
+				logging.NewField("operation", "move_note"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "move_note"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[notebook]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "move_note"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[notebook]: note moved successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("notebook_id", notebookID),
+	)
+	return nil
+}
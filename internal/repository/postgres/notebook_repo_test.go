@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"Personal-Notes/internal/entity"
+)
+
+func TestNotebookDeleteRecordsUnfiledNotes(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	repos := NewRepository(db, nil, testLogger{})
+
+	user, err := repos.User.Create(ctx, entity.User{Name: "Ann", Email: "ann@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := repos.Notebook.Create(ctx, entity.Notebook{OwnerID: user.ID, Name: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := repos.Notebook.Create(ctx, entity.Notebook{OwnerID: user.ID, ParentID: &parent.ID, Name: "Plans"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := repos.Note.Create(ctx, entity.Note{OwnerID: user.ID, NotebookID: &child.ID, Title: "Q3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := repos.Change.ListSince(ctx, user.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := before[len(before)-1].Change.Seq
+
+	if err := repos.Notebook.Delete(ctx, parent.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repos.Note.GetByID(ctx, note.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.NotebookID != nil || got.Version != note.Version+1 || got.UpdatedAt == nil {
+		t.Fatalf("note notebook %v version %d updated_at %v, want unfiled at version %d",
+			got.NotebookID, got.Version, got.UpdatedAt, note.Version+1)
+	}
+
+	changes, err := repos.Change.ListSince(ctx, user.ID, cursor, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Change.NoteID != note.ID || changes[0].Change.Kind != entity.ChangeUpdate {
+		t.Fatalf("got changes %+v, want an update of note %d", changes, note.ID)
+	}
+}
@@ -1,5 +1,19 @@
 package postgres
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
 const (
 	sqlCreateRefreshToken = `
 		INSERT INTO refresh_tokens (user_id, token, expires_at, created_at)
@@ -9,12 +23,12 @@ const (
 	sqlGetByIDRefreshToken = `
 		SELECT id, user_id, token, expires_at, created_at, revoked_at, replaced_by_token
 		FROM refresh_tokens
-		WHERE id = $1 
+		WHERE id = $1
 	`
 	sqlGetByHashRefreshToken = `
 		SELECT id, user_id, token, expires_at, created_at, revoked_at, replaced_by_token
 		FROM refresh_tokens
-		WHERE token = $1 
+		WHERE token = $1
 	`
 	sqlUpdateRefreshTokenRevokedAt = `
 		UPDATE refresh_tokens
@@ -22,6 +36,30 @@ const (
 		WHERE id = $1
 		RETURNING id, revoked_at
 	`
+	sqlUpdateRefreshTokenRevokedAtIfActive = `
+		UPDATE refresh_tokens
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	sqlUpdateRefreshTokenFamilyRevokedAt = `
+		WITH RECURSIVE family AS (
+			SELECT id, replaced_by_token
+			FROM refresh_tokens
+			WHERE id = $1
+			UNION ALL
+			SELECT rt.id, rt.replaced_by_token
+			FROM refresh_tokens rt
+			JOIN family f ON rt.id = f.replaced_by_token
+		)
+		UPDATE refresh_tokens
+		SET revoked_at = $2
+		WHERE id IN (SELECT id FROM family) AND revoked_at IS NULL
+	`
+	sqlUpdateRefreshTokenRevokedAtByUserID = `
+		UPDATE refresh_tokens
+		SET revoked_at = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
 	sqlUpdateRefreshTokenReplacedByToken = `
 		UPDATE refresh_tokens
 		SET replaced_by_token = $2
@@ -35,7 +73,7 @@ const (
 	`
 	sqlDeleteRefreshTokenAllRevoked = `
 		DELETE FROM refresh_tokens
-		WHERE revoked_at IS NOT NULL
+		WHERE revoked_at IS NOT NULL AND revoked_at < $1
 		RETURNING id
 	`
 )
@@ -96,10 +134,94 @@ func (r *RefreshTokenRepository) Create(
 	return resp, nil
 }
 
+func (r *RefreshTokenRepository) GetByID(ctx context.Context, id int) (entity.RefreshToken, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting refresh token db get by id",
+		logging.NewField("id", id),
+	)
+
+	var resp entity.RefreshToken
+
+	err := r.db.QueryRow(ctx, sqlGetByIDRefreshToken, id).
+		Scan(&resp.ID, &resp.UserID, &resp.TokenHash, &resp.ExpiresAt, &resp.CreatedAt, &resp.RevokedAt, &resp.ReplacedByToken)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("operation", "get_by_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "get_by_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "get_by_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: got by id successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("user_id", resp.UserID),
+	)
+	return resp, nil
+}
+
 func (r *RefreshTokenRepository) GetByToken(
 	ctx context.Context,
 	tokenHash string,
 ) (entity.RefreshToken, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting refresh token db get by token")
+
+	var resp entity.RefreshToken
+
+	err := r.db.QueryRow(ctx, sqlGetByHashRefreshToken, tokenHash).
+		Scan(&resp.ID, &resp.UserID, &resp.TokenHash, &resp.ExpiresAt, &resp.CreatedAt, &resp.RevokedAt, &resp.ReplacedByToken)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrNotFound),
+				logging.NewField("operation", "get_by_token"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "get_by_token"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("operation", "get_by_token"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: got by token successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("user_id", resp.UserID),
+	)
+	return resp, nil
 }
 
 func (r *RefreshTokenRepository) RevokeByID(
@@ -107,9 +229,311 @@ func (r *RefreshTokenRepository) RevokeByID(
 	id int,
 	revokedAt time.Time,
 ) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting refresh token db revoke",
+		logging.NewField("id", id),
+		logging.NewField("revoked_at", revokedAt),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlUpdateRefreshTokenRevokedAt, id, revokedAt)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "revoke_by_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "revoke_by_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+	if tag.RowsAffected() == 0 {
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrNotFound),
+			logging.NewField("id", id),
+			logging.NewField("operation", "revoke_by_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+	}
+
+	r.logger.Info("done[refresh_token]: revoked successfully",
+		logging.NewField("id", id),
+	)
+	return nil
+}
+
+func (r *RefreshTokenRepository) UpdateReplacedByToken(
+	ctx context.Context,
+	id int,
+	replacedByToken int,
+) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting refresh token db replaced_by_token update",
+		logging.NewField("id", id),
+		logging.NewField("replaced_by_token", replacedByToken),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlUpdateRefreshTokenReplacedByToken, id, replacedByToken)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "update_replaced_by_token"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "update_replaced_by_token"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+	if tag.RowsAffected() == 0 {
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrNotFound),
+			logging.NewField("id", id),
+			logging.NewField("operation", "update_replaced_by_token"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+	}
+
+	r.logger.Info("done[refresh_token]: replaced_by_token updated successfully",
+		logging.NewField("id", id),
+		logging.NewField("replaced_by_token", replacedByToken),
+	)
+	return nil
 }
 
 func (r *RefreshTokenRepository) CleanupExpired(
 	ctx context.Context,
 ) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting expired refresh tokens db cleanup")
+
+	tag, err := r.db.Exec(ctx, sqlDeleteRefreshTokenAllExpired)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "cleanup_expired"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("operation", "cleanup_expired"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: expired tokens cleaned up successfully",
+		logging.NewField("deleted", tag.RowsAffected()),
+	)
+	return nil
+}
+
+func (r *RefreshTokenRepository) CleanupRevoked(
+	ctx context.Context,
+	revokedBefore time.Time,
+) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting revoked refresh tokens db cleanup",
+		logging.NewField("revoked_before", revokedBefore),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlDeleteRefreshTokenAllRevoked, revokedBefore)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "cleanup_revoked"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("operation", "cleanup_revoked"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: revoked tokens cleaned up successfully",
+		logging.NewField("deleted", tag.RowsAffected()),
+	)
+	return nil
+}
+
+// Rotate revokes the active token oldID and stores next as its replacement in
+// a single transaction. It returns repository.ErrNotFound when oldID does not
+// exist or has already been revoked, so a token can be rotated only once.
+func (r *RefreshTokenRepository) Rotate(
+	ctx context.Context,
+	oldID int,
+	next entity.RefreshToken,
+) (entity.RefreshToken, error) {
+	start := time.Now()
+
+	next.CreatedAt = start
+
+	r.logger.Debug("monitor[refresh_token]: starting refresh token db rotation",
+		logging.NewField("id", oldID),
+		logging.NewField("user_id", next.UserID),
+		logging.NewField("expires_at", next.ExpiresAt),
+	)
+
+	var resp entity.RefreshToken
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sqlUpdateRefreshTokenRevokedAtIfActive, oldID, start)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repository.ErrNotFound
+		}
+
+		err = tx.QueryRow(ctx, sqlCreateRefreshToken,
+			next.UserID, next.TokenHash, next.ExpiresAt, next.CreatedAt).
+			Scan(&resp.ID, &resp.UserID, &resp.TokenHash, &resp.ExpiresAt, &resp.CreatedAt, &resp.RevokedAt, &resp.ReplacedByToken)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, sqlUpdateRefreshTokenReplacedByToken, oldID, resp.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrNotFound),
+				logging.NewField("id", oldID),
+				logging.NewField("operation", "rotate"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return entity.RefreshToken{}, fmt.Errorf("%w: token %d is not active", repository.ErrNotFound, oldID)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("id", oldID),
+				logging.NewField("operation", "rotate"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("id", oldID),
+			logging.NewField("operation", "rotate"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.RefreshToken{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: rotated successfully",
+		logging.NewField("id", oldID),
+		logging.NewField("replaced_by_token", resp.ID),
+		logging.NewField("user_id", resp.UserID),
+	)
+	return resp, nil
+}
+
+// RevokeFamily revokes id and every token that replaced it, following the
+// replaced_by_token chain to its end.
+func (r *RefreshTokenRepository) RevokeFamily(
+	ctx context.Context,
+	id int,
+	revokedAt time.Time,
+) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting refresh token family db revoke",
+		logging.NewField("id", id),
+		logging.NewField("revoked_at", revokedAt),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlUpdateRefreshTokenFamilyRevokedAt, id, revokedAt)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "revoke_family"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "revoke_family"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: family revoked successfully",
+		logging.NewField("id", id),
+		logging.NewField("revoked", tag.RowsAffected()),
+	)
+	return nil
+}
+
+func (r *RefreshTokenRepository) RevokeAllByUserID(
+	ctx context.Context,
+	userID int,
+	revokedAt time.Time,
+) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[refresh_token]: starting user refresh tokens db revoke",
+		logging.NewField("user_id", userID),
+		logging.NewField("revoked_at", revokedAt),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlUpdateRefreshTokenRevokedAtByUserID, userID, revokedAt)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "revoke_all_by_user_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[refresh_token]: %v", repository.ErrDB),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "revoke_all_by_user_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[refresh_token]: user tokens revoked successfully",
+		logging.NewField("user_id", userID),
+		logging.NewField("revoked", tag.RowsAffected()),
+	)
+	return nil
 }
@@ -3,12 +3,31 @@ package postgres
 import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"Personal-Notes/internal/keyring"
 	"Personal-Notes/internal/logging"
 	"Personal-Notes/internal/repository"
 )
 
-func NewRepository(db *pgxpool.Pool, logger logging.Logger) *repository.Repository {
+// NewRepository returns the repositories backed by db. Note bodies are
+// encrypted at rest with keys when it is not nil.
+func NewRepository(db *pgxpool.Pool, keys *keyring.Keyring, logger logging.Logger) *repository.Repository {
+	bodies := NewBodyCipher(db, keys)
+
 	return &repository.Repository{
-		Note: NewNoteRepository(db, logger),
+		Note:           NewNoteRepository(db, bodies, logger),
+		NoteRevision:   NewNoteRevisionRepository(db, bodies, logger),
+		NoteLink:       NewNoteLinkRepository(db, bodies, logger),
+		Graph:          NewGraphRepository(db, logger),
+		NoteShare:      NewNoteShareRepository(db, bodies, logger),
+		ShareLink:      NewShareLinkRepository(db, logger),
+		Attachment:     NewAttachmentRepository(db, logger),
+		Tag:            NewTagRepository(db, logger),
+		Notebook:       NewNotebookRepository(db, logger),
+		User:           NewUserRepository(db, logger),
+		UserKey:        NewUserKeyRepository(db, logger),
+		Change:         NewChangeRepository(db, bodies, logger),
+		NoteDocument:   NewNoteDocumentRepository(db, bodies, logger),
+		BodyEncryption: NewBodyEncryptionRepository(db, bodies, logger),
+		RefreshToken:   NewRefreshTokenRepository(db, logger),
 	}
 }
@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlCreateShareLink = `
+		INSERT INTO share_links (note_id, owner_id, token_hash, password_hash, expires_at, created_at)
+		SELECT $1, $2, $3, $4, $5, $6
+		WHERE EXISTS (SELECT 1 FROM notes WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL)
+		RETURNING id, note_id, owner_id, token_hash, password_hash, expires_at, view_count, created_at, revoked_at
+	`
+	sqlGetShareLinkByTokenHash = `
+		SELECT id, note_id, owner_id, token_hash, password_hash, expires_at, view_count, created_at, revoked_at
+		FROM share_links
+		WHERE token_hash = $1
+	`
+	sqlListShareLinksByNoteID = `
+		SELECT id, note_id, owner_id, token_hash, password_hash, expires_at, view_count, created_at, revoked_at
+		FROM share_links
+		WHERE note_id = $1 AND owner_id = $2
+		ORDER BY created_at DESC, id DESC
+	`
+	sqlIncrementShareLinkViews = `
+		UPDATE share_links
+		SET view_count = view_count + 1
+		WHERE id = $1
+	`
+	sqlRevokeShareLink = `
+		UPDATE share_links
+		SET revoked_at = $4
+		WHERE id = $1 AND note_id = $2 AND owner_id = $3 AND revoked_at IS NULL
+	`
+)
+
+type ShareLinkRepository struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewShareLinkRepository(db *pgxpool.Pool, logger logging.Logger) *ShareLinkRepository {
+	return &ShareLinkRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create stores a share link for a note owned by link.OwnerID.
+func (r *ShareLinkRepository) Create(ctx context.Context, link entity.ShareLink) (entity.ShareLink, error) {
+	start := time.Now()
+
+	link.CreatedAt = start
+
+	r.logger.Debug("monitor[share_link]: starting share link db insertion",
+		logging.NewField("note_id", link.NoteID),
+		logging.NewField("owner_id", link.OwnerID),
+		logging.NewField("expires_at", link.ExpiresAt),
+		logging.NewField("has_password", link.PasswordHash != nil),
+	)
+
+	var resp entity.ShareLink
+
+	err := r.db.QueryRow(ctx, sqlCreateShareLink,
+		link.NoteID, link.OwnerID, link.TokenHash, link.PasswordHash, link.ExpiresAt, link.CreatedAt).
+		Scan(shareLinkDest(&resp)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", link.NoteID),
+				logging.NewField("owner_id", link.OwnerID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.ShareLink{}, fmt.Errorf("%w: note: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", link.NoteID),
+				logging.NewField("owner_id", link.OwnerID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.ShareLink{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrDB),
+			logging.NewField("note_id", link.NoteID),
+			logging.NewField("owner_id", link.OwnerID),
+			logging.NewField("operation", "insert"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.ShareLink{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[share_link]: inserted successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("note_id", resp.NoteID),
+		logging.NewField("owner_id", resp.OwnerID),
+	)
+	return resp, nil
+}
+
+// GetByTokenHash returns a link whether or not it is revoked or expired.
+func (r *ShareLinkRepository) GetByTokenHash(ctx context.Context, tokenHash string) (entity.ShareLink, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[share_link]: starting share link db get by token hash")
+
+	var resp entity.ShareLink
+
+	err := r.db.QueryRow(ctx, sqlGetShareLinkByTokenHash, tokenHash).Scan(shareLinkDest(&resp)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Warn(fmt.Sprintf("fail[share_link]: %v", repository.ErrNotFound),
+				logging.NewField("operation", "get_by_token_hash"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return entity.ShareLink{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrTimeout),
+				logging.NewField("operation", "get_by_token_hash"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.ShareLink{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrDB),
+			logging.NewField("operation", "get_by_token_hash"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.ShareLink{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[share_link]: got by token hash successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("note_id", resp.NoteID),
+	)
+	return resp, nil
+}
+
+// ListByNoteID returns every link of a note owned by ownerID, newest first,
+// including revoked and expired ones.
+func (r *ShareLinkRepository) ListByNoteID(ctx context.Context, noteID int, ownerID int) ([]entity.ShareLink, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[share_link]: starting share link db list by note id",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListShareLinksByNoteID, noteID, ownerID)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.ShareLink, error) {
+		var link entity.ShareLink
+		err := row.Scan(shareLinkDest(&link)...)
+		return link, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list_by_note_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list_by_note_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[share_link]: listed by note id successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func (r *ShareLinkRepository) IncrementViews(ctx context.Context, id int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[share_link]: starting share link db view increment",
+		logging.NewField("id", id),
+	)
+
+	if _, err := r.db.Exec(ctx, sqlIncrementShareLinkViews, id); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "increment_views"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "increment_views"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[share_link]: views incremented successfully",
+		logging.NewField("id", id),
+	)
+	return nil
+}
+
+func (r *ShareLinkRepository) Revoke(ctx context.Context, id int, noteID int, ownerID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[share_link]: starting share link db revoke",
+		logging.NewField("id", id),
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlRevokeShareLink, id, noteID, ownerID, start)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "revoke"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "revoke"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+	if tag.RowsAffected() == 0 {
+		r.logger.Error(fmt.Sprintf("fail[share_link]: %v", repository.ErrNotFound),
+			logging.NewField("id", id),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "revoke"),
+			logging.NewField("duration", time.Since(start)),
+		)
+		return fmt.Errorf("%w: active share link %d", repository.ErrNotFound, id)
+	}
+
+	r.logger.Info("done[share_link]: revoked successfully",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+	return nil
+}
+
+func shareLinkDest(link *entity.ShareLink) []any {
+	return []any{
+		&link.ID, &link.NoteID, &link.OwnerID, &link.TokenHash, &link.PasswordHash,
+		&link.ExpiresAt, &link.ViewCount, &link.CreatedAt, &link.RevokedAt,
+	}
+}
@@ -0,0 +1,536 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlCreateTag = `
+		INSERT INTO tags (owner_id, name, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, owner_id, name, created_at, updated_at
+	`
+	sqlListTags = `
+		SELECT id, owner_id, name, created_at, updated_at
+		FROM tags
+		WHERE owner_id = $1
+		ORDER BY name
+	`
+	sqlListTagsByNoteID = `
+		SELECT t.id, t.owner_id, t.name, t.created_at, t.updated_at
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id
+		WHERE nt.note_id = $1 AND t.owner_id = $2 AND n.deleted_at IS NULL
+		ORDER BY t.name
+	`
+	sqlCountTagsByNotes = `
+		SELECT t.id, t.owner_id, t.name, t.created_at, t.updated_at, COUNT(*)
+		FROM note_tags nt
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id IN (SELECT id FROM notes WHERE %s)
+		GROUP BY t.id
+		ORDER BY COUNT(*) DESC, t.name
+	`
+	sqlCountOwnedTags = `
+		SELECT COUNT(*)
+		FROM tags
+		WHERE id = ANY($1) AND owner_id = $2
+	`
+	sqlLockOwnedNote = `
+		SELECT id
+		FROM notes
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	sqlUpdateTagName = `
+		UPDATE tags
+		SET name = $3,
+			updated_at = $4
+		WHERE id = $1 AND owner_id = $2
+		RETURNING id, owner_id, name, created_at, updated_at
+	`
+	sqlCopyNoteTags = `
+		INSERT INTO note_tags (note_id, tag_id)
+		SELECT note_id, $2
+		FROM note_tags
+		WHERE tag_id = $1
+		ON CONFLICT DO NOTHING
+	`
+	sqlDeleteNoteTagsByNoteID = `
+		DELETE FROM note_tags
+		WHERE note_id = $1
+	`
+	sqlCreateNoteTags = `
+		INSERT INTO note_tags (note_id, tag_id)
+		SELECT $1, unnest($2::int[])
+	`
+	sqlDeleteTag = `
+		DELETE FROM tags
+		WHERE id = $1 AND owner_id = $2
+	`
+)
+
+type TagRepository struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewTagRepository(db *pgxpool.Pool, logger logging.Logger) *TagRepository {
+	return &TagRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *TagRepository) Create(ctx context.Context, tag entity.Tag) (entity.Tag, error) {
+	start := time.Now()
+
+	tag.CreatedAt = start
+
+	r.logger.Debug("monitor[tag]: starting tag db insertion",
+		logging.NewField("owner_id", tag.OwnerID),
+		logging.NewField("name", tag.Name),
+		logging.NewField("created_at", tag.CreatedAt),
+	)
+
+	var resp entity.Tag
+
+	err := r.db.QueryRow(ctx, sqlCreateTag, tag.OwnerID, tag.Name, tag.CreatedAt).
+		Scan(&resp.ID, &resp.OwnerID, &resp.Name, &resp.CreatedAt, &resp.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrAlreadyExist),
+				logging.NewField("owner_id", tag.OwnerID),
+				logging.NewField("name", tag.Name),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrAlreadyExist, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", tag.OwnerID),
+				logging.NewField("name", tag.Name),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("owner_id", tag.OwnerID),
+			logging.NewField("name", tag.Name),
+			logging.NewField("operation", "insert"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: inserted successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("name", resp.Name),
+	)
+	return resp, nil
+}
+
+func (r *TagRepository) List(ctx context.Context, ownerID int) ([]entity.Tag, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[tag]: starting tag db list",
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListTags, ownerID)
+	resp, err := pgx.CollectRows(rows, scanTag)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: listed successfully",
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func (r *TagRepository) Rename(ctx context.Context, tag entity.Tag) (entity.Tag, error) {
+	start := time.Now()
+
+	tag.UpdatedAt = &start
+
+	r.logger.Debug("monitor[tag]: starting tag db rename",
+		logging.NewField("id", tag.ID),
+		logging.NewField("owner_id", tag.OwnerID),
+		logging.NewField("name", tag.Name),
+	)
+
+	var resp entity.Tag
+
+	err := r.db.QueryRow(ctx, sqlUpdateTagName, tag.ID, tag.OwnerID, tag.Name, tag.UpdatedAt).
+		Scan(&resp.ID, &resp.OwnerID, &resp.Name, &resp.CreatedAt, &resp.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrNotFound),
+				logging.NewField("id", tag.ID),
+				logging.NewField("owner_id", tag.OwnerID),
+				logging.NewField("operation", "rename"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if isUniqueViolation(err) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrAlreadyExist),
+				logging.NewField("id", tag.ID),
+				logging.NewField("owner_id", tag.OwnerID),
+				logging.NewField("operation", "rename"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrAlreadyExist, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("id", tag.ID),
+				logging.NewField("owner_id", tag.OwnerID),
+				logging.NewField("operation", "rename"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("id", tag.ID),
+			logging.NewField("owner_id", tag.OwnerID),
+			logging.NewField("operation", "rename"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.Tag{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: renamed successfully",
+		logging.NewField("id", resp.ID),
+		logging.NewField("owner_id", resp.OwnerID),
+		logging.NewField("name", resp.Name),
+	)
+	return resp, nil
+}
+
+// Merge moves every note tagged with sourceID to targetID and deletes the
+// source tag. Both tags must belong to ownerID.
+func (r *TagRepository) Merge(ctx context.Context, sourceID int, targetID int, ownerID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[tag]: starting tag db merge",
+		logging.NewField("source_id", sourceID),
+		logging.NewField("target_id", targetID),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := checkTagsOwned(ctx, tx, []int{sourceID, targetID}, ownerID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, sqlCopyNoteTags, sourceID, targetID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sqlDeleteTag, sourceID, ownerID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrNotFound),
+				logging.NewField("source_id", sourceID),
+				logging.NewField("target_id", targetID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "merge"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("source_id", sourceID),
+				logging.NewField("target_id", targetID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "merge"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("source_id", sourceID),
+			logging.NewField("target_id", targetID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "merge"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: merged successfully",
+		logging.NewField("source_id", sourceID),
+		logging.NewField("target_id", targetID),
+		logging.NewField("owner_id", ownerID),
+	)
+	return nil
+}
+
+func (r *TagRepository) Delete(ctx context.Context, id int, ownerID int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[tag]: starting tag db delete",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	tag, err := r.db.Exec(ctx, sqlDeleteTag, id, ownerID)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "delete"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "delete"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+	if tag.RowsAffected() == 0 {
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrNotFound),
+			logging.NewField("id", id),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "delete"),
+			logging.NewField("duration", time.Since(start)),
+		)
+		return fmt.Errorf("%w: tag %d", repository.ErrNotFound, id)
+	}
+
+	r.logger.Info("done[tag]: deleted successfully",
+		logging.NewField("id", id),
+		logging.NewField("owner_id", ownerID),
+	)
+	return nil
+}
+
+func (r *TagRepository) ListByNoteID(ctx context.Context, noteID int, ownerID int) ([]entity.Tag, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[tag]: starting tag db list by note id",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+	)
+
+	rows, _ := r.db.Query(ctx, sqlListTagsByNoteID, noteID, ownerID)
+	resp, err := pgx.CollectRows(rows, scanTag)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "list_by_note_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "list_by_note_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: listed by note id successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+// SetNoteTags replaces the tags of a note. The note and every tag must belong
+// to ownerID.
+func (r *TagRepository) SetNoteTags(ctx context.Context, noteID int, ownerID int, tagIDs []int) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[tag]: starting note tags db replace",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("tag_ids", tagIDs),
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var id int
+		if err := tx.QueryRow(ctx, sqlLockOwnedNote, noteID, ownerID).Scan(&id); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: note %d", repository.ErrNotFound, noteID)
+			}
+			return err
+		}
+		if err := checkTagsOwned(ctx, tx, tagIDs, ownerID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, sqlDeleteNoteTagsByNoteID, noteID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sqlCreateNoteTags, noteID, tagIDs)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrNotFound),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "set_note_tags"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("note_id", noteID),
+				logging.NewField("owner_id", ownerID),
+				logging.NewField("operation", "set_note_tags"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("note_id", noteID),
+			logging.NewField("owner_id", ownerID),
+			logging.NewField("operation", "set_note_tags"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: note tags replaced successfully",
+		logging.NewField("note_id", noteID),
+		logging.NewField("owner_id", ownerID),
+		logging.NewField("count", len(tagIDs)),
+	)
+	return nil
+}
+
+// CountByNotes counts, per tag, the notes matching the filters of params.
+// Sorting, cursor and limit are ignored.
+func (r *TagRepository) CountByNotes(
+	ctx context.Context,
+	params repository.NoteListParams,
+) ([]repository.TagCount, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[tag]: starting tag db count by notes",
+		logging.NewField("owner_id", params.OwnerID),
+	)
+
+	var args []any
+	where := noteFilterConditions(params, func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	})
+	query := fmt.Sprintf(sqlCountTagsByNotes, strings.Join(where, " AND "))
+
+	rows, _ := r.db.Query(ctx, query, args...)
+	resp, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (repository.TagCount, error) {
+		var tc repository.TagCount
+		err := row.Scan(&tc.Tag.ID, &tc.Tag.OwnerID, &tc.Tag.Name, &tc.Tag.CreatedAt, &tc.Tag.UpdatedAt, &tc.Count)
+		return tc, err
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrTimeout),
+				logging.NewField("owner_id", params.OwnerID),
+				logging.NewField("operation", "count_by_notes"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[tag]: %v", repository.ErrDB),
+			logging.NewField("owner_id", params.OwnerID),
+			logging.NewField("operation", "count_by_notes"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return nil, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[tag]: counted by notes successfully",
+		logging.NewField("owner_id", params.OwnerID),
+		logging.NewField("count", len(resp)),
+	)
+	return resp, nil
+}
+
+func scanTag(row pgx.CollectableRow) (entity.Tag, error) {
+	var tag entity.Tag
+	err := row.Scan(&tag.ID, &tag.OwnerID, &tag.Name, &tag.CreatedAt, &tag.UpdatedAt)
+	return tag, err
+}
+
+// checkTagsOwned returns repository.ErrNotFound unless every tag in tagIDs
+// belongs to ownerID. tagIDs must not contain duplicates.
+func checkTagsOwned(ctx context.Context, tx pgx.Tx, tagIDs []int, ownerID int) error {
+	if len(tagIDs) == 0 {
+		return nil
+	}
+
+	var owned int
+	if err := tx.QueryRow(ctx, sqlCountOwnedTags, tagIDs, ownerID).Scan(&owned); err != nil {
+		return err
+	}
+	if owned != len(tagIDs) {
+		return fmt.Errorf("%w: %d of %d tags", repository.ErrNotFound, len(tagIDs)-owned, len(tagIDs))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	sqlCreateUserKey = `
+		INSERT INTO user_keys (user_id, kdf, kdf_salt, kdf_memory, kdf_iterations, kdf_parallelism,
+			wrapped_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING user_id, kdf, kdf_salt, kdf_memory, kdf_iterations, kdf_parallelism, wrapped_key,
+			created_at, updated_at
+	`
+	sqlGetUserKeyByUserID = `
+		SELECT user_id, kdf, kdf_salt, kdf_memory, kdf_iterations, kdf_parallelism, wrapped_key,
+			created_at, updated_at
+		FROM user_keys
+		WHERE user_id = $1
+	`
+	sqlUpdateUserKey = `
+		UPDATE user_keys
+		SET kdf = $2,
+			kdf_salt = $3,
+			kdf_memory = $4,
+			kdf_iterations = $5,
+			kdf_parallelism = $6,
+			wrapped_key = $7,
+			updated_at = $8
+		WHERE user_id = $1
+		RETURNING user_id, kdf, kdf_salt, kdf_memory, kdf_iterations, kdf_parallelism, wrapped_key,
+			created_at, updated_at
+	`
+)
+
+type UserKeyRepository struct {
+	db     *pgxpool.Pool
+	logger logging.Logger
+}
+
+func NewUserKeyRepository(db *pgxpool.Pool, logger logging.Logger) *UserKeyRepository {
+	return &UserKeyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create stores the first key envelope of a user. A user has at most one,
+// so a second one is reported as repository.ErrAlreadyExist.
+func (r *UserKeyRepository) Create(ctx context.Context, key entity.UserKey) (entity.UserKey, error) {
+	start := time.Now()
+
+	key.CreatedAt = start
+
+	r.logger.Debug("monitor[user_key]: starting user key db insertion",
+		logging.NewField("user_id", key.UserID),
+		logging.NewField("kdf", key.KDF),
+		logging.NewField("created_at", key.CreatedAt),
+	)
+
+	var resp entity.UserKey
+
+	err := r.db.QueryRow(ctx, sqlCreateUserKey,
+		key.UserID, key.KDF, key.KDFSalt, key.KDFMemory, key.KDFIterations, key.KDFParallelism,
+		key.WrappedKey, key.CreatedAt).
+		Scan(userKeyDest(&resp)...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			r.logger.Warn(fmt.Sprintf("fail[user_key]: %v", repository.ErrAlreadyExist),
+				logging.NewField("user_id", key.UserID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrAlreadyExist, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", key.UserID),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrDB),
+			logging.NewField("user_id", key.UserID),
+			logging.NewField("operation", "insert"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[user_key]: inserted successfully",
+		logging.NewField("user_id", resp.UserID),
+	)
+	return resp, nil
+}
+
+func (r *UserKeyRepository) GetByUserID(ctx context.Context, userID int) (entity.UserKey, error) {
+	start := time.Now()
+
+	r.logger.Debug("monitor[user_key]: starting user key db get by user id",
+		logging.NewField("user_id", userID),
+	)
+
+	var resp entity.UserKey
+
+	err := r.db.QueryRow(ctx, sqlGetUserKeyByUserID, userID).Scan(userKeyDest(&resp)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrNotFound),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "get_by_user_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", userID),
+				logging.NewField("operation", "get_by_user_id"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrDB),
+			logging.NewField("user_id", userID),
+			logging.NewField("operation", "get_by_user_id"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[user_key]: got by user id successfully",
+		logging.NewField("user_id", resp.UserID),
+	)
+	return resp, nil
+}
+
+// Update replaces the envelope of a user, as after a passphrase change.
+func (r *UserKeyRepository) Update(ctx context.Context, key entity.UserKey) (entity.UserKey, error) {
+	start := time.Now()
+
+	key.UpdatedAt = &start
+
+	r.logger.Debug("monitor[user_key]: starting user key db update",
+		logging.NewField("user_id", key.UserID),
+		logging.NewField("kdf", key.KDF),
+		logging.NewField("updated_at", key.UpdatedAt),
+	)
+
+	var resp entity.UserKey
+
+	err := r.db.QueryRow(ctx, sqlUpdateUserKey,
+		key.UserID, key.KDF, key.KDFSalt, key.KDFMemory, key.KDFIterations, key.KDFParallelism,
+		key.WrappedKey, key.UpdatedAt).
+		Scan(userKeyDest(&resp)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrNotFound),
+				logging.NewField("user_id", key.UserID),
+				logging.NewField("operation", "update"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrTimeout),
+				logging.NewField("user_id", key.UserID),
+				logging.NewField("operation", "update"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[user_key]: %v", repository.ErrDB),
+			logging.NewField("user_id", key.UserID),
+			logging.NewField("operation", "update"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return entity.UserKey{}, fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[user_key]: updated successfully",
+		logging.NewField("user_id", resp.UserID),
+	)
+	return resp, nil
+}
+
+func userKeyDest(key *entity.UserKey) []any {
+	return []any{
+		&key.UserID, &key.KDF, &key.KDFSalt, &key.KDFMemory, &key.KDFIterations, &key.KDFParallelism,
+		&key.WrappedKey, &key.CreatedAt, &key.UpdatedAt,
+	}
+}
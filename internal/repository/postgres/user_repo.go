@@ -18,15 +18,15 @@ const (
 	sqlCreateUser = `
 		INSERT INTO users (name, email, password, created_at)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, name, email, password, created_at, updated_at, last_login_at
+		RETURNING id, name, email, password, search_language::text, created_at, updated_at, last_login_at
 	`
 	sqlGetByIDUser = `
-		SELECT id, name, email, password, created_at, updated_at, last_login_at
+		SELECT id, name, email, password, search_language::text, created_at, updated_at, last_login_at
 		FROM users
 		WHERE id = $1
 	`
 	sqlGetByEmailUser = `
-		SELECT id, name, email, password, created_at, updated_at, last_login_at
+		SELECT id, name, email, password, search_language::text, created_at, updated_at, last_login_at
 		FROM users
 		WHERE email = $1
 	`
@@ -37,7 +37,7 @@ const (
 			 password = $4,
 			 updated_at = $5
 		WHERE id = $1
-		RETURNING id, name, email, password, created_at, updated_at, last_login_at
+		RETURNING id, name, email, password, search_language::text, created_at, updated_at, last_login_at
 	`
 	sqlUpdateUserLastLoginAt = `
 		UPDATE users
@@ -45,6 +45,17 @@ const (
 			 last_login_at = $3
 		WHERE id = $1
 	`
+	sqlUpdateUserSearchLanguage = `
+		UPDATE users
+		SET search_language = $2::regconfig,
+			 updated_at = $3
+		WHERE id = $1
+	`
+	sqlUpdateNotesSearchLanguageByOwnerID = `
+		UPDATE notes
+		SET search_language = $2::regconfig
+		WHERE owner_id = $1
+	`
 	sqlDeleteUser = `
 		DELETE FROM users
 		WHERE id = $1
@@ -71,7 +82,6 @@ func (r *UserRepository) Create(ctx context.Context, user entity.User) (entity.U
 	r.logger.Debug("monitor[user]: starting user db insertion",
 		logging.NewField("name", user.Name),
 		logging.NewField("email", user.Email),
-		logging.NewField("password", user.Password),
 		logging.NewField("created_at", user.CreatedAt),
 	)
 
@@ -79,8 +89,18 @@ func (r *UserRepository) Create(ctx context.Context, user entity.User) (entity.U
 
 	err := r.db.QueryRow(ctx, sqlCreateUser,
 		user.Name, user.Email, user.Password, user.CreatedAt).
-		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
+		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.SearchLanguage, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
 	if err != nil {
+		if isUniqueViolation(err) {
+			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrAlreadyExist),
+				logging.NewField("name", user.Name),
+				logging.NewField("email", user.Email),
+				logging.NewField("operation", "insert"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.User{}, fmt.Errorf("%w: %w", repository.ErrAlreadyExist, err)
+		}
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrTimeout),
 				logging.NewField("name", user.Name),
@@ -119,7 +139,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (entity.User, erro
 	var resp entity.User
 
 	err := r.db.QueryRow(ctx, sqlGetByIDUser, id).
-		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
+		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.SearchLanguage, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrNotFound),
@@ -165,7 +185,7 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (entity.U
 	var resp entity.User
 
 	err := r.db.QueryRow(ctx, sqlGetByEmailUser, email).
-		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
+		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.SearchLanguage, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrNotFound),
@@ -218,7 +238,7 @@ func (r *UserRepository) Update(ctx context.Context, user entity.User) (entity.U
 	var resp entity.User
 
 	err := r.db.QueryRow(ctx, sqlUpdateUser, user.ID, user.Name, user.Email, user.Password, user.UpdatedAt).
-		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
+		Scan(&resp.ID, &resp.Name, &resp.Email, &resp.Password, &resp.SearchLanguage, &resp.CreatedAt, &resp.UpdatedAt, &resp.LastLoginAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrNotFound),
@@ -229,6 +249,15 @@ func (r *UserRepository) Update(ctx context.Context, user entity.User) (entity.U
 			)
 			return entity.User{}, fmt.Errorf("%w: %w", repository.ErrNotFound, err)
 		}
+		if isUniqueViolation(err) {
+			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrAlreadyExist),
+				logging.NewField("id", user.ID),
+				logging.NewField("operation", "update"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return entity.User{}, fmt.Errorf("%w: %w", repository.ErrAlreadyExist, err)
+		}
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrTimeout),
 				logging.NewField("id", user.ID),
@@ -300,6 +329,62 @@ func (r *UserRepository) UpdateLastLoginAt(ctx context.Context, id int, lastLogi
 	return nil
 }
 
+// UpdateSearchLanguage sets the text search configuration of the user and
+// re-indexes all of their notes with it.
+func (r *UserRepository) UpdateSearchLanguage(ctx context.Context, id int, language string) error {
+	start := time.Now()
+
+	r.logger.Debug("monitor[user]: starting user search_language db update",
+		logging.NewField("id", id),
+		logging.NewField("search_language", language),
+	)
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sqlUpdateUserSearchLanguage, id, language, start)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repository.ErrNotFound
+		}
+
+		_, err = tx.Exec(ctx, sqlUpdateNotesSearchLanguageByOwnerID, id, language)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrNotFound),
+				logging.NewField("id", id),
+				logging.NewField("operation", "update_search_language"),
+				logging.NewField("duration", time.Since(start)),
+			)
+			return fmt.Errorf("%w: user %d", repository.ErrNotFound, id)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrTimeout),
+				logging.NewField("id", id),
+				logging.NewField("operation", "update_search_language"),
+				logging.NewField("duration", time.Since(start)),
+				logging.NewField("error", err),
+			)
+			return fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+		}
+		r.logger.Error(fmt.Sprintf("fail[user]: %v", repository.ErrDB),
+			logging.NewField("id", id),
+			logging.NewField("operation", "update_search_language"),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return fmt.Errorf("%w: %w", repository.ErrDB, err)
+	}
+
+	r.logger.Info("done[user]: search_language updated successfully",
+		logging.NewField("id", id),
+		logging.NewField("search_language", language),
+	)
+	return nil
+}
+
 func (r *UserRepository) Delete(ctx context.Context, id int) error {
 	start := time.Now()
 
@@ -9,9 +9,81 @@ import (
 
 type Note interface {
 	Create(ctx context.Context, note entity.Note) (entity.Note, error)
+	CreateForClient(ctx context.Context, note entity.Note, clientID string) (entity.Note, error)
 	GetByID(ctx context.Context, id int, ownerID int) (entity.Note, error)
-	Update(ctx context.Context, note entity.Note) (entity.Note, error)
+	List(ctx context.Context, params NoteListParams) ([]entity.Note, error)
+	Search(ctx context.Context, params NoteSearchParams) ([]NoteSearchHit, error)
+	Update(ctx context.Context, note entity.Note, rewriteLinks bool) (entity.Note, error)
+	Delete(ctx context.Context, id int, ownerID int, version int) error
+	ListTrash(ctx context.Context, ownerID int) ([]entity.Note, error)
+	Restore(ctx context.Context, id int, ownerID int) (entity.Note, error)
+	PurgePermanently(ctx context.Context, id int, ownerID int) error
+	PurgeTrashed(ctx context.Context, deletedBefore time.Time) error
+	SetState(ctx context.Context, ownerID int, ids []int, change NoteStateChange) ([]entity.Note, error)
+}
+
+type NoteRevision interface {
+	List(ctx context.Context, noteID int, ownerID int) ([]entity.NoteRevision, error)
+	Get(ctx context.Context, noteID int, ownerID int, revision int) (entity.NoteRevision, error)
+	Prune(ctx context.Context, keepLast int, createdBefore *time.Time) error
+}
+
+type NoteLink interface {
+	Backlinks(ctx context.Context, target entity.Note, userID int) ([]entity.Note, error)
+	ListBroken(ctx context.Context, ownerID int) ([]BrokenLink, error)
+}
+
+type Graph interface {
+	Load(ctx context.Context, params GraphParams) (NoteGraph, error)
+}
+
+type NoteShare interface {
+	Create(ctx context.Context, ownerID int, share entity.NoteShare) (entity.NoteShare, error)
+	List(ctx context.Context, noteID int, ownerID int) ([]NoteShareItem, error)
+	ListSharedWith(ctx context.Context, userID int) ([]SharedNote, error)
+	UpdateRole(ctx context.Context, ownerID int, share entity.NoteShare) (entity.NoteShare, error)
+	Delete(ctx context.Context, noteID int, ownerID int, userID int) error
+}
+
+type ShareLink interface {
+	Create(ctx context.Context, link entity.ShareLink) (entity.ShareLink, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (entity.ShareLink, error)
+	ListByNoteID(ctx context.Context, noteID int, ownerID int) ([]entity.ShareLink, error)
+	IncrementViews(ctx context.Context, id int) error
+	Revoke(ctx context.Context, id int, noteID int, ownerID int) error
+}
+
+type Attachment interface {
+	CreatePending(ctx context.Context, userID int, attachment entity.Attachment) (entity.Attachment, error)
+	Complete(ctx context.Context, attachment entity.Attachment, quota int64) (entity.Attachment, error)
+	DeletePending(ctx context.Context, id int) error
+	Get(ctx context.Context, id int, noteID int) (entity.Attachment, error)
+	ListByNoteID(ctx context.Context, noteID int) ([]entity.Attachment, error)
+	Delete(ctx context.Context, id int, noteID int, userID int) error
+	Usage(ctx context.Context, ownerID int) (int64, error)
+	ListOrphaned(ctx context.Context, pendingBefore time.Time, limit int) ([]OrphanedBlob, error)
+	DeleteByIDs(ctx context.Context, ids []int) error
+}
+
+type Tag interface {
+	Create(ctx context.Context, tag entity.Tag) (entity.Tag, error)
+	List(ctx context.Context, ownerID int) ([]entity.Tag, error)
+	Rename(ctx context.Context, tag entity.Tag) (entity.Tag, error)
+	Merge(ctx context.Context, sourceID int, targetID int, ownerID int) error
+	Delete(ctx context.Context, id int, ownerID int) error
+	ListByNoteID(ctx context.Context, noteID int, ownerID int) ([]entity.Tag, error)
+	SetNoteTags(ctx context.Context, noteID int, ownerID int, tagIDs []int) error
+	CountByNotes(ctx context.Context, params NoteListParams) ([]TagCount, error)
+}
+
+type Notebook interface {
+	Create(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error)
+	GetByID(ctx context.Context, id int, ownerID int) (entity.Notebook, error)
+	Rename(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error)
+	Move(ctx context.Context, id int, ownerID int, parentID *int) error
 	Delete(ctx context.Context, id int, ownerID int) error
+	Tree(ctx context.Context, ownerID int) ([]NotebookTreeItem, error)
+	MoveNote(ctx context.Context, noteID int, ownerID int, notebookID *int) error
 }
 
 type User interface {
@@ -20,18 +92,66 @@ type User interface {
 	GetByEmail(ctx context.Context, email string) (entity.User, error)
 	Update(ctx context.Context, user entity.User) (entity.User, error)
 	UpdateLastLoginAt(ctx context.Context, id int, lastLoginAt time.Time) error
+	UpdateSearchLanguage(ctx context.Context, id int, language string) error
 	Delete(ctx context.Context, id int) error
 }
 
+type UserKey interface {
+	Create(ctx context.Context, key entity.UserKey) (entity.UserKey, error)
+	GetByUserID(ctx context.Context, userID int) (entity.UserKey, error)
+	Update(ctx context.Context, key entity.UserKey) (entity.UserKey, error)
+}
+
+// Change lists the change feed of the notes a user owns. Changes are
+// written by the note repositories in the transaction of the change.
+type Change interface {
+	ListSince(ctx context.Context, userID int, after int64, limit int) ([]NoteChange, error)
+	ListAfter(ctx context.Context, userID int, after int64, limit int) ([]entity.Change, error)
+}
+
+// NoteDocument stores the collaborative editing state of note bodies. Save
+// and Materialize write doc only if doc.Generation is still the stored one,
+// zero for a note without a document, otherwise they return ErrConflict.
+type NoteDocument interface {
+	Open(ctx context.Context, noteID int, userID int) (NoteDocumentAccess, error)
+	Save(ctx context.Context, doc entity.NoteDocument) (entity.NoteDocument, error)
+	Materialize(ctx context.Context, doc entity.NoteDocument, body string) (entity.NoteDocument, entity.Note, error)
+}
+
+// BodyEncryption brings note bodies stored before a change of master key up
+// to date. Each method returns the number of rows changed.
+type BodyEncryption interface {
+	RewrapDataKeys(ctx context.Context) (int, error)
+	EncryptBodies(ctx context.Context, limit int) (int, error)
+}
+
 type RefreshToken interface {
 	Create(ctx context.Context, refreshToken entity.RefreshToken) (entity.RefreshToken, error)
+	GetByID(ctx context.Context, id int) (entity.RefreshToken, error)
 	GetByToken(ctx context.Context, tokenHash string) (entity.RefreshToken, error)
 	RevokeByID(ctx context.Context, id int, revokedAt time.Time) error
+	UpdateReplacedByToken(ctx context.Context, id int, replacedByToken int) error
+	Rotate(ctx context.Context, oldID int, next entity.RefreshToken) (entity.RefreshToken, error)
+	RevokeFamily(ctx context.Context, id int, revokedAt time.Time) error
+	RevokeAllByUserID(ctx context.Context, userID int, revokedAt time.Time) error
 	CleanupExpired(ctx context.Context) error
+	CleanupRevoked(ctx context.Context, revokedBefore time.Time) error
 }
 
 type Repository struct {
 	Note
+	NoteRevision
+	NoteLink
+	Graph
+	NoteShare
+	ShareLink
+	Attachment
+	Tag
+	Notebook
 	User
+	UserKey
+	Change
+	NoteDocument
+	BodyEncryption
 	RefreshToken
 }
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	maxAttachmentFileNameLength = 255
+
+	// sniffLength is the number of bytes http.DetectContentType looks at.
+	sniffLength = 512
+
+	attachmentGCBatchSize = 100
+)
+
+// BlobStore keeps the content of attachments. Keys are generated by the
+// service and consist of lowercase letters, digits and slashes.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type AttachmentLimits struct {
+	MaxSize    int64
+	UserQuota  int64
+	PendingTTL time.Duration
+}
+
+type StorageUsage struct {
+	Used  int64
+	Quota int64
+}
+
+type AttachmentService struct {
+	repo   repository.Attachment
+	notes  repository.Note
+	store  BlobStore
+	limits AttachmentLimits
+	logger logging.Logger
+}
+
+func NewAttachmentService(
+	repo repository.Attachment,
+	notes repository.Note,
+	store BlobStore,
+	limits AttachmentLimits,
+	logger logging.Logger,
+) *AttachmentService {
+	return &AttachmentService{
+		repo:   repo,
+		notes:  notes,
+		store:  store,
+		limits: limits,
+		logger: logger,
+	}
+}
+
+// Upload streams r into the blob store as an attachment of a note userID can
+// edit. The content type is sniffed from the content rather than trusted
+// from the client. The upload fails with ErrTooLarge above the maximum file
+// size and with repository.ErrQuota when it doesn't fit into the note owner's
+// quota; nothing is kept in either case.
+func (s *AttachmentService) Upload(
+	ctx context.Context,
+	noteID int,
+	userID int,
+	fileName string,
+	r io.Reader,
+) (entity.Attachment, error) {
+	fileName, err := cleanFileName(fileName)
+	if err != nil {
+		return entity.Attachment{}, err
+	}
+
+	key, err := newBlobKey()
+	if err != nil {
+		return entity.Attachment{}, err
+	}
+
+	attachment, err := s.repo.CreatePending(ctx, userID, entity.Attachment{
+		NoteID:      noteID,
+		BlobKey:     key,
+		FileName:    fileName,
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return entity.Attachment{}, err
+	}
+
+	used, err := s.repo.Usage(ctx, attachment.OwnerID)
+	if err != nil {
+		s.discard(ctx, attachment)
+		return entity.Attachment{}, err
+	}
+	limit, limitErr := s.limits.MaxSize, ErrTooLarge
+	if remaining := s.limits.UserQuota - used; remaining < limit {
+		limit, limitErr = max(remaining, 0), repository.ErrQuota
+	}
+
+	br := bufio.NewReaderSize(r, sniffLength)
+	head, err := br.Peek(sniffLength)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		s.discard(ctx, attachment)
+		return entity.Attachment{}, fmt.Errorf("failed to read upload: %w", err)
+	}
+	attachment.ContentType = detectContentType(head, fileName)
+
+	counter := &countingReader{r: io.LimitReader(br, limit+1), hash: sha256.New()}
+	if err := s.store.Put(ctx, key, counter, attachment.ContentType); err != nil {
+		s.discard(ctx, attachment)
+		return entity.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if counter.n > limit {
+		s.discard(ctx, attachment)
+		return entity.Attachment{}, fmt.Errorf("%w: at most %d bytes can be uploaded", limitErr, limit)
+	}
+
+	sum := hex.EncodeToString(counter.hash.Sum(nil))
+	attachment.Size = counter.n
+	attachment.SHA256 = &sum
+
+	completed, err := s.repo.Complete(ctx, attachment, s.limits.UserQuota)
+	if err != nil {
+		s.discard(ctx, attachment)
+		return entity.Attachment{}, err
+	}
+	return completed, nil
+}
+
+// Open returns an attachment of a note userID can read together with its
+// content, which supports seeking for range requests.
+func (s *AttachmentService) Open(
+	ctx context.Context,
+	id int,
+	noteID int,
+	userID int,
+) (entity.Attachment, io.ReadSeekCloser, error) {
+	if _, err := s.notes.GetByID(ctx, noteID, userID); err != nil {
+		return entity.Attachment{}, nil, err
+	}
+
+	attachment, err := s.repo.Get(ctx, id, noteID)
+	if err != nil {
+		return entity.Attachment{}, nil, err
+	}
+
+	content, err := s.store.Open(ctx, attachment.BlobKey)
+	if err != nil {
+		return entity.Attachment{}, nil, fmt.Errorf("failed to open attachment %d: %w", id, err)
+	}
+	return attachment, content, nil
+}
+
+func (s *AttachmentService) List(ctx context.Context, noteID int, userID int) ([]entity.Attachment, error) {
+	if _, err := s.notes.GetByID(ctx, noteID, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByNoteID(ctx, noteID)
+}
+
+// Delete removes an attachment from a note userID can edit. Its blob is
+// deleted by the next garbage collection.
+func (s *AttachmentService) Delete(ctx context.Context, id int, noteID int, userID int) error {
+	return s.repo.Delete(ctx, id, noteID, userID)
+}
+
+// Usage returns the bytes stored in the user's attachments and their quota.
+func (s *AttachmentService) Usage(ctx context.Context, userID int) (StorageUsage, error) {
+	used, err := s.repo.Usage(ctx, userID)
+	if err != nil {
+		return StorageUsage{}, err
+	}
+	return StorageUsage{Used: used, Quota: s.limits.UserQuota}, nil
+}
+
+// CollectGarbage deletes the blobs of attachments that were deleted, whose
+// note was purged or whose upload was abandoned. Blobs that fail to delete
+// are kept for the next run.
+func (s *AttachmentService) CollectGarbage(ctx context.Context) error {
+	pendingBefore := time.Now().Add(-s.limits.PendingTTL)
+
+	for {
+		orphans, err := s.repo.ListOrphaned(ctx, pendingBefore, attachmentGCBatchSize)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0, len(orphans))
+		for _, orphan := range orphans {
+			if err := s.store.Delete(ctx, orphan.BlobKey); err != nil {
+				s.logger.Error("fail[attachment]: failed to delete orphaned blob",
+					logging.NewField("id", orphan.AttachmentID),
+					logging.NewField("error", err),
+				)
+				continue
+			}
+			ids = append(ids, orphan.AttachmentID)
+		}
+
+		if len(ids) > 0 {
+			if err := s.repo.DeleteByIDs(ctx, ids); err != nil {
+				return err
+			}
+		}
+		if len(orphans) < attachmentGCBatchSize || len(ids) == 0 {
+			return nil
+		}
+	}
+}
+
+// discard removes the blob and row of a failed upload. It runs even if the
+// request was cancelled; whatever it can't remove is left to the garbage
+// collector.
+func (s *AttachmentService) discard(ctx context.Context, attachment entity.Attachment) {
+	ctx = context.WithoutCancel(ctx)
+
+	if err := s.store.Delete(ctx, attachment.BlobKey); err != nil {
+		s.logger.Error("fail[attachment]: failed to delete blob of failed upload",
+			logging.NewField("id", attachment.ID),
+			logging.NewField("error", err),
+		)
+		return
+	}
+	_ = s.repo.DeletePending(ctx, attachment.ID)
+}
+
+// newBlobKey returns a random key spread over two directory levels, such as
+// 3f/a2/3fa2....
+func newBlobKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate blob key: %w", err)
+	}
+	name := hex.EncodeToString(b)
+	return name[0:2] + "/" + name[2:4] + "/" + name, nil
+}
+
+func cleanFileName(fileName string) (string, error) {
+	fileName = strings.TrimSpace(filepath.Base(strings.ReplaceAll(fileName, `\`, "/")))
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return "", fmt.Errorf("%w: file name is required", ErrValidation)
+	}
+	if !utf8.ValidString(fileName) || strings.ContainsFunc(fileName, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return "", fmt.Errorf("%w: file name contains invalid characters", ErrValidation)
+	}
+	if utf8.RuneCountInString(fileName) > maxAttachmentFileNameLength {
+		return "", fmt.Errorf("%w: file name must be at most %d characters", ErrValidation,
+			maxAttachmentFileNameLength)
+	}
+	return fileName, nil
+}
+
+// detectContentType sniffs the type from the first bytes of the content and
+// only falls back to the file extension when sniffing finds nothing.
+func detectContentType(head []byte, fileName string) string {
+	contentType := http.DetectContentType(head)
+	if contentType != "application/octet-stream" {
+		return contentType
+	}
+	if byExtension := mime.TypeByExtension(filepath.Ext(fileName)); byExtension != "" {
+		return byExtension
+	}
+	return contentType
+}
+
+// countingReader counts and hashes what is read through it.
+type countingReader struct {
+	r    io.Reader
+	n    int64
+	hash hash.Hash
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.hash.Write(p[:n])
+	return n, err
+}
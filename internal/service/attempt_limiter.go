@@ -0,0 +1,58 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter allows each key limit attempts per window, counted in fixed
+// windows from a key's first attempt. Keys whose window has passed are
+// forgotten every window.
+type attemptLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*attemptWindow
+	lastSweep time.Time
+}
+
+type attemptWindow struct {
+	start time.Time
+	count int
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string]*attemptWindow),
+	}
+}
+
+// allow counts an attempt for key and reports whether it is within the
+// limit. Refused attempts aren't counted.
+func (l *attemptLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.window {
+		for k, w := range l.attempts {
+			if now.Sub(w.start) >= l.window {
+				delete(l.attempts, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.attempts[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &attemptWindow{start: now}
+		l.attempts[key] = w
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	maxUserNameLength  = 50
+	maxUserEmailLength = 100
+	minPasswordLength  = 8
+	maxPasswordLength  = 128
+)
+
+type AuthService struct {
+	users    User
+	userRepo repository.User
+	tokens   Token
+	logger   logging.Logger
+}
+
+func NewAuthService(users User, userRepo repository.User, tokens Token, logger logging.Logger) *AuthService {
+	return &AuthService{
+		users:    users,
+		userRepo: userRepo,
+		tokens:   tokens,
+		logger:   logger,
+	}
+}
+
+// Register creates a new account. A taken email is reported as
+// repository.ErrAlreadyExist.
+func (s *AuthService) Register(ctx context.Context, user entity.User) (entity.User, error) {
+	user.Name = strings.TrimSpace(user.Name)
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+	if err := validateRegistration(user); err != nil {
+		return entity.User{}, err
+	}
+
+	return s.users.Create(ctx, user)
+}
+
+func (s *AuthService) Login(ctx context.Context, email, password string) (Tokens, error) {
+	user, err := s.users.Authenticate(ctx, strings.ToLower(strings.TrimSpace(email)), password)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if err := s.userRepo.UpdateLastLoginAt(ctx, user.ID, time.Now()); err != nil {
+		return Tokens{}, err
+	}
+
+	return s.tokens.Issue(ctx, user.ID)
+}
+
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	return s.tokens.Refresh(ctx, refreshToken)
+}
+
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	return s.tokens.Revoke(ctx, refreshToken)
+}
+
+func (s *AuthService) LogoutAll(ctx context.Context, userID int) error {
+	return s.tokens.RevokeAll(ctx, userID)
+}
+
+func validateRegistration(user entity.User) error {
+	if user.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrValidation)
+	}
+	if utf8.RuneCountInString(user.Name) > maxUserNameLength {
+		return fmt.Errorf("%w: name must be at most %d characters", ErrValidation, maxUserNameLength)
+	}
+	if len(user.Email) > maxUserEmailLength {
+		return fmt.Errorf("%w: email must be at most %d characters", ErrValidation, maxUserEmailLength)
+	}
+	if addr, err := mail.ParseAddress(user.Email); err != nil || addr.Address != user.Email {
+		return fmt.Errorf("%w: email is invalid", ErrValidation)
+	}
+	if n := utf8.RuneCountInString(user.Password); n < minPasswordLength || n > maxPasswordLength {
+		return fmt.Errorf("%w: password must be between %d and %d characters",
+			ErrValidation, minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
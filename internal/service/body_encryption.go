@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const bodyEncryptionBatchSize = 500
+
+type BodyEncryptionService struct {
+	repo   repository.BodyEncryption
+	logger logging.Logger
+}
+
+func NewBodyEncryptionService(repo repository.BodyEncryption, logger logging.Logger) *BodyEncryptionService {
+	return &BodyEncryptionService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Rotate moves stored bodies to the active master key: data keys wrapped by
+// a retired master key are rewrapped and bodies still stored in plain text
+// are encrypted, in batches until none is left.
+func (s *BodyEncryptionService) Rotate(ctx context.Context) error {
+	if _, err := s.repo.RewrapDataKeys(ctx); err != nil {
+		return err
+	}
+
+	for {
+		n, err := s.repo.EncryptBodies(ctx, bodyEncryptionBatchSize)
+		if err != nil {
+			return err
+		}
+		if n < bodyEncryptionBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,559 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/pkg/crdt"
+)
+
+// maxCollabDocumentSize bounds the characters a collaborative document keeps,
+// deleted ones included.
+const maxCollabDocumentSize = 1 << 20
+
+// maxCollabUpdateEdits bounds the inserts and deletes in an update of a
+// session. Applying one looks through the whole document, with the room held.
+const maxCollabUpdateEdits = 100
+
+// maxMaterializeAttempts bounds how often a document is merged with a body
+// written outside collaborative editing and written again in one flush.
+const maxMaterializeAttempts = 3
+
+// ErrCollabClosed ends a collaboration session the server dropped, as it
+// does with a session that falls behind or when the server shuts down. The
+// client should join again.
+var ErrCollabClosed = errors.New("collaboration session closed")
+
+type CollabSettings struct {
+	// MaterializeInterval is how long at least the text of a document being
+	// edited goes between writes to the note body.
+	MaterializeInterval time.Duration
+	// SessionBuffer is how many events a session can fall behind by before
+	// it is dropped.
+	SessionBuffer int
+}
+
+type CollabEventKind string
+
+const (
+	CollabEventUpdate   CollabEventKind = "update"
+	CollabEventPresence CollabEventKind = "presence"
+	CollabEventLeave    CollabEventKind = "leave"
+)
+
+// CollabCursor is a selection from Anchor to Head, collapsed when they are
+// equal. A position is the character it follows, the zero ID for the start
+// of the text, so it stays in place while others edit around it.
+type CollabCursor struct {
+	Anchor crdt.ID
+	Head   crdt.ID
+}
+
+// CollabPresence is a participant in editing a note: the session of peer
+// Peer and where its cursor is, nil until the client tells.
+type CollabPresence struct {
+	Peer    uint32
+	UserID  int
+	Email   string
+	CanEdit bool
+	Cursor  *CollabCursor
+}
+
+// CollabEvent is something that happened to a document after a session
+// joined: Peer updated the document, changed its presence or left. The
+// server's own updates, such as a body written outside collaborative
+// editing, come from crdt.ServerPeer.
+type CollabEvent struct {
+	Kind     CollabEventKind
+	Peer     uint32
+	Update   crdt.Update
+	Presence CollabPresence
+}
+
+// CollabSession is a user taking part in editing a note. State is the
+// document as the session joined in the pkg/crdt encoding and Presence the
+// other participants then; Events yields what happens after. The inserts of
+// the session must have peer Peer.
+type CollabSession struct {
+	NoteID   int
+	Peer     uint32
+	CanEdit  bool
+	State    []byte
+	Presence []CollabPresence
+
+	room   *collabRoom
+	self   CollabPresence
+	events chan CollabEvent
+	// closed is guarded by the room's mutex.
+	closed bool
+}
+
+// Events returns the events of the other participants and the server. The
+// channel is closed when the session is dropped.
+func (s *CollabSession) Events() <-chan CollabEvent {
+	return s.events
+}
+
+// Update applies an edit of the session to the document and relays it to
+// the other participants.
+func (s *CollabSession) Update(u crdt.Update) error {
+	if !s.CanEdit {
+		return fmt.Errorf("%w: can't edit note %d", repository.ErrForbidden, s.NoteID)
+	}
+	if len(u.Inserts)+len(u.Deletes) > maxCollabUpdateEdits {
+		return fmt.Errorf("%w: an update must have at most %d inserts and deletes", ErrValidation, maxCollabUpdateEdits)
+	}
+	for i, ins := range u.Inserts {
+		if ins.ID.Peer != s.Peer {
+			return fmt.Errorf("%w: insert %d must have peer %d", ErrValidation, i, s.Peer)
+		}
+	}
+	if u.IsEmpty() {
+		return nil
+	}
+	return s.room.update(s, u)
+}
+
+// MoveCursor sets where the cursor of the session is, nil for nowhere, and
+// tells the other participants.
+func (s *CollabSession) MoveCursor(cursor *CollabCursor) error {
+	return s.room.moveCursor(s, cursor)
+}
+
+// Close leaves the document.
+func (s *CollabSession) Close() {
+	s.room.mu.Lock()
+	defer s.room.mu.Unlock()
+
+	s.room.leave(s)
+}
+
+// collabRoom holds the document of a note while anyone edits it.
+type collabRoom struct {
+	noteID int
+	buffer int
+	logger logging.Logger
+
+	mu          sync.Mutex
+	doc         *crdt.Doc
+	baseVersion int
+	generation  int64
+	// dirty is set while the document has changes that are not saved.
+	dirty          bool
+	materializedAt time.Time
+	sessions       map[uint32]*CollabSession
+	// closed is set once the room is dropped. A join then opens a new one.
+	closed bool
+}
+
+// join adds a session for self, or reports false if the room is closed.
+func (r *collabRoom) join(self CollabPresence) (*CollabSession, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, false
+	}
+
+	self.Peer = r.doc.NewPeer()
+	session := &CollabSession{
+		NoteID:  r.noteID,
+		Peer:    self.Peer,
+		CanEdit: self.CanEdit,
+		State:   r.doc.Encode(),
+		room:    r,
+		self:    self,
+		events:  make(chan CollabEvent, r.buffer),
+	}
+	for _, peer := range slices.Sorted(maps.Keys(r.sessions)) {
+		session.Presence = append(session.Presence, r.sessions[peer].self)
+	}
+
+	r.sessions[self.Peer] = session
+	r.broadcast(self.Peer, CollabEvent{Kind: CollabEventPresence, Peer: self.Peer, Presence: self})
+	return session, true
+}
+
+func (r *collabRoom) update(s *CollabSession, u crdt.Update) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.closed {
+		return ErrCollabClosed
+	}
+
+	size := r.doc.Size()
+	for _, ins := range u.Inserts {
+		size += utf8.RuneCountInString(ins.Text)
+	}
+	if size > maxCollabDocumentSize {
+		return fmt.Errorf("%w: document must keep at most %d characters", ErrValidation, maxCollabDocumentSize)
+	}
+	if err := r.doc.Apply(u); err != nil {
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+
+	r.dirty = true
+	r.broadcast(s.Peer, CollabEvent{Kind: CollabEventUpdate, Peer: s.Peer, Update: u})
+	return nil
+}
+
+func (r *collabRoom) moveCursor(s *CollabSession, cursor *CollabCursor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.closed {
+		return ErrCollabClosed
+	}
+
+	s.self.Cursor = cursor
+	r.broadcast(s.Peer, CollabEvent{Kind: CollabEventPresence, Peer: s.Peer, Presence: s.self})
+	return nil
+}
+
+// broadcast sends ev to every session but that of peer from. Sessions that
+// have fallen too far behind to take it are dropped. r.mu must be held.
+func (r *collabRoom) broadcast(from uint32, ev CollabEvent) {
+	var lagging []*CollabSession
+	for peer, s := range r.sessions {
+		if peer == from {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			lagging = append(lagging, s)
+		}
+	}
+
+	for _, s := range lagging {
+		r.logger.Warn("fail[collab]: session fell behind, dropping it",
+			logging.NewField("note_id", r.noteID),
+			logging.NewField("peer", s.Peer),
+			logging.NewField("user_id", s.self.UserID),
+		)
+		r.leave(s)
+	}
+}
+
+// dropUser drops the sessions of userID.
+func (r *collabRoom) dropUser(userID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.self.UserID == userID {
+			r.leave(session)
+		}
+	}
+}
+
+// leave drops s and tells the other participants. r.mu must be held.
+func (r *collabRoom) leave(s *CollabSession) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+	delete(r.sessions, s.Peer)
+
+	r.broadcast(s.Peer, CollabEvent{Kind: CollabEventLeave, Peer: s.Peer})
+}
+
+// document returns the room's document to store with state.
+func (r *collabRoom) document(state []byte) entity.NoteDocument {
+	return entity.NoteDocument{
+		NoteID:      r.noteID,
+		State:       state,
+		BaseVersion: r.baseVersion,
+		Generation:  r.generation,
+	}
+}
+
+// CollabService lets the users a note is shared with edit its body at the
+// same time. While a note is being edited its document lives in memory,
+// saved by Flush and written to the note body every materialize interval and
+// when the last participant leaves. Everyone editing a note must be served
+// by the same server: another server writing the document drops the
+// sessions here, which then join again.
+type CollabService struct {
+	docs     repository.NoteDocument
+	users    repository.User
+	settings CollabSettings
+	logger   logging.Logger
+
+	mu     sync.Mutex
+	rooms  map[int]*collabRoom
+	closed bool
+
+	// flushMu lets one flush run at a time.
+	flushMu sync.Mutex
+}
+
+func NewCollabService(
+	docs repository.NoteDocument,
+	users repository.User,
+	settings CollabSettings,
+	logger logging.Logger,
+) *CollabService {
+	return &CollabService{
+		docs:     docs,
+		users:    users,
+		settings: settings,
+		logger:   logger,
+		rooms:    make(map[int]*collabRoom),
+	}
+}
+
+// Join opens a session for userID on a note they own or have been shared.
+// Only the owner and editors can edit; everyone else can follow along. The
+// body of an end-to-end encrypted note can't be edited on the server.
+func (s *CollabService) Join(ctx context.Context, noteID int, userID int) (*CollabSession, error) {
+	access, err := s.docs.Open(ctx, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if access.Note.Encrypted {
+		return nil, fmt.Errorf("%w: end-to-end encrypted notes can't be edited collaboratively", ErrValidation)
+	}
+
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	self := CollabPresence{UserID: user.ID, Email: user.Email, CanEdit: access.CanEdit}
+
+	// A room closed between looking it up and joining it is replaced.
+	for {
+		room, err := s.room(access)
+		if err != nil {
+			return nil, err
+		}
+		if session, ok := room.join(self); ok {
+			return session, nil
+		}
+	}
+}
+
+// DropUser drops the sessions of userID on a note, as when what they may do
+// with it changes. The client joins again with the access the user has now.
+func (s *CollabService) DropUser(noteID int, userID int) {
+	s.mu.Lock()
+	room, ok := s.rooms[noteID]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.logger.Info("monitor[collab]: dropping the sessions of a user whose access changed",
+		logging.NewField("note_id", noteID),
+		logging.NewField("user_id", userID),
+	)
+	room.dropUser(userID)
+}
+
+// room returns the open room of the note of access, opening one from it if
+// there is none.
+func (s *CollabService) room(access repository.NoteDocumentAccess) (*collabRoom, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrCollabClosed
+	}
+	if room, ok := s.rooms[access.Note.ID]; ok {
+		return room, nil
+	}
+
+	room := s.openRoom(access)
+	s.rooms[room.noteID] = room
+	return room, nil
+}
+
+func (s *CollabService) openRoom(access repository.NoteDocumentAccess) *collabRoom {
+	note := access.Note
+	room := &collabRoom{
+		noteID:         note.ID,
+		buffer:         s.settings.SessionBuffer,
+		logger:         s.logger,
+		baseVersion:    note.Version,
+		materializedAt: time.Now(),
+		sessions:       make(map[uint32]*CollabSession),
+	}
+
+	var body string
+	if note.Body != nil {
+		body = *note.Body
+	}
+
+	if access.Document == nil {
+		room.doc = crdt.FromText(body)
+		room.dirty = true
+		return room
+	}
+
+	room.generation = access.Document.Generation
+	doc, err := crdt.Decode(access.Document.State)
+	if err != nil {
+		s.logger.Error("fail[collab]: stored document can't be decoded, starting over from the note body",
+			logging.NewField("note_id", note.ID),
+			logging.NewField("error", err),
+		)
+		room.doc = crdt.FromText(body)
+		room.dirty = true
+		return room
+	}
+	room.doc = doc
+
+	// The body was written outside collaborative editing since the document
+	// was last materialized.
+	if access.Document.BaseVersion != note.Version {
+		room.doc.Merge(body)
+		room.dirty = true
+	}
+	return room
+}
+
+// Flush saves the documents with unsaved changes, and writes the text of
+// those changed for longer than the materialize interval or that everyone
+// has left to their note bodies. Documents nobody edits any more are closed.
+func (s *CollabService) Flush(ctx context.Context) error {
+	return s.flush(ctx, false)
+}
+
+// Close writes every document to its note body and drops all sessions. Join
+// fails with ErrCollabClosed from then on.
+func (s *CollabService) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	return s.flush(ctx, true)
+}
+
+func (s *CollabService) flush(ctx context.Context, final bool) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	rooms := slices.Collect(maps.Values(s.rooms))
+	s.mu.Unlock()
+
+	var errs []error
+	for _, room := range rooms {
+		if err := s.flushRoom(ctx, room, final); err != nil {
+			errs = append(errs, fmt.Errorf("note %d: %w", room.noteID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flushRoom writes room, holding it for the duration so that what is written
+// is the document as it is.
+func (s *CollabService) flushRoom(ctx context.Context, room *collabRoom, final bool) error {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if room.closed {
+		return nil
+	}
+
+	err := s.writeRoom(ctx, room, final)
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrConflict) {
+		// The note is gone, or another server has written the document.
+		s.logger.Warn("fail[collab]: document can't be written any more, dropping its sessions",
+			logging.NewField("note_id", room.noteID),
+			logging.NewField("sessions", len(room.sessions)),
+			logging.NewField("error", err),
+		)
+		s.closeRoom(room)
+		return nil
+	}
+	if final || (err == nil && len(room.sessions) == 0) {
+		s.closeRoom(room)
+	}
+	return err
+}
+
+func (s *CollabService) writeRoom(ctx context.Context, room *collabRoom, final bool) error {
+	due := final || len(room.sessions) == 0 || time.Since(room.materializedAt) >= s.settings.MaterializeInterval
+	if due && room.doc.Changed() {
+		if err := s.materialize(ctx, room); err != nil {
+			return err
+		}
+	}
+
+	if !room.dirty {
+		return nil
+	}
+	doc, err := s.docs.Save(ctx, room.document(room.doc.Encode()))
+	if err != nil {
+		return err
+	}
+	room.generation = doc.Generation
+	room.dirty = false
+	return nil
+}
+
+// materialize writes the text of room to its note body. A body written
+// outside collaborative editing in the meantime is merged into the document
+// first, and the participants get the merge as an update of the server.
+func (s *CollabService) materialize(ctx context.Context, room *collabRoom) error {
+	for attempt := 1; ; attempt++ {
+		marked := room.doc.Clone()
+		marked.Mark()
+
+		doc, note, err := s.docs.Materialize(ctx, room.document(marked.Encode()), marked.Text())
+		if errors.Is(err, repository.ErrConflict) && note.ID != 0 {
+			var body string
+			if note.Body != nil {
+				body = *note.Body
+			}
+			u := room.doc.Merge(body)
+			room.baseVersion = note.Version
+			room.dirty = true
+			if !u.IsEmpty() {
+				room.broadcast(crdt.ServerPeer, CollabEvent{Kind: CollabEventUpdate, Peer: crdt.ServerPeer, Update: u})
+			}
+			if room.doc.Changed() && attempt < maxMaterializeAttempts {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		room.doc.Mark()
+		room.baseVersion = doc.BaseVersion
+		room.generation = doc.Generation
+		room.dirty = false
+		room.materializedAt = time.Now()
+		return nil
+	}
+}
+
+// closeRoom drops the sessions of room and forgets it. room.mu must be held.
+func (s *CollabService) closeRoom(room *collabRoom) {
+	for _, session := range room.sessions {
+		session.closed = true
+		close(session.events)
+	}
+	room.sessions = nil
+	room.closed = true
+
+	s.mu.Lock()
+	if s.rooms[room.noteID] == room {
+		delete(s.rooms, room.noteID)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	unifiedDiffContext = 3
+
+	// maxDiffTokens bounds the lines or words of a text to diff. A word diff
+	// of longer texts falls back to whole lines.
+	maxDiffTokens = 50000
+
+	// maxDiffTimeout bounds the time spent looking for a minimal diff. When
+	// it runs out the diff found so far is used, which is correct but may
+	// be longer than needed.
+	maxDiffTimeout = 2 * time.Second
+)
+
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+// DiffSegment is a run of text that is unchanged, inserted or deleted.
+type DiffSegment struct {
+	Op   DiffOp
+	Text string
+}
+
+// diffTokens diffs two token sequences. Each distinct token is mapped to a
+// single rune so the character based diff works on whole lines or words. The
+// search for a minimal diff stops at the deadline of ctx or after
+// maxDiffTimeout.
+func diffTokens(ctx context.Context, a, b []string) ([]DiffSegment, error) {
+	if len(a) > maxDiffTokens || len(b) > maxDiffTokens {
+		return nil, fmt.Errorf("%w: texts of more than %d lines are too large to diff", ErrValidation, maxDiffTokens)
+	}
+
+	index := make(map[string]rune)
+	var tokens []string
+	encode := func(seq []string) ([]rune, error) {
+		runes := make([]rune, len(seq))
+		for i, token := range seq {
+			r, ok := index[token]
+			if !ok {
+				var err error
+				if r, err = tokenRune(len(tokens)); err != nil {
+					return nil, err
+				}
+				index[token] = r
+				tokens = append(tokens, token)
+			}
+			runes[i] = r
+		}
+		return runes, nil
+	}
+
+	ra, err := encode(a)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := encode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	decode := make(map[rune]string, len(tokens))
+	for token, r := range index {
+		decode[r] = token
+	}
+
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = maxDiffTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		dmp.DiffTimeout = min(dmp.DiffTimeout, time.Until(deadline))
+	}
+	if dmp.DiffTimeout <= 0 {
+		return nil, fmt.Errorf("%w: no time left to diff", repository.ErrTimeout)
+	}
+	diffs := dmp.DiffMainRunes(ra, rb, false)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", repository.ErrTimeout, err)
+	}
+
+	var segments []DiffSegment
+	for _, d := range diffs {
+		op := DiffEqual
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = DiffInsert
+		case diffmatchpatch.DiffDelete:
+			op = DiffDelete
+		}
+		for _, r := range d.Text {
+			segments = append(segments, DiffSegment{Op: op, Text: decode[r]})
+		}
+	}
+	return segments, nil
+}
+
+// tokenRune returns the rune standing for the i-th distinct token. Surrogate
+// code points are skipped because they do not survive the diff's strings.
+func tokenRune(i int) (rune, error) {
+	r := rune(i + 1)
+	if r >= 0xD800 {
+		r += 0x800
+	}
+	if r > unicode.MaxRune {
+		return 0, fmt.Errorf("%w: texts are too large to diff", ErrValidation)
+	}
+	return r, nil
+}
+
+// splitLines splits s into lines that keep their trailing newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// splitWords splits s into alternating runs of whitespace and non-whitespace.
+func splitWords(s string) []string {
+	var words []string
+	start, inSpace := 0, false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > start && space != inSpace {
+			words = append(words, s[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// wordDiff returns the word level difference between a and b with adjacent
+// segments of the same kind merged. Texts of more than maxDiffTokens words
+// are compared line by line.
+func wordDiff(ctx context.Context, a, b string) ([]DiffSegment, error) {
+	tokensA, tokensB := splitWords(a), splitWords(b)
+	if len(tokensA) > maxDiffTokens || len(tokensB) > maxDiffTokens {
+		tokensA, tokensB = splitLines(a), splitLines(b)
+	}
+	segments, err := diffTokens(ctx, tokensA, tokensB)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make([]DiffSegment, 0, len(segments))
+	for _, seg := range segments {
+		if n := len(merged); n > 0 && merged[n-1].Op == seg.Op {
+			merged[n-1].Text += seg.Text
+			continue
+		}
+		merged = append(merged, seg)
+	}
+	return merged, nil
+}
+
+// unifiedDiff returns the line level difference between a and b in unified
+// format, or an empty string when they are equal.
+func unifiedDiff(ctx context.Context, fromName, toName, a, b string) (string, error) {
+	lines, err := diffTokens(ctx, splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+
+	// oldPos and newPos hold the number of old and new lines before each line.
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if line.Op != DiffInsert {
+			oldPos[i+1]++
+		}
+		if line.Op != DiffDelete {
+			newPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].Op == DiffEqual {
+			i++
+			continue
+		}
+
+		start := max(0, i-unifiedDiffContext)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Op != DiffEqual {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*unifiedDiffContext {
+				break
+			}
+		}
+		end = min(len(lines), end+unifiedDiffContext)
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[start], oldPos[end]-oldPos[start]),
+			hunkRange(newPos[start], newPos[end]-newPos[start]))
+		for _, line := range lines[start:end] {
+			switch line.Op {
+			case DiffInsert:
+				sb.WriteByte('+')
+			case DiffDelete:
+				sb.WriteByte('-')
+			default:
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(line.Text)
+			if !strings.HasSuffix(line.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+	return sb.String(), nil
+}
+
+// hunkRange formats the start and length of a hunk side. Lines are counted
+// from 1, and an empty side is positioned after the line it follows.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,13 @@
+package service
+
+import "errors"
+
+var (
+	ErrValidation          = errors.New("validation error")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrShareLinkPassword   = errors.New("share link password is missing or wrong")
+	ErrTooLarge            = errors.New("file is too large")
+	ErrTooManyAttempts     = errors.New("too many attempts, try again later")
+)
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	defaultGraphDepth = 1
+	maxGraphDepth     = 5
+)
+
+type GraphService struct {
+	repo      repository.Graph
+	notebooks repository.Notebook
+	logger    logging.Logger
+}
+
+func NewGraphService(repo repository.Graph, notebooks repository.Notebook, logger logging.Logger) *GraphService {
+	return &GraphService{
+		repo:      repo,
+		notebooks: notebooks,
+		logger:    logger,
+	}
+}
+
+// Build returns the owner's notes as a graph of notes and tags connected by
+// wiki links and taggings. With focusNoteID set the graph is limited to the
+// notes at most depth steps away from that note, where a step follows a link
+// in either direction or goes to a note sharing a tag.
+func (s *GraphService) Build(
+	ctx context.Context,
+	params repository.GraphParams,
+	focusNoteID *int,
+	depth int,
+) (repository.NoteGraph, error) {
+	switch {
+	case focusNoteID == nil && depth != 0:
+		return repository.NoteGraph{}, fmt.Errorf("%w: depth requires a focal note", ErrValidation)
+	case depth == 0:
+		depth = defaultGraphDepth
+	case depth < 0 || depth > maxGraphDepth:
+		return repository.NoteGraph{}, fmt.Errorf("%w: depth must be between 1 and %d", ErrValidation, maxGraphDepth)
+	}
+
+	params.TagIDs = uniqueIDs(params.TagIDs)
+
+	if params.NotebookID != nil {
+		if _, err := s.notebooks.GetByID(ctx, *params.NotebookID, params.OwnerID); err != nil {
+			return repository.NoteGraph{}, err
+		}
+	}
+
+	graph, err := s.repo.Load(ctx, params)
+	if err != nil {
+		return repository.NoteGraph{}, err
+	}
+	if focusNoteID == nil {
+		return graph, nil
+	}
+	return neighbourhood(graph, *focusNoteID, depth)
+}
+
+// neighbourhood returns the part of graph within depth steps of the focal
+// note. Every tag is expanded at most once, so the walk stays linear in the
+// size of the graph.
+func neighbourhood(graph repository.NoteGraph, focusNoteID int, depth int) (repository.NoteGraph, error) {
+	neighbours := make(map[int][]int)
+	for _, link := range graph.Links {
+		neighbours[link.SourceID] = append(neighbours[link.SourceID], link.TargetID)
+		neighbours[link.TargetID] = append(neighbours[link.TargetID], link.SourceID)
+	}
+	noteTags := make(map[int][]int)
+	tagNotes := make(map[int][]int)
+	for _, t := range graph.Taggings {
+		noteTags[t.NoteID] = append(noteTags[t.NoteID], t.TagID)
+		tagNotes[t.TagID] = append(tagNotes[t.TagID], t.NoteID)
+	}
+
+	found := false
+	for _, note := range graph.Notes {
+		if note.ID == focusNoteID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return repository.NoteGraph{}, fmt.Errorf("%w: note %d is not in the graph", repository.ErrNotFound, focusNoteID)
+	}
+
+	reached := map[int]bool{focusNoteID: true}
+	expandedTags := make(map[int]bool)
+	frontier := []int{focusNoteID}
+	for step := 0; step < depth && len(frontier) > 0; step++ {
+		var next []int
+		visit := func(id int) {
+			if !reached[id] {
+				reached[id] = true
+				next = append(next, id)
+			}
+		}
+		for _, id := range frontier {
+			for _, neighbour := range neighbours[id] {
+				visit(neighbour)
+			}
+			for _, tagID := range noteTags[id] {
+				if expandedTags[tagID] {
+					continue
+				}
+				expandedTags[tagID] = true
+				for _, tagged := range tagNotes[tagID] {
+					visit(tagged)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	resp := repository.NoteGraph{}
+	for _, note := range graph.Notes {
+		if reached[note.ID] {
+			resp.Notes = append(resp.Notes, note)
+		}
+	}
+	for _, link := range graph.Links {
+		if reached[link.SourceID] && reached[link.TargetID] {
+			resp.Links = append(resp.Links, link)
+		}
+	}
+	usedTags := make(map[int]bool)
+	for _, t := range graph.Taggings {
+		if reached[t.NoteID] {
+			resp.Taggings = append(resp.Taggings, t)
+			usedTags[t.TagID] = true
+		}
+	}
+	for _, tag := range graph.Tags {
+		if usedTags[tag.ID] {
+			resp.Tags = append(resp.Tags, tag)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/internal/wikilink"
+	"Personal-Notes/pkg/e2ee"
+)
+
+const (
+	maxNoteTitleLength = 255
+
+	defaultNoteListLimit = 20
+	maxNoteListLimit     = 100
+
+	defaultNoteSearchLimit = 20
+	maxNoteSearchLimit     = 100
+
+	maxNoteBulkSize = 500
+
+	// maxClientIDLength bounds the id a client gives a create it syncs.
+	maxClientIDLength = 64
+)
+
+var maxEncryptedTitleLength = e2ee.CiphertextLen(utf8.UTFMax * maxNoteTitleLength)
+
+type NotePage struct {
+	Notes      []entity.Note
+	NextCursor *repository.NoteCursor
+	TagCounts  []repository.TagCount
+}
+
+type NoteService struct {
+	repo           repository.Note
+	users          repository.User
+	userKeys       repository.UserKey
+	tags           repository.Tag
+	trashRetention time.Duration
+	renderer       MarkdownRenderer
+	rendered       *renderCache
+	logger         logging.Logger
+}
+
+func NewNoteService(
+	repo repository.Note,
+	users repository.User,
+	userKeys repository.UserKey,
+	tags repository.Tag,
+	trashRetention time.Duration,
+	renderer MarkdownRenderer,
+	renderCacheSize int,
+	logger logging.Logger,
+) *NoteService {
+	return &NoteService{
+		repo:           repo,
+		users:          users,
+		userKeys:       userKeys,
+		tags:           tags,
+		trashRetention: trashRetention,
+		renderer:       renderer,
+		rendered:       newRenderCache(renderCacheSize),
+		logger:         logger,
+	}
+}
+
+// Create stores a new note. An encrypted note needs its wrapped note key and
+// an owner who has set up a user key; whether a note is encrypted is fixed at
+// creation.
+func (s *NoteService) Create(ctx context.Context, note entity.Note) (entity.Note, error) {
+	note, err := s.validateNewNote(ctx, note)
+	if err != nil {
+		return entity.Note{}, err
+	}
+	return s.repo.Create(ctx, note)
+}
+
+// CreateForClient creates note once per clientID, the id a client gave the
+// create: sent again, it returns the note the first one made as it is now,
+// or repository.ErrConflict if that has been deleted since.
+func (s *NoteService) CreateForClient(ctx context.Context, note entity.Note, clientID string) (entity.Note, error) {
+	if clientID == "" || len(clientID) > maxClientIDLength {
+		return entity.Note{}, fmt.Errorf("%w: client_id must be 1 to %d characters", ErrValidation, maxClientIDLength)
+	}
+	note, err := s.validateNewNote(ctx, note)
+	if err != nil {
+		return entity.Note{}, err
+	}
+	return s.repo.CreateForClient(ctx, note, clientID)
+}
+
+// validateNewNote checks note before it is created and returns it as it is
+// to be stored.
+func (s *NoteService) validateNewNote(ctx context.Context, note entity.Note) (entity.Note, error) {
+	if err := validateNote(note); err != nil {
+		return entity.Note{}, err
+	}
+	if !note.Encrypted {
+		note.NoteKey = nil
+		return note, nil
+	}
+
+	if !e2ee.ValidWrappedKey(note.NoteKey) {
+		return entity.Note{}, fmt.Errorf("%w: note_key must be a %d byte wrapped key",
+			ErrValidation, e2ee.WrappedKeySize)
+	}
+	if _, err := s.userKeys.GetByUserID(ctx, note.OwnerID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return entity.Note{}, fmt.Errorf("%w: a user key is required for encrypted notes", ErrValidation)
+		}
+		return entity.Note{}, err
+	}
+	return note, nil
+}
+
+func (s *NoteService) GetByID(ctx context.Context, id int, ownerID int) (entity.Note, error) {
+	return s.repo.GetByID(ctx, id, ownerID)
+}
+
+// List returns a page of notes, the cursor of the next page, which is nil on
+// the last page, and per tag counts over all notes matching the filters.
+func (s *NoteService) List(ctx context.Context, params repository.NoteListParams) (NotePage, error) {
+	switch params.SortBy {
+	case "":
+		params.SortBy = repository.NoteSortCreatedAt
+	case repository.NoteSortCreatedAt, repository.NoteSortUpdatedAt, repository.NoteSortTitle:
+	default:
+		return NotePage{}, fmt.Errorf("%w: unknown sort field %q", ErrValidation, params.SortBy)
+	}
+
+	switch params.Archived {
+	case "":
+		params.Archived = repository.ArchivedExclude
+	case repository.ArchivedExclude, repository.ArchivedOnly, repository.ArchivedInclude:
+	default:
+		return NotePage{}, fmt.Errorf("%w: unknown archived filter %q", ErrValidation, params.Archived)
+	}
+
+	switch {
+	case params.Limit == 0:
+		params.Limit = defaultNoteListLimit
+	case params.Limit < 0 || params.Limit > maxNoteListLimit:
+		return NotePage{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrValidation, maxNoteListLimit)
+	}
+
+	params.AnyTagIDs = uniqueIDs(params.AnyTagIDs)
+	params.AllTagIDs = uniqueIDs(params.AllTagIDs)
+
+	limit := params.Limit
+	params.Limit++
+
+	notes, err := s.repo.List(ctx, params)
+	if err != nil {
+		return NotePage{}, err
+	}
+
+	tagCounts, err := s.tags.CountByNotes(ctx, params)
+	if err != nil {
+		return NotePage{}, err
+	}
+
+	page := NotePage{Notes: notes, TagCounts: tagCounts}
+	if len(notes) > limit {
+		page.Notes = notes[:limit]
+		last := page.Notes[limit-1]
+		page.NextCursor = &repository.NoteCursor{
+			ID:        last.ID,
+			CreatedAt: last.CreatedAt,
+			UpdatedAt: last.UpdatedAt,
+			Title:     last.Title,
+			Pinned:    last.PinnedAt != nil,
+		}
+	}
+	return page, nil
+}
+
+// Search runs query against the owner's notes using the owner's search
+// language. Bodies encrypted at rest aren't indexed, so those notes only
+// match by title. Highlights in the returned hits are safe to render as HTML.
+func (s *NoteService) Search(
+	ctx context.Context,
+	ownerID int,
+	query string,
+	limit int,
+	offset int,
+) ([]repository.NoteSearchHit, error) {
+	terms := parseSearchQuery(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: search query is empty", ErrValidation)
+	}
+
+	switch {
+	case limit == 0:
+		limit = defaultNoteSearchLimit
+	case limit < 0 || limit > maxNoteSearchLimit:
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrValidation, maxNoteSearchLimit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrValidation)
+	}
+
+	owner, err := s.users.GetByID(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := s.repo.Search(ctx, repository.NoteSearchParams{
+		OwnerID:  ownerID,
+		Terms:    terms,
+		Language: owner.SearchLanguage,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		hits[i].TitleHighlight = escapeHeadline(hits[i].TitleHighlight)
+		hits[i].Snippet = escapeHeadline(hits[i].Snippet)
+	}
+	return hits, nil
+}
+
+// Update changes the title and body of a note. When note.Version is not zero
+// the update only applies to that version of the note; on a mismatch the
+// current note is returned with repository.ErrConflict. With rewriteLinks set
+// a rename also rewrites the [[title]] links to the note in the owner's other
+// notes, otherwise those links break. note.Encrypted must match the stored
+// note, which keeps its note key.
+func (s *NoteService) Update(ctx context.Context, note entity.Note, rewriteLinks bool) (entity.Note, error) {
+	if err := validateNote(note); err != nil {
+		return entity.Note{}, err
+	}
+	if rewriteLinks && note.Encrypted {
+		return entity.Note{}, fmt.Errorf("%w: links can't be rewritten to an encrypted note", ErrValidation)
+	}
+	if rewriteLinks && !wikilink.ValidTitle(note.Title) {
+		return entity.Note{}, fmt.Errorf("%w: links can't be rewritten to this title", ErrValidation)
+	}
+	return s.repo.Update(ctx, note, rewriteLinks)
+}
+
+// SetState changes the pinned, archived and starred states of up to
+// maxNoteBulkSize of the owner's notes at once. Either all notes change or,
+// when one of them is missing, none does.
+func (s *NoteService) SetState(
+	ctx context.Context,
+	ownerID int,
+	ids []int,
+	change repository.NoteStateChange,
+) ([]entity.Note, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: ids are required", ErrValidation)
+	}
+	if len(ids) > maxNoteBulkSize {
+		return nil, fmt.Errorf("%w: at most %d notes can be changed at once", ErrValidation, maxNoteBulkSize)
+	}
+	if change.Pinned == nil && change.Archived == nil && change.Starred == nil {
+		return nil, fmt.Errorf("%w: one of pinned, archived or starred is required", ErrValidation)
+	}
+	return s.repo.SetState(ctx, ownerID, ids, change)
+}
+
+// Delete moves a note to the trash. A non-zero version makes the delete
+// conditional on the note not having changed since.
+func (s *NoteService) Delete(ctx context.Context, id int, ownerID int, version int) error {
+	return s.repo.Delete(ctx, id, ownerID, version)
+}
+
+func (s *NoteService) ListTrash(ctx context.Context, ownerID int) ([]entity.Note, error) {
+	return s.repo.ListTrash(ctx, ownerID)
+}
+
+func (s *NoteService) Restore(ctx context.Context, id int, ownerID int) (entity.Note, error) {
+	return s.repo.Restore(ctx, id, ownerID)
+}
+
+func (s *NoteService) Purge(ctx context.Context, id int, ownerID int) error {
+	return s.repo.PurgePermanently(ctx, id, ownerID)
+}
+
+// PurgeTrash permanently deletes notes that have been in the trash for longer
+// than the trash retention period.
+func (s *NoteService) PurgeTrash(ctx context.Context) error {
+	return s.repo.PurgeTrashed(ctx, time.Now().Add(-s.trashRetention))
+}
+
+// validateNote checks the title of a plain note, or that the title and body
+// of an encrypted one are ciphertext. The server can't see the length of an
+// encrypted title, only bound the size of its ciphertext.
+func validateNote(note entity.Note) error {
+	if note.Encrypted {
+		if len(note.Title) > maxEncryptedTitleLength || !e2ee.ValidCiphertext(note.Title) {
+			return fmt.Errorf("%w: title must be ciphertext of at most %d bytes",
+				ErrValidation, utf8.UTFMax*maxNoteTitleLength)
+		}
+		if note.Body != nil && !e2ee.ValidCiphertext(*note.Body) {
+			return fmt.Errorf("%w: body must be ciphertext", ErrValidation)
+		}
+		return nil
+	}
+	if strings.TrimSpace(note.Title) == "" {
+		return fmt.Errorf("%w: title is required", ErrValidation)
+	}
+	if utf8.RuneCountInString(note.Title) > maxNoteTitleLength {
+		return fmt.Errorf("%w: title must be at most %d characters", ErrValidation, maxNoteTitleLength)
+	}
+	return nil
+}
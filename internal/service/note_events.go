@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/realtime"
+	"Personal-Notes/internal/repository"
+)
+
+// maxEventBacklog bounds the changes replayed to a client resuming a stream.
+// A client that missed more should sync instead.
+const maxEventBacklog = 1000
+
+// ErrStreamClosed ends an event stream the server dropped. The client should
+// reconnect with the last event it received.
+var ErrStreamClosed = errors.New("event stream closed")
+
+// EventHub hands out the changes of a user as they are committed.
+type EventHub interface {
+	Subscribe(userID int) *realtime.Subscription
+}
+
+// NoteEventStream yields the changes to the notes a user owns or has been
+// shared: first those after the last event the client saw, then the new ones
+// as they are committed.
+type NoteEventStream struct {
+	// Resync is set when the client missed more changes than are replayed.
+	// It should sync; the stream goes on with the new changes.
+	Resync bool
+
+	sub     *realtime.Subscription
+	backlog []entity.Change
+	last    int64
+}
+
+// Next returns the next change, blocking until there is one, ctx is done or
+// the stream is dropped with ErrStreamClosed.
+func (s *NoteEventStream) Next(ctx context.Context) (entity.Change, error) {
+	if len(s.backlog) > 0 {
+		change := s.backlog[0]
+		s.backlog = s.backlog[1:]
+		s.last = change.Seq
+		return change, nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return entity.Change{}, ctx.Err()
+		case change, ok := <-s.sub.Events():
+			if !ok {
+				return entity.Change{}, ErrStreamClosed
+			}
+			// Changes committed while the backlog was read come twice.
+			if change.Seq <= s.last {
+				continue
+			}
+			s.last = change.Seq
+			return change, nil
+		}
+	}
+}
+
+// Close ends the stream.
+func (s *NoteEventStream) Close() {
+	s.sub.Close()
+}
+
+type NoteEventService struct {
+	hub     EventHub
+	changes repository.Change
+	logger  logging.Logger
+}
+
+func NewNoteEventService(hub EventHub, changes repository.Change, logger logging.Logger) *NoteEventService {
+	return &NoteEventService{
+		hub:     hub,
+		changes: changes,
+		logger:  logger,
+	}
+}
+
+// Subscribe opens a stream of the changes of userID after seq lastEventID.
+// Zero starts with the changes from now on.
+func (s *NoteEventService) Subscribe(ctx context.Context, userID int, lastEventID int64) (*NoteEventStream, error) {
+	if lastEventID < 0 {
+		return nil, fmt.Errorf("%w: last event id must not be negative", ErrValidation)
+	}
+
+	// Subscribing before reading the backlog leaves no gap between the two.
+	stream := &NoteEventStream{sub: s.hub.Subscribe(userID), last: lastEventID}
+	if lastEventID == 0 {
+		return stream, nil
+	}
+
+	backlog, err := s.changes.ListAfter(ctx, userID, lastEventID, maxEventBacklog+1)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	if len(backlog) > maxEventBacklog {
+		stream.Resync = true
+		return stream, nil
+	}
+	stream.backlog = backlog
+	return stream, nil
+}
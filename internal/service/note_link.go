@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type NoteLinkService struct {
+	repo   repository.NoteLink
+	notes  repository.Note
+	logger logging.Logger
+}
+
+func NewNoteLinkService(repo repository.NoteLink, notes repository.Note, logger logging.Logger) *NoteLinkService {
+	return &NoteLinkService{
+		repo:   repo,
+		notes:  notes,
+		logger: logger,
+	}
+}
+
+// Backlinks returns the notes whose body links to the note, limited to the
+// ones userID can read.
+func (s *NoteLinkService) Backlinks(ctx context.Context, noteID int, userID int) ([]entity.Note, error) {
+	target, err := s.notes.GetByID(ctx, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Backlinks(ctx, target, userID)
+}
+
+// ListBroken returns the links in the owner's notes whose target note does not
+// exist or is in the trash.
+func (s *NoteLinkService) ListBroken(ctx context.Context, ownerID int) ([]repository.BrokenLink, error) {
+	return s.repo.ListBroken(ctx, ownerID)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"Personal-Notes/internal/entity"
+)
+
+type MarkdownRenderer interface {
+	Render(source string) (string, error)
+}
+
+// RenderHTML returns the body of note rendered from markdown to sanitized
+// HTML. Rendered bodies are cached per note id and updated_at, so a note is
+// rendered again only after it changes. The body of an encrypted note is
+// ciphertext and can't be rendered.
+func (s *NoteService) RenderHTML(note entity.Note) (string, error) {
+	if note.Encrypted {
+		return "", fmt.Errorf("%w: encrypted notes can't be rendered", ErrValidation)
+	}
+	if note.Body == nil {
+		return "", nil
+	}
+
+	updatedAt := note.CreatedAt
+	if note.UpdatedAt != nil {
+		updatedAt = *note.UpdatedAt
+	}
+
+	if html, ok := s.rendered.get(note.ID, updatedAt); ok {
+		return html, nil
+	}
+
+	html, err := s.renderer.Render(*note.Body)
+	if err != nil {
+		return "", err
+	}
+
+	s.rendered.put(note.ID, updatedAt, html)
+	return html, nil
+}
+
+type renderedNote struct {
+	noteID    int
+	updatedAt time.Time
+	html      string
+}
+
+// renderCache is an LRU cache holding the latest rendering of up to size
+// notes. An entry is only used while the note's updated_at still matches.
+type renderCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[int]*list.Element
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[int]*list.Element),
+	}
+}
+
+func (c *renderCache) get(noteID int, updatedAt time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[noteID]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*renderedNote)
+	if !entry.updatedAt.Equal(updatedAt) {
+		return "", false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.html, true
+}
+
+func (c *renderCache) put(noteID int, updatedAt time.Time, html string) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[noteID]; ok {
+		elem.Value = &renderedNote{noteID: noteID, updatedAt: updatedAt, html: html}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[noteID] = c.order.PushFront(&renderedNote{noteID: noteID, updatedAt: updatedAt, html: html})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*renderedNote).noteID)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type DiffMode string
+
+const (
+	DiffModeUnified DiffMode = "unified"
+	DiffModeWord    DiffMode = "word"
+)
+
+// RevisionDiff is the difference between two revisions of a note. Unified is
+// set in unified mode and Segments in word mode.
+type RevisionDiff struct {
+	From     int
+	To       int
+	Mode     DiffMode
+	Unified  string
+	Segments []DiffSegment
+}
+
+// RevisionRetention limits how many revisions are kept per note. KeepLast
+// keeps that many of the newest revisions and KeepDays drops revisions older
+// than that many days; zero disables a limit.
+type RevisionRetention struct {
+	KeepLast int
+	KeepDays int
+}
+
+type NoteRevisionService struct {
+	repo      repository.NoteRevision
+	notes     repository.Note
+	retention RevisionRetention
+	logger    logging.Logger
+}
+
+func NewNoteRevisionService(
+	repo repository.NoteRevision,
+	notes repository.Note,
+	retention RevisionRetention,
+	logger logging.Logger,
+) *NoteRevisionService {
+	return &NoteRevisionService{
+		repo:      repo,
+		notes:     notes,
+		retention: retention,
+		logger:    logger,
+	}
+}
+
+func (s *NoteRevisionService) List(ctx context.Context, noteID int, ownerID int) ([]entity.NoteRevision, error) {
+	return s.repo.List(ctx, noteID, ownerID)
+}
+
+func (s *NoteRevisionService) Get(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	revision int,
+) (entity.NoteRevision, error) {
+	return s.repo.Get(ctx, noteID, ownerID, revision)
+}
+
+// Diff compares revisions from and to of a note. Both are compared as the
+// title followed by a blank line and the body.
+func (s *NoteRevisionService) Diff(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	from int,
+	to int,
+	mode DiffMode,
+) (RevisionDiff, error) {
+	switch mode {
+	case "":
+		mode = DiffModeUnified
+	case DiffModeUnified, DiffModeWord:
+	default:
+		return RevisionDiff{}, fmt.Errorf("%w: unknown diff mode %q", ErrValidation, mode)
+	}
+
+	fromRevision, err := s.repo.Get(ctx, noteID, ownerID, from)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	toRevision, err := s.repo.Get(ctx, noteID, ownerID, to)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+
+	diff := RevisionDiff{From: from, To: to, Mode: mode}
+	a, b := revisionText(fromRevision), revisionText(toRevision)
+	if mode == DiffModeWord {
+		diff.Segments, err = wordDiff(ctx, a, b)
+	} else {
+		diff.Unified, err = unifiedDiff(ctx, fmt.Sprintf("revision %d", from), fmt.Sprintf("revision %d", to), a, b)
+	}
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	return diff, nil
+}
+
+// Restore makes the content of an old revision the current content of the
+// note, which records it as a new revision. A non-zero version must match the
+// note's current version, as in NoteService.Update.
+func (s *NoteRevisionService) Restore(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	revision int,
+	version int,
+) (entity.Note, error) {
+	old, err := s.repo.Get(ctx, noteID, ownerID, revision)
+	if err != nil {
+		return entity.Note{}, err
+	}
+	current, err := s.notes.GetByID(ctx, noteID, ownerID)
+	if err != nil {
+		return entity.Note{}, err
+	}
+
+	return s.notes.Update(ctx, entity.Note{
+		ID:        noteID,
+		OwnerID:   ownerID,
+		Title:     old.Title,
+		Body:      old.Body,
+		Version:   version,
+		Encrypted: current.Encrypted,
+	}, false)
+}
+
+// Prune deletes the revisions that fall outside the retention limits.
+func (s *NoteRevisionService) Prune(ctx context.Context) error {
+	if s.retention.KeepLast <= 0 && s.retention.KeepDays <= 0 {
+		return nil
+	}
+
+	var createdBefore *time.Time
+	if s.retention.KeepDays > 0 {
+		t := time.Now().AddDate(0, 0, -s.retention.KeepDays)
+		createdBefore = &t
+	}
+	return s.repo.Prune(ctx, max(s.retention.KeepLast, 0), createdBefore)
+}
+
+func revisionText(revision entity.NoteRevision) string {
+	if revision.Body == nil {
+		return revision.Title + "\n"
+	}
+	return revision.Title + "\n\n" + *revision.Body
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type NoteShareService struct {
+	repo   repository.NoteShare
+	users  repository.User
+	collab Collab
+	logger logging.Logger
+}
+
+func NewNoteShareService(
+	repo repository.NoteShare,
+	users repository.User,
+	collab Collab,
+	logger logging.Logger,
+) *NoteShareService {
+	return &NoteShareService{
+		repo:   repo,
+		users:  users,
+		collab: collab,
+		logger: logger,
+	}
+}
+
+// Invite shares a note owned by ownerID with the user registered under email.
+// An unknown email is reported as repository.ErrNotFound, the same as a note
+// the owner doesn't have.
+func (s *NoteShareService) Invite(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	email string,
+	role entity.ShareRole,
+) (repository.NoteShareItem, error) {
+	if err := validateShareRole(role); err != nil {
+		return repository.NoteShareItem{}, err
+	}
+
+	user, err := s.users.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Answered like a missing note, so invites can't be used to
+			// find out which emails are registered.
+			return repository.NoteShareItem{}, fmt.Errorf("%w: note or user", repository.ErrNotFound)
+		}
+		return repository.NoteShareItem{}, err
+	}
+	if user.ID == ownerID {
+		return repository.NoteShareItem{}, fmt.Errorf("%w: a note can't be shared with its owner", ErrValidation)
+	}
+
+	share, err := s.repo.Create(ctx, ownerID, entity.NoteShare{
+		NoteID: noteID,
+		UserID: user.ID,
+		Role:   role,
+	})
+	if err != nil {
+		return repository.NoteShareItem{}, err
+	}
+	return repository.NoteShareItem{Share: share, Email: user.Email}, nil
+}
+
+func (s *NoteShareService) List(ctx context.Context, noteID int, ownerID int) ([]repository.NoteShareItem, error) {
+	return s.repo.List(ctx, noteID, ownerID)
+}
+
+func (s *NoteShareService) ListSharedWith(ctx context.Context, userID int) ([]repository.SharedNote, error) {
+	return s.repo.ListSharedWith(ctx, userID)
+}
+
+func (s *NoteShareService) UpdateRole(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	userID int,
+	role entity.ShareRole,
+) (entity.NoteShare, error) {
+	if err := validateShareRole(role); err != nil {
+		return entity.NoteShare{}, err
+	}
+	share, err := s.repo.UpdateRole(ctx, ownerID, entity.NoteShare{
+		NoteID: noteID,
+		UserID: userID,
+		Role:   role,
+	})
+	if err != nil {
+		return entity.NoteShare{}, err
+	}
+
+	// Whether the user can edit is settled when they join the document.
+	s.collab.DropUser(noteID, userID)
+	return share, nil
+}
+
+func (s *NoteShareService) Revoke(ctx context.Context, noteID int, ownerID int, userID int) error {
+	if err := s.repo.Delete(ctx, noteID, ownerID, userID); err != nil {
+		return err
+	}
+
+	s.collab.DropUser(noteID, userID)
+	return nil
+}
+
+func validateShareRole(role entity.ShareRole) error {
+	switch role {
+	case entity.ShareRoleViewer, entity.ShareRoleCommenter, entity.ShareRoleEditor:
+		return nil
+	default:
+		return fmt.Errorf("%w: role must be viewer, commenter or editor", ErrValidation)
+	}
+}
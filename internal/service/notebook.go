@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const maxNotebookNameLength = 100
+
+type NotebookNode struct {
+	Notebook  entity.Notebook
+	NoteCount int
+	Children  []*NotebookNode
+}
+
+type NotebookService struct {
+	repo   repository.Notebook
+	logger logging.Logger
+}
+
+func NewNotebookService(repo repository.Notebook, logger logging.Logger) *NotebookService {
+	return &NotebookService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *NotebookService) Create(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error) {
+	notebook.Name = strings.TrimSpace(notebook.Name)
+	if err := validateNotebookName(notebook.Name); err != nil {
+		return entity.Notebook{}, err
+	}
+	return s.repo.Create(ctx, notebook)
+}
+
+func (s *NotebookService) GetByID(ctx context.Context, id int, ownerID int) (entity.Notebook, error) {
+	return s.repo.GetByID(ctx, id, ownerID)
+}
+
+func (s *NotebookService) Rename(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error) {
+	notebook.Name = strings.TrimSpace(notebook.Name)
+	if err := validateNotebookName(notebook.Name); err != nil {
+		return entity.Notebook{}, err
+	}
+	return s.repo.Rename(ctx, notebook)
+}
+
+func (s *NotebookService) Move(ctx context.Context, id int, ownerID int, parentID *int) error {
+	if parentID != nil && *parentID == id {
+		return fmt.Errorf("%w: notebook %d into itself", repository.ErrCycle, id)
+	}
+	return s.repo.Move(ctx, id, ownerID, parentID)
+}
+
+func (s *NotebookService) Delete(ctx context.Context, id int, ownerID int) error {
+	return s.repo.Delete(ctx, id, ownerID)
+}
+
+// Tree returns the owner's root notebooks with their descendants nested.
+func (s *NotebookService) Tree(ctx context.Context, ownerID int) ([]*NotebookNode, error) {
+	items, err := s.repo.Tree(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Items arrive parents first, so every parent is indexed before its children.
+	nodes := make(map[int]*NotebookNode, len(items))
+	roots := make([]*NotebookNode, 0)
+	for _, item := range items {
+		node := &NotebookNode{Notebook: item.Notebook, NoteCount: item.NoteCount}
+		nodes[item.Notebook.ID] = node
+
+		if item.Notebook.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := nodes[*item.Notebook.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return roots, nil
+}
+
+func (s *NotebookService) MoveNote(ctx context.Context, noteID int, ownerID int, notebookID *int) error {
+	return s.repo.MoveNote(ctx, noteID, ownerID, notebookID)
+}
+
+func validateNotebookName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: notebook name is required", ErrValidation)
+	}
+	if utf8.RuneCountInString(name) > maxNotebookNameLength {
+		return fmt.Errorf("%w: notebook name must be at most %d characters", ErrValidation, maxNotebookNameLength)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	headlineStartSel = "<mark>"
+	headlineStopSel  = "</mark>"
+)
+
+// searchLanguages are the text search configurations shipped with Postgres.
+var searchLanguages = map[string]bool{
+	"simple": true, "arabic": true, "armenian": true, "basque": true, "catalan": true,
+	"danish": true, "dutch": true, "english": true, "finnish": true, "french": true,
+	"german": true, "greek": true, "hindi": true, "hungarian": true, "indonesian": true,
+	"irish": true, "italian": true, "lithuanian": true, "nepali": true, "norwegian": true,
+	"portuguese": true, "romanian": true, "russian": true, "serbian": true, "spanish": true,
+	"swedish": true, "tamil": true, "turkish": true, "yiddish": true,
+}
+
+// parseSearchQuery splits q into terms: "quoted text" is a phrase, a word
+// ending in * is a prefix and anything else is a plain word.
+func parseSearchQuery(q string) []repository.SearchTerm {
+	var terms []repository.SearchTerm
+
+	for {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			return terms
+		}
+
+		if q[0] == '"' {
+			phrase, rest, _ := strings.Cut(q[1:], `"`)
+			if phrase = strings.TrimSpace(phrase); phrase != "" {
+				terms = append(terms, repository.SearchTerm{Kind: repository.SearchTermPhrase, Text: phrase})
+			}
+			q = rest
+			continue
+		}
+
+		word, rest, _ := strings.Cut(q, " ")
+		q = rest
+
+		if prefix, ok := strings.CutSuffix(word, "*"); ok {
+			// to_tsquery syntax is not escaped, so only letters and digits may reach it.
+			prefix = strings.Map(func(r rune) rune {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					return r
+				}
+				return -1
+			}, prefix)
+			if prefix != "" {
+				terms = append(terms, repository.SearchTerm{Kind: repository.SearchTermPrefix, Text: prefix})
+			}
+			continue
+		}
+
+		terms = append(terms, repository.SearchTerm{Kind: repository.SearchTermWord, Text: word})
+	}
+}
+
+// escapeHeadline HTML-escapes ts_headline output while keeping its <mark>
+// highlights, so snippets can be rendered as HTML safely.
+func escapeHeadline(s string) string {
+	var b strings.Builder
+	for s != "" {
+		before, after, found := strings.Cut(s, headlineStartSel)
+		b.WriteString(html.EscapeString(before))
+		if !found {
+			break
+		}
+
+		marked, rest, _ := strings.Cut(after, headlineStopSel)
+		b.WriteString(headlineStartSel)
+		b.WriteString(html.EscapeString(marked))
+		b.WriteString(headlineStopSel)
+		s = rest
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type Note interface {
+	Create(ctx context.Context, note entity.Note) (entity.Note, error)
+	CreateForClient(ctx context.Context, note entity.Note, clientID string) (entity.Note, error)
+	GetByID(ctx context.Context, id int, ownerID int) (entity.Note, error)
+	List(ctx context.Context, params repository.NoteListParams) (NotePage, error)
+	Search(ctx context.Context, ownerID int, query string, limit int, offset int) ([]repository.NoteSearchHit, error)
+	Update(ctx context.Context, note entity.Note, rewriteLinks bool) (entity.Note, error)
+	Delete(ctx context.Context, id int, ownerID int, version int) error
+	ListTrash(ctx context.Context, ownerID int) ([]entity.Note, error)
+	Restore(ctx context.Context, id int, ownerID int) (entity.Note, error)
+	Purge(ctx context.Context, id int, ownerID int) error
+	PurgeTrash(ctx context.Context) error
+	SetState(ctx context.Context, ownerID int, ids []int, change repository.NoteStateChange) ([]entity.Note, error)
+	RenderHTML(note entity.Note) (string, error)
+}
+
+type Sync interface {
+	Sync(ctx context.Context, userID int, cursor int64, mutations []SyncMutation) (SyncBatch, error)
+}
+
+type NoteEvents interface {
+	Subscribe(ctx context.Context, userID int, lastEventID int64) (*NoteEventStream, error)
+}
+
+type Collab interface {
+	Join(ctx context.Context, noteID int, userID int) (*CollabSession, error)
+	DropUser(noteID int, userID int)
+	Flush(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+type NoteRevision interface {
+	List(ctx context.Context, noteID int, ownerID int) ([]entity.NoteRevision, error)
+	Get(ctx context.Context, noteID int, ownerID int, revision int) (entity.NoteRevision, error)
+	Diff(ctx context.Context, noteID int, ownerID int, from int, to int, mode DiffMode) (RevisionDiff, error)
+	Restore(ctx context.Context, noteID int, ownerID int, revision int, version int) (entity.Note, error)
+	Prune(ctx context.Context) error
+}
+
+type NoteLink interface {
+	Backlinks(ctx context.Context, noteID int, userID int) ([]entity.Note, error)
+	ListBroken(ctx context.Context, ownerID int) ([]repository.BrokenLink, error)
+}
+
+type Graph interface {
+	Build(ctx context.Context, params repository.GraphParams, focusNoteID *int, depth int) (repository.NoteGraph, error)
+}
+
+type NoteShare interface {
+	Invite(ctx context.Context, noteID int, ownerID int, email string, role entity.ShareRole) (repository.NoteShareItem, error)
+	List(ctx context.Context, noteID int, ownerID int) ([]repository.NoteShareItem, error)
+	ListSharedWith(ctx context.Context, userID int) ([]repository.SharedNote, error)
+	UpdateRole(ctx context.Context, noteID int, ownerID int, userID int, role entity.ShareRole) (entity.NoteShare, error)
+	Revoke(ctx context.Context, noteID int, ownerID int, userID int) error
+}
+
+type ShareLink interface {
+	Create(ctx context.Context, noteID int, ownerID int, expiresAt *time.Time, password string) (entity.ShareLink, string, error)
+	List(ctx context.Context, noteID int, ownerID int) ([]entity.ShareLink, error)
+	Revoke(ctx context.Context, id int, noteID int, ownerID int) error
+	Open(ctx context.Context, token string, password string, client string) (entity.Note, error)
+}
+
+type Attachment interface {
+	Upload(ctx context.Context, noteID int, userID int, fileName string, r io.Reader) (entity.Attachment, error)
+	Open(ctx context.Context, id int, noteID int, userID int) (entity.Attachment, io.ReadSeekCloser, error)
+	List(ctx context.Context, noteID int, userID int) ([]entity.Attachment, error)
+	Delete(ctx context.Context, id int, noteID int, userID int) error
+	Usage(ctx context.Context, userID int) (StorageUsage, error)
+	CollectGarbage(ctx context.Context) error
+}
+
+type Tag interface {
+	Create(ctx context.Context, tag entity.Tag) (entity.Tag, error)
+	List(ctx context.Context, ownerID int) ([]entity.Tag, error)
+	Rename(ctx context.Context, tag entity.Tag) (entity.Tag, error)
+	Merge(ctx context.Context, sourceID int, targetID int, ownerID int) error
+	Delete(ctx context.Context, id int, ownerID int) error
+	ListByNoteID(ctx context.Context, noteID int, ownerID int) ([]entity.Tag, error)
+	SetNoteTags(ctx context.Context, noteID int, ownerID int, tagIDs []int) error
+}
+
+type Notebook interface {
+	Create(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error)
+	GetByID(ctx context.Context, id int, ownerID int) (entity.Notebook, error)
+	Rename(ctx context.Context, notebook entity.Notebook) (entity.Notebook, error)
+	Move(ctx context.Context, id int, ownerID int, parentID *int) error
+	Delete(ctx context.Context, id int, ownerID int) error
+	Tree(ctx context.Context, ownerID int) ([]*NotebookNode, error)
+	MoveNote(ctx context.Context, noteID int, ownerID int, notebookID *int) error
+}
+
+type User interface {
+	Create(ctx context.Context, user entity.User) (entity.User, error)
+	GetByID(ctx context.Context, id int) (entity.User, error)
+	UpdateSearchLanguage(ctx context.Context, id int, language string) error
+	Authenticate(ctx context.Context, email, password string) (entity.User, error)
+}
+
+type UserKey interface {
+	Get(ctx context.Context, userID int) (entity.UserKey, error)
+	Create(ctx context.Context, key entity.UserKey) (entity.UserKey, error)
+	Update(ctx context.Context, key entity.UserKey) (entity.UserKey, error)
+}
+
+type BodyEncryption interface {
+	Rotate(ctx context.Context) error
+}
+
+type Token interface {
+	Issue(ctx context.Context, userID int) (Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	RevokeAll(ctx context.Context, userID int) error
+	Cleanup(ctx context.Context) error
+}
+
+type Auth interface {
+	Register(ctx context.Context, user entity.User) (entity.User, error)
+	Login(ctx context.Context, email, password string) (Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context, userID int) error
+}
+
+type Services struct {
+	Note
+	Sync
+	NoteEvents
+	Collab
+	NoteRevision
+	NoteLink
+	Graph
+	NoteShare
+	ShareLink
+	Attachment
+	Tag
+	Notebook
+	User
+	UserKey
+	BodyEncryption
+	Token
+	Auth
+}
+
+type Deps struct {
+	Repos             *repository.Repository
+	PasswordHasher    PasswordHasher
+	TokenManager      TokenManager
+	ShareLinkTokens   ShareLinkTokenManager
+	RefreshTokenTTL   time.Duration
+	RevisionRetention RevisionRetention
+	TrashRetention    time.Duration
+	BlobStore         BlobStore
+	AttachmentLimits  AttachmentLimits
+	Markdown          MarkdownRenderer
+	MarkdownCacheSize int
+	EventHub          EventHub
+	Collab            CollabSettings
+	Logger            logging.Logger
+}
+
+func NewServices(deps Deps) *Services {
+	userService := NewUserService(deps.Repos.User, deps.PasswordHasher, deps.Logger)
+	tokenService := NewTokenService(deps.Repos.RefreshToken, deps.TokenManager, deps.RefreshTokenTTL, deps.Logger)
+	noteService := NewNoteService(deps.Repos.Note, deps.Repos.User, deps.Repos.UserKey, deps.Repos.Tag,
+		deps.TrashRetention, deps.Markdown, deps.MarkdownCacheSize, deps.Logger)
+	shareLinkService := NewShareLinkService(
+		deps.Repos.ShareLink, deps.Repos.Note, deps.ShareLinkTokens, deps.PasswordHasher, deps.Logger)
+	attachmentService := NewAttachmentService(
+		deps.Repos.Attachment, deps.Repos.Note, deps.BlobStore, deps.AttachmentLimits, deps.Logger)
+	collabService := NewCollabService(deps.Repos.NoteDocument, deps.Repos.User, deps.Collab, deps.Logger)
+
+	return &Services{
+		Note:           noteService,
+		Sync:           NewSyncService(noteService, deps.Repos.Change, deps.Logger),
+		NoteEvents:     NewNoteEventService(deps.EventHub, deps.Repos.Change, deps.Logger),
+		Collab:         collabService,
+		NoteRevision:   NewNoteRevisionService(deps.Repos.NoteRevision, deps.Repos.Note, deps.RevisionRetention, deps.Logger),
+		NoteLink:       NewNoteLinkService(deps.Repos.NoteLink, deps.Repos.Note, deps.Logger),
+		Graph:          NewGraphService(deps.Repos.Graph, deps.Repos.Notebook, deps.Logger),
+		NoteShare:      NewNoteShareService(deps.Repos.NoteShare, deps.Repos.User, collabService, deps.Logger),
+		ShareLink:      shareLinkService,
+		Attachment:     attachmentService,
+		Tag:            NewTagService(deps.Repos.Tag, deps.Logger),
+		Notebook:       NewNotebookService(deps.Repos.Notebook, deps.Logger),
+		User:           userService,
+		UserKey:        NewUserKeyService(deps.Repos.UserKey, deps.Logger),
+		BodyEncryption: NewBodyEncryptionService(deps.Repos.BodyEncryption, deps.Logger),
+		Token:          tokenService,
+		Auth:           NewAuthService(userService, deps.Repos.User, tokenService, deps.Logger),
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	maxShareLinkPasswordLength = 128
+
+	// Password attempts on a link, and from a client on any link, are
+	// limited per window, as every attempt costs a password hash and a
+	// wrong one is a guess.
+	shareLinkAttemptsPerLink   = 10
+	shareLinkAttemptsPerClient = 30
+	shareLinkAttemptWindow     = time.Minute
+)
+
+type ShareLinkTokenManager interface {
+	NewShareLinkToken() (string, error)
+	HashShareLinkToken(shareLinkToken string) string
+}
+
+type ShareLinkService struct {
+	repo   repository.ShareLink
+	notes  repository.Note
+	tokens ShareLinkTokenManager
+	hasher PasswordHasher
+	logger logging.Logger
+
+	linkAttempts   *attemptLimiter
+	clientAttempts *attemptLimiter
+}
+
+func NewShareLinkService(
+	repo repository.ShareLink,
+	notes repository.Note,
+	tokens ShareLinkTokenManager,
+	hasher PasswordHasher,
+	logger logging.Logger,
+) *ShareLinkService {
+	return &ShareLinkService{
+		repo:   repo,
+		notes:  notes,
+		tokens: tokens,
+		hasher: hasher,
+		logger: logger,
+
+		linkAttempts:   newAttemptLimiter(shareLinkAttemptsPerLink, shareLinkAttemptWindow),
+		clientAttempts: newAttemptLimiter(shareLinkAttemptsPerClient, shareLinkAttemptWindow),
+	}
+}
+
+// Create publishes a note owned by ownerID and returns the link together with
+// its token, which is not stored and can't be recovered later. An empty
+// password leaves the link unprotected and a nil expiresAt never expires it.
+// Encrypted notes can't be published, as only their owner can read them.
+func (s *ShareLinkService) Create(
+	ctx context.Context,
+	noteID int,
+	ownerID int,
+	expiresAt *time.Time,
+	password string,
+) (entity.ShareLink, string, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return entity.ShareLink{}, "", fmt.Errorf("%w: expires_at must be in the future", ErrValidation)
+	}
+	if len(password) > maxShareLinkPasswordLength {
+		return entity.ShareLink{}, "", fmt.Errorf("%w: password must be at most %d bytes",
+			ErrValidation, maxShareLinkPasswordLength)
+	}
+
+	note, err := s.notes.GetByID(ctx, noteID, ownerID)
+	if err != nil {
+		return entity.ShareLink{}, "", err
+	}
+	if note.Encrypted {
+		return entity.ShareLink{}, "", fmt.Errorf("%w: encrypted notes can't be shared by link", ErrValidation)
+	}
+
+	link := entity.ShareLink{
+		NoteID:    noteID,
+		OwnerID:   ownerID,
+		ExpiresAt: expiresAt,
+	}
+	if password != "" {
+		hash, err := s.hasher.Hash(password)
+		if err != nil {
+			return entity.ShareLink{}, "", err
+		}
+		link.PasswordHash = &hash
+	}
+
+	token, err := s.tokens.NewShareLinkToken()
+	if err != nil {
+		return entity.ShareLink{}, "", err
+	}
+	link.TokenHash = s.tokens.HashShareLinkToken(token)
+
+	link, err = s.repo.Create(ctx, link)
+	if err != nil {
+		return entity.ShareLink{}, "", err
+	}
+	return link, token, nil
+}
+
+func (s *ShareLinkService) List(ctx context.Context, noteID int, ownerID int) ([]entity.ShareLink, error) {
+	return s.repo.ListByNoteID(ctx, noteID, ownerID)
+}
+
+func (s *ShareLinkService) Revoke(ctx context.Context, id int, noteID int, ownerID int) error {
+	return s.repo.Revoke(ctx, id, noteID, ownerID)
+}
+
+// Open resolves a public link token to its note and counts the view. Unknown,
+// revoked and expired links are all reported as repository.ErrNotFound, and a
+// missing or wrong password as ErrShareLinkPassword. Password attempts beyond
+// the limits of the link or of client, the address the request came from,
+// fail with ErrTooManyAttempts without being checked.
+func (s *ShareLinkService) Open(ctx context.Context, token string, password string, client string) (entity.Note, error) {
+	link, err := s.repo.GetByTokenHash(ctx, s.tokens.HashShareLinkToken(token))
+	if err != nil {
+		return entity.Note{}, err
+	}
+	if link.RevokedAt != nil {
+		return entity.Note{}, fmt.Errorf("%w: share link %d is revoked", repository.ErrNotFound, link.ID)
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return entity.Note{}, fmt.Errorf("%w: share link %d has expired", repository.ErrNotFound, link.ID)
+	}
+
+	if link.PasswordHash != nil {
+		if password == "" {
+			return entity.Note{}, ErrShareLinkPassword
+		}
+		now := time.Now()
+		if !s.linkAttempts.allow(strconv.Itoa(link.ID), now) || !s.clientAttempts.allow(client, now) {
+			s.logger.Warn("fail[share_link]: too many password attempts",
+				logging.NewField("id", link.ID),
+				logging.NewField("client", client),
+			)
+			return entity.Note{}, ErrTooManyAttempts
+		}
+		match, _, err := s.hasher.Verify(password, *link.PasswordHash)
+		if err != nil {
+			return entity.Note{}, err
+		}
+		if !match {
+			s.logger.Warn("fail[share_link]: wrong password",
+				logging.NewField("id", link.ID),
+			)
+			return entity.Note{}, ErrShareLinkPassword
+		}
+	}
+
+	note, err := s.notes.GetByID(ctx, link.NoteID, link.OwnerID)
+	if err != nil {
+		return entity.Note{}, err
+	}
+
+	if err := s.repo.IncrementViews(ctx, link.ID); err != nil {
+		return entity.Note{}, err
+	}
+	return note, nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	maxSyncMutations = 100
+	syncPageSize     = 500
+)
+
+type SyncStatus string
+
+const (
+	SyncApplied  SyncStatus = "applied"
+	SyncConflict SyncStatus = "conflict"
+	SyncRejected SyncStatus = "rejected"
+)
+
+// SyncMutation is a change a client made to one of its notes while offline.
+// Kind tells whether Note is created, or updated or deleted at Note.ID.
+// Updates and deletes carry the Note.Version the client last saw and only
+// apply if the note has not changed since. ClientID is echoed back in the
+// result so the client can match it. A create must have one, and applies
+// once per ClientID: sent again, as after a lost response, it returns the
+// note it made.
+type SyncMutation struct {
+	ClientID string
+	Kind     entity.ChangeKind
+	Note     entity.Note
+}
+
+// SyncResult is the outcome of a mutation. Note is the note as written or,
+// on a conflict, as the server has it, which is nil when the note has been
+// deleted. Error says why a mutation was rejected.
+type SyncResult struct {
+	ClientID string
+	Status   SyncStatus
+	Note     *entity.Note
+	Error    string
+}
+
+// SyncBatch answers a sync: the results of the client's mutations and the
+// changes after its cursor, including those the mutations just made. Cursor
+// is where the next sync continues; with HasMore set the client should sync
+// again right away.
+type SyncBatch struct {
+	Results []SyncResult
+	Changes []repository.NoteChange
+	Cursor  int64
+	HasMore bool
+}
+
+type SyncService struct {
+	notes   Note
+	changes repository.Change
+	logger  logging.Logger
+}
+
+func NewSyncService(notes Note, changes repository.Change, logger logging.Logger) *SyncService {
+	return &SyncService{
+		notes:   notes,
+		changes: changes,
+		logger:  logger,
+	}
+}
+
+// Sync applies the mutations of userID in order, then returns the changes
+// after cursor to the notes the user owns or has been shared. A mutation
+// that conflicts or is invalid doesn't stop the others; any other error
+// stops the sync and is returned along with a batch holding the results of
+// the mutations before it, which stay applied.
+func (s *SyncService) Sync(ctx context.Context, userID int, cursor int64, mutations []SyncMutation) (SyncBatch, error) {
+	if cursor < 0 {
+		return SyncBatch{}, fmt.Errorf("%w: cursor must not be negative", ErrValidation)
+	}
+	if len(mutations) > maxSyncMutations {
+		return SyncBatch{}, fmt.Errorf("%w: at most %d mutations can be synced at once", ErrValidation, maxSyncMutations)
+	}
+
+	batch := SyncBatch{Results: make([]SyncResult, 0, len(mutations)), Cursor: cursor}
+	for _, m := range mutations {
+		result, err := s.apply(ctx, userID, m)
+		if err != nil {
+			return batch, err
+		}
+		batch.Results = append(batch.Results, result)
+	}
+
+	changes, err := s.changes.ListSince(ctx, userID, cursor, syncPageSize+1)
+	if err != nil {
+		return batch, err
+	}
+	if len(changes) > syncPageSize {
+		changes = changes[:syncPageSize]
+		batch.HasMore = true
+	}
+	if len(changes) > 0 {
+		batch.Cursor = changes[len(changes)-1].Change.Seq
+	}
+	batch.Changes = changes
+	return batch, nil
+}
+
+func (s *SyncService) apply(ctx context.Context, userID int, m SyncMutation) (SyncResult, error) {
+	result := SyncResult{ClientID: m.ClientID}
+
+	note := m.Note
+	note.OwnerID = userID
+
+	var err error
+	switch m.Kind {
+	case entity.ChangeCreate:
+		note, err = s.notes.CreateForClient(ctx, note, m.ClientID)
+	case entity.ChangeUpdate:
+		if note.Version < 1 {
+			err = fmt.Errorf("%w: version is required", ErrValidation)
+			break
+		}
+		note, err = s.notes.Update(ctx, note, false)
+	case entity.ChangeDelete:
+		if note.Version < 1 {
+			err = fmt.Errorf("%w: version is required", ErrValidation)
+			break
+		}
+		err = s.notes.Delete(ctx, note.ID, userID, note.Version)
+	default:
+		err = fmt.Errorf("%w: unknown mutation %q", ErrValidation, m.Kind)
+	}
+
+	switch {
+	case err == nil:
+		result.Status = SyncApplied
+		if m.Kind != entity.ChangeDelete {
+			result.Note = &note
+		}
+	case errors.Is(err, ErrValidation), errors.Is(err, repository.ErrForbidden):
+		result.Status = SyncRejected
+		result.Error = err.Error()
+	case errors.Is(err, repository.ErrNotFound) && m.Kind == entity.ChangeCreate:
+		result.Status = SyncRejected
+		result.Error = "notebook or user key not found"
+	case errors.Is(err, repository.ErrNotFound):
+		// The note is gone on the server, which the client learns from the
+		// tombstone in the changes.
+		result.Status = SyncConflict
+	case errors.Is(err, repository.ErrConflict) && m.Kind == entity.ChangeCreate:
+		// The note the create made before has been deleted since.
+		result.Status = SyncConflict
+	case errors.Is(err, repository.ErrConflict):
+		result.Status = SyncConflict
+		if m.Kind == entity.ChangeUpdate {
+			result.Note = &note
+			break
+		}
+		current, err := s.notes.GetByID(ctx, m.Note.ID, userID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return SyncResult{}, err
+		}
+		if err == nil {
+			result.Note = &current
+		}
+	default:
+		return SyncResult{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const maxTagNameLength = 50
+
+type TagService struct {
+	repo   repository.Tag
+	logger logging.Logger
+}
+
+func NewTagService(repo repository.Tag, logger logging.Logger) *TagService {
+	return &TagService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *TagService) Create(ctx context.Context, tag entity.Tag) (entity.Tag, error) {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := validateTagName(tag.Name); err != nil {
+		return entity.Tag{}, err
+	}
+	return s.repo.Create(ctx, tag)
+}
+
+func (s *TagService) List(ctx context.Context, ownerID int) ([]entity.Tag, error) {
+	return s.repo.List(ctx, ownerID)
+}
+
+func (s *TagService) Rename(ctx context.Context, tag entity.Tag) (entity.Tag, error) {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := validateTagName(tag.Name); err != nil {
+		return entity.Tag{}, err
+	}
+	return s.repo.Rename(ctx, tag)
+}
+
+func (s *TagService) Merge(ctx context.Context, sourceID int, targetID int, ownerID int) error {
+	if sourceID == targetID {
+		return fmt.Errorf("%w: cannot merge a tag into itself", ErrValidation)
+	}
+	return s.repo.Merge(ctx, sourceID, targetID, ownerID)
+}
+
+func (s *TagService) Delete(ctx context.Context, id int, ownerID int) error {
+	return s.repo.Delete(ctx, id, ownerID)
+}
+
+func (s *TagService) ListByNoteID(ctx context.Context, noteID int, ownerID int) ([]entity.Tag, error) {
+	return s.repo.ListByNoteID(ctx, noteID, ownerID)
+}
+
+func (s *TagService) SetNoteTags(ctx context.Context, noteID int, ownerID int, tagIDs []int) error {
+	return s.repo.SetNoteTags(ctx, noteID, ownerID, uniqueIDs(tagIDs))
+}
+
+func validateTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: tag name is required", ErrValidation)
+	}
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return fmt.Errorf("%w: tag name must be at most %d characters", ErrValidation, maxTagNameLength)
+	}
+	return nil
+}
+
+func uniqueIDs(ids []int) []int {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
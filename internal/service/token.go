@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type TokenManager interface {
+	NewAccessToken(userID int) (string, time.Time, error)
+	NewRefreshToken() (string, error)
+	HashRefreshToken(refreshToken string) string
+}
+
+type Tokens struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+type TokenService struct {
+	repo            repository.RefreshToken
+	manager         TokenManager
+	refreshTokenTTL time.Duration
+	logger          logging.Logger
+}
+
+func NewTokenService(
+	repo repository.RefreshToken,
+	manager TokenManager,
+	refreshTokenTTL time.Duration,
+	logger logging.Logger,
+) *TokenService {
+	return &TokenService{
+		repo:            repo,
+		manager:         manager,
+		refreshTokenTTL: refreshTokenTTL,
+		logger:          logger,
+	}
+}
+
+// Issue starts a new token family for userID.
+func (s *TokenService) Issue(ctx context.Context, userID int) (Tokens, error) {
+	refreshToken, err := s.manager.NewRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	stored, err := s.repo.Create(ctx, entity.RefreshToken{
+		UserID:    userID,
+		TokenHash: s.manager.HashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return s.withAccessToken(userID, refreshToken, stored.ExpiresAt)
+}
+
+// Refresh exchanges refreshToken for a new pair. The presented token is
+// revoked and linked to its replacement. Presenting a token that was already
+// revoked is treated as theft: the whole family is revoked and
+// ErrRefreshTokenReused is returned.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	current, err := s.repo.GetByToken(ctx, s.manager.HashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return Tokens{}, fmt.Errorf("%w: %w", ErrInvalidRefreshToken, err)
+		}
+		return Tokens{}, err
+	}
+
+	if current.RevokedAt != nil {
+		return Tokens{}, s.handleReuse(ctx, current)
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return Tokens{}, fmt.Errorf("%w: token expired", ErrInvalidRefreshToken)
+	}
+
+	nextToken, err := s.manager.NewRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	next, err := s.repo.Rotate(ctx, current.ID, entity.RefreshToken{
+		UserID:    current.UserID,
+		TokenHash: s.manager.HashRefreshToken(nextToken),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		// Another request rotated the same token between our read and write.
+		if errors.Is(err, repository.ErrNotFound) {
+			return Tokens{}, s.handleReuse(ctx, current)
+		}
+		return Tokens{}, err
+	}
+
+	return s.withAccessToken(next.UserID, nextToken, next.ExpiresAt)
+}
+
+// Revoke revokes a single refresh token. Unknown or already revoked tokens
+// are not an error.
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	current, err := s.repo.GetByToken(ctx, s.manager.HashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if current.RevokedAt != nil {
+		return nil
+	}
+
+	return s.repo.RevokeByID(ctx, current.ID, time.Now())
+}
+
+// RevokeAll revokes every active refresh token of userID.
+func (s *TokenService) RevokeAll(ctx context.Context, userID int) error {
+	return s.repo.RevokeAllByUserID(ctx, userID, time.Now())
+}
+
+// Cleanup purges expired tokens and revoked tokens old enough that reuse
+// detection no longer needs them.
+func (s *TokenService) Cleanup(ctx context.Context) error {
+	if err := s.repo.CleanupExpired(ctx); err != nil {
+		return err
+	}
+	return s.repo.CleanupRevoked(ctx, time.Now().Add(-s.refreshTokenTTL))
+}
+
+func (s *TokenService) handleReuse(ctx context.Context, presented entity.RefreshToken) error {
+	s.logger.Warn("fail[token]: revoked refresh token reused, revoking token family",
+		logging.NewField("id", presented.ID),
+		logging.NewField("user_id", presented.UserID),
+	)
+
+	if err := s.repo.RevokeFamily(ctx, presented.ID, time.Now()); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *TokenService) withAccessToken(userID int, refreshToken string, refreshExpiresAt time.Time) (Tokens, error) {
+	accessToken, accessExpiresAt, err := s.manager.NewAccessToken(userID)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}, nil
+}
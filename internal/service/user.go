@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encodedHash string) (match bool, needsRehash bool, err error)
+}
+
+type UserService struct {
+	repo   repository.User
+	hasher PasswordHasher
+	logger logging.Logger
+}
+
+func NewUserService(repo repository.User, hasher PasswordHasher, logger logging.Logger) *UserService {
+	return &UserService{
+		repo:   repo,
+		hasher: hasher,
+		logger: logger,
+	}
+}
+
+// Create stores user with its plain text password replaced by a hash.
+func (s *UserService) Create(ctx context.Context, user entity.User) (entity.User, error) {
+	hash, err := s.hasher.Hash(user.Password)
+	if err != nil {
+		return entity.User{}, err
+	}
+	user.Password = hash
+
+	return s.repo.Create(ctx, user)
+}
+
+func (s *UserService) GetByID(ctx context.Context, id int) (entity.User, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// UpdateSearchLanguage changes the text search configuration used to index
+// and search the user's notes.
+func (s *UserService) UpdateSearchLanguage(ctx context.Context, id int, language string) error {
+	if !searchLanguages[language] {
+		return fmt.Errorf("%w: unsupported search language %q", ErrValidation, language)
+	}
+	return s.repo.UpdateSearchLanguage(ctx, id, language)
+}
+
+// Authenticate checks password against the stored hash of the user with the
+// given email. On success a hash made with outdated parameters or a legacy
+// algorithm is replaced; a failure to save it does not fail the login.
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (entity.User, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Spend the same time as a real check so unknown emails can't be told apart.
+			_, _ = s.hasher.Hash(password)
+			return entity.User{}, ErrInvalidCredentials
+		}
+		return entity.User{}, err
+	}
+
+	match, needsRehash, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		return entity.User{}, fmt.Errorf("failed to verify password for user %d: %w", user.ID, err)
+	}
+	if !match {
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		user = s.rehash(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+func (s *UserService) rehash(ctx context.Context, user entity.User, password string) entity.User {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.logger.Warn("fail[user]: failed to rehash password",
+			logging.NewField("id", user.ID),
+			logging.NewField("error", err),
+		)
+		return user
+	}
+
+	user.Password = hash
+	updated, err := s.repo.Update(ctx, user)
+	if err != nil {
+		s.logger.Warn("fail[user]: failed to save rehashed password",
+			logging.NewField("id", user.ID),
+			logging.NewField("error", err),
+		)
+		return user
+	}
+
+	s.logger.Info("done[user]: password rehashed",
+		logging.NewField("id", user.ID),
+	)
+	return updated
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/pkg/e2ee"
+)
+
+type UserKeyService struct {
+	repo   repository.UserKey
+	logger logging.Logger
+}
+
+func NewUserKeyService(repo repository.UserKey, logger logging.Logger) *UserKeyService {
+	return &UserKeyService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *UserKeyService) Get(ctx context.Context, userID int) (entity.UserKey, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+// Create stores the first key envelope of a user, which enables encrypted
+// notes for them.
+func (s *UserKeyService) Create(ctx context.Context, key entity.UserKey) (entity.UserKey, error) {
+	if err := validateUserKey(key); err != nil {
+		return entity.UserKey{}, err
+	}
+	return s.repo.Create(ctx, key)
+}
+
+// Update replaces the envelope of a user. The server can't check that the
+// new envelope wraps the same user key; a client that wraps another one
+// loses access to the existing encrypted notes.
+func (s *UserKeyService) Update(ctx context.Context, key entity.UserKey) (entity.UserKey, error) {
+	if err := validateUserKey(key); err != nil {
+		return entity.UserKey{}, err
+	}
+	return s.repo.Update(ctx, key)
+}
+
+func validateUserKey(key entity.UserKey) error {
+	if key.KDFMemory < 0 || key.KDFMemory > math.MaxUint32 ||
+		key.KDFIterations < 0 || key.KDFIterations > math.MaxUint32 ||
+		key.KDFParallelism < 0 || key.KDFParallelism > math.MaxUint8 {
+		return fmt.Errorf("%w: kdf parameters out of range", ErrValidation)
+	}
+	env := e2ee.Envelope{
+		KDF:         key.KDF,
+		Salt:        key.KDFSalt,
+		Memory:      uint32(key.KDFMemory),
+		Iterations:  uint32(key.KDFIterations),
+		Parallelism: uint8(key.KDFParallelism),
+		WrappedKey:  key.WrappedKey,
+	}
+	if err := env.Validate(); err != nil {
+		if errors.Is(err, e2ee.ErrEnvelope) {
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"Personal-Notes/internal/config"
+)
+
+const (
+	refreshTokenBytes   = 32
+	shareLinkTokenBytes = 32
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Manager struct {
+	method         jwt.SigningMethod
+	signKey        any
+	verifyKey      any
+	issuer         string
+	accessTokenTTL time.Duration
+}
+
+func NewManager(cfg *config.Config) (*Manager, error) {
+	m := &Manager{
+		issuer:         cfg.JWTIssuer,
+		accessTokenTTL: cfg.AccessTokenTTL,
+	}
+
+	switch cfg.JWTSigningMethod {
+	case jwt.SigningMethodHS256.Alg():
+		if cfg.JWTSigningKey == "" {
+			return nil, errors.New("empty signing key")
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = []byte(cfg.JWTSigningKey)
+		m.verifyKey = m.signKey
+	case jwt.SigningMethodEdDSA.Alg():
+		privatePEM, err := os.ReadFile(cfg.JWTPrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		publicPEM, err := os.ReadFile(cfg.JWTPublicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		if m.signKey, err = jwt.ParseEdPrivateKeyFromPEM(privatePEM); err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		if m.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(publicPEM); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		m.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing method %q", cfg.JWTSigningMethod)
+	}
+
+	return m, nil
+}
+
+func (m *Manager) NewAccessToken(userID int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.accessTokenTTL)
+
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		Issuer:    m.issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+func (m *Manager) ParseAccessToken(accessToken string) (int, error) {
+	var claims jwt.RegisteredClaims
+
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(t *jwt.Token) (any, error) {
+		return m.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad subject: %w", ErrInvalidToken, err)
+	}
+
+	return userID, nil
+}
+
+// NewRefreshToken returns an opaque random token. Only its hash, as returned
+// by HashRefreshToken, should ever be persisted.
+func (m *Manager) NewRefreshToken() (string, error) {
+	refreshToken, err := newOpaqueToken(refreshTokenBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return refreshToken, nil
+}
+
+func (m *Manager) HashRefreshToken(refreshToken string) string {
+	return hashOpaqueToken(refreshToken)
+}
+
+// NewShareLinkToken returns the unguessable token of a public share link.
+// Like refresh tokens, only its hash may be persisted.
+func (m *Manager) NewShareLinkToken() (string, error) {
+	shareLinkToken, err := newOpaqueToken(shareLinkTokenBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate share link token: %w", err)
+	}
+	return shareLinkToken, nil
+}
+
+func (m *Manager) HashShareLinkToken(shareLinkToken string) string {
+	return hashOpaqueToken(shareLinkToken)
+}
+
+func newOpaqueToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
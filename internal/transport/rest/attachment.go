@@ -0,0 +1,215 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Personal-Notes/internal/entity"
+)
+
+// maxMultipartOverhead is allowed on top of the maximum file size for the
+// multipart boundaries and headers of an upload.
+const maxMultipartOverhead = 1 << 20
+
+type attachmentResponse struct {
+	ID          int       `json:"id"`
+	NoteID      int       `json:"note_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      *string   `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type attachmentListResponse struct {
+	Attachments []attachmentResponse `json:"attachments"`
+}
+
+type storageUsageResponse struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+func newAttachmentResponse(attachment entity.Attachment) attachmentResponse {
+	return attachmentResponse{
+		ID:          attachment.ID,
+		NoteID:      attachment.NoteID,
+		FileName:    attachment.FileName,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		SHA256:      attachment.SHA256,
+		CreatedAt:   attachment.CreatedAt,
+	}
+}
+
+// uploadAttachment streams the "file" part of a multipart/form-data body to
+// the blob store without buffering it in memory or on disk.
+func (h *Handler) uploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize+maxMultipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a multipart/form-data body")
+		return
+	}
+
+	var file io.Reader
+	var fileName string
+	for file == nil {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "file part is required")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid multipart body")
+			return
+		}
+		if part.FormName() == "file" {
+			file, fileName = part, part.FileName()
+		}
+	}
+
+	attachment, err := h.services.Attachment.Upload(r.Context(), noteID, userID, fileName, file)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newAttachmentResponse(attachment))
+}
+
+func (h *Handler) listAttachments(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	attachments, err := h.services.Attachment.List(r.Context(), noteID, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := attachmentListResponse{Attachments: make([]attachmentResponse, 0, len(attachments))}
+	for _, attachment := range attachments {
+		resp.Attachments = append(resp.Attachments, newAttachmentResponse(attachment))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// downloadAttachment serves the content of an attachment with support for
+// range and conditional requests. Only types browsers can't execute are
+// shown inline, everything else is served as a download.
+func (h *Handler) downloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	attachmentID, err := strconv.Atoi(r.PathValue("attachment_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid attachment id")
+		return
+	}
+
+	attachment, content, err := h.services.Attachment.Open(r.Context(), attachmentID, noteID, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	if isInlineContentType(attachment.ContentType) {
+		disposition = "inline"
+	}
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}); header != "" {
+		disposition = header
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if attachment.SHA256 != nil {
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, *attachment.SHA256))
+	}
+
+	modTime := attachment.CreatedAt
+	if attachment.CompletedAt != nil {
+		modTime = *attachment.CompletedAt
+	}
+	http.ServeContent(w, r, "", modTime, content)
+}
+
+func (h *Handler) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	attachmentID, err := strconv.Atoi(r.PathValue("attachment_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid attachment id")
+		return
+	}
+
+	if err := h.services.Attachment.Delete(r.Context(), attachmentID, noteID, userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getStorageUsage(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	usage, err := h.services.Attachment.Usage(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, storageUsageResponse{Used: usage.Used, Quota: usage.Quota})
+}
+
+func isInlineContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp", "application/pdf", "text/plain":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
@@ -0,0 +1,194 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/service"
+)
+
+const (
+	refreshTokenCookie     = "refresh_token"
+	refreshTokenCookiePath = "/api/v1/auth"
+
+	// clientTypeMobile asks login for the refresh token in the response
+	// body instead of the cookie.
+	clientTypeMobile = "mobile"
+	clientTypeWeb    = "web"
+)
+
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// loginRequest logs in a browser by default, which gets its refresh token
+// in an HttpOnly cookie only. A client_type of mobile gets it in the body.
+type loginRequest struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	ClientType string `json:"client_type"`
+}
+
+// refreshTokenRequest is the body fallback for clients that can't keep the
+// HttpOnly cookie, such as mobile apps. A token sent this way is answered
+// with the new one in the body.
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokensResponse struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token,omitempty"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.services.Auth.Register(r.Context(), entity.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	switch req.ClientType {
+	case "", clientTypeWeb, clientTypeMobile:
+	default:
+		writeError(w, http.StatusBadRequest, "client_type must be web or mobile")
+		return
+	}
+
+	tokens, err := h.services.Auth.Login(r.Context(), req.Email, req.Password)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeTokens(w, tokens, req.ClientType == clientTypeMobile)
+}
+
+func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, inBody, err := readRefreshToken(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "missing refresh token")
+		return
+	}
+
+	tokens, err := h.services.Auth.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			h.clearRefreshTokenCookie(w)
+		}
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeTokens(w, tokens, inBody)
+}
+
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	refreshToken, _, err := readRefreshToken(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "missing refresh token")
+		return
+	}
+
+	if err := h.services.Auth.Logout(r.Context(), refreshToken); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.clearRefreshTokenCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	if err := h.services.Auth.LogoutAll(r.Context(), userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.clearRefreshTokenCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTokens answers with tokens. The refresh token goes in the HttpOnly
+// cookie, where scripts on the page can't read it, or in the body for a
+// client that asked for it there.
+func (h *Handler) writeTokens(w http.ResponseWriter, tokens service.Tokens, inBody bool) {
+	resp := tokensResponse{
+		AccessToken:           tokens.AccessToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+	}
+	if inBody {
+		resp.RefreshToken = tokens.RefreshToken
+	} else {
+		http.SetCookie(w, &http.Cookie{
+			Name:     refreshTokenCookie,
+			Value:    tokens.RefreshToken,
+			Path:     refreshTokenCookiePath,
+			Expires:  tokens.RefreshTokenExpiresAt,
+			HttpOnly: true,
+			Secure:   h.secureCookies,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) clearRefreshTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    "",
+		Path:     refreshTokenCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// readRefreshToken takes the token from the cookie and falls back to the
+// request body, reporting whether it came from there.
+func readRefreshToken(r *http.Request) (string, bool, error) {
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, false, nil
+	}
+
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	if req.RefreshToken == "" {
+		return "", false, errors.New("refresh token not provided")
+	}
+	return req.RefreshToken, true, nil
+}
@@ -0,0 +1,220 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"Personal-Notes/internal/service"
+	"Personal-Notes/pkg/crdt"
+)
+
+const (
+	collabMessageWelcome  = "welcome"
+	collabMessageUpdate   = "update"
+	collabMessagePresence = "presence"
+	collabMessageLeave    = "leave"
+
+	// collabReadLimit bounds a message from a client, which holds at most
+	// an edit such as a paste.
+	collabReadLimit = 1 << 20
+
+	// maxCloseReason is what's left of a control frame for the reason of a
+	// close once the code is in.
+	maxCloseReason = 123
+)
+
+type collabCursorPayload struct {
+	Anchor crdt.ID `json:"anchor"`
+	Head   crdt.ID `json:"head"`
+}
+
+type collabPresenceResponse struct {
+	Peer    uint32               `json:"peer"`
+	UserID  int                  `json:"user_id"`
+	Email   string               `json:"email"`
+	CanEdit bool                 `json:"can_edit"`
+	Cursor  *collabCursorPayload `json:"cursor"`
+}
+
+// collabRequest is a message from a client: an update of the document, or
+// where its cursor is, null for nowhere.
+type collabRequest struct {
+	Type   string               `json:"type"`
+	Update *crdt.Update         `json:"update"`
+	Cursor *collabCursorPayload `json:"cursor"`
+}
+
+// collabMessage is a message to a client. A welcome comes first with the
+// peer of the client, the document in the pkg/crdt encoding and the other
+// participants. Then come the updates and presence changes of the others,
+// and the peers that leave; the server's own updates have peer 0.
+type collabMessage struct {
+	Type         string                   `json:"type"`
+	Peer         *uint32                  `json:"peer,omitempty"`
+	CanEdit      *bool                    `json:"can_edit,omitempty"`
+	State        []byte                   `json:"state,omitempty"`
+	Participants []collabPresenceResponse `json:"participants,omitempty"`
+	Update       *crdt.Update             `json:"update,omitempty"`
+	Presence     *collabPresenceResponse  `json:"presence,omitempty"`
+}
+
+func newCollabPresenceResponse(p service.CollabPresence) collabPresenceResponse {
+	resp := collabPresenceResponse{
+		Peer:    p.Peer,
+		UserID:  p.UserID,
+		Email:   p.Email,
+		CanEdit: p.CanEdit,
+	}
+	if p.Cursor != nil {
+		resp.Cursor = &collabCursorPayload{Anchor: p.Cursor.Anchor, Head: p.Cursor.Head}
+	}
+	return resp
+}
+
+func newCollabWelcome(session *service.CollabSession) collabMessage {
+	participants := make([]collabPresenceResponse, len(session.Presence))
+	for i, p := range session.Presence {
+		participants[i] = newCollabPresenceResponse(p)
+	}
+	return collabMessage{
+		Type:         collabMessageWelcome,
+		Peer:         &session.Peer,
+		CanEdit:      &session.CanEdit,
+		State:        session.State,
+		Participants: participants,
+	}
+}
+
+func newCollabEventMessage(ev service.CollabEvent) collabMessage {
+	msg := collabMessage{Type: string(ev.Kind), Peer: &ev.Peer}
+	switch ev.Kind {
+	case service.CollabEventUpdate:
+		msg.Update = &ev.Update
+	case service.CollabEventPresence:
+		presence := newCollabPresenceResponse(ev.Presence)
+		msg.Presence = &presence
+	}
+	return msg
+}
+
+// collabNote lets the user edit the body of a note together with the others
+// it is shared with over a WebSocket. When the server drops the session it
+// closes the socket with "try again later" and the client joins again; an
+// invalid message or a rejected update closes it with the reason.
+func (h *Handler) collabNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.requestTimeout)
+	session, err := h.services.Collab.Join(ctx, id, userID)
+	cancel()
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+	defer session.Close()
+
+	conn, err := eventUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered with an error.
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel = context.WithCancel(r.Context())
+	defer cancel()
+
+	closeWith := func(code int, reason string) {
+		if len(reason) > maxCloseReason {
+			reason = strings.ToValidUTF8(reason[:maxCloseReason], "")
+		}
+		msg := websocket.FormatCloseMessage(code, reason)
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(eventWriteTimeout))
+	}
+
+	readTimeout := 2 * h.eventsHeartbeat
+	conn.SetReadLimit(collabReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+			var req collabRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				closeWith(websocket.CloseUnsupportedData, "invalid message")
+				return
+			}
+			switch {
+			case req.Type == collabMessageUpdate && req.Update != nil:
+				err = session.Update(*req.Update)
+			case req.Type == collabMessagePresence:
+				var cursor *service.CollabCursor
+				if req.Cursor != nil {
+					cursor = &service.CollabCursor{Anchor: req.Cursor.Anchor, Head: req.Cursor.Head}
+				}
+				err = session.MoveCursor(cursor)
+			default:
+				closeWith(websocket.CloseUnsupportedData, "invalid message")
+				return
+			}
+			if errors.Is(err, service.ErrCollabClosed) {
+				closeWith(websocket.CloseTryAgainLater, "join again")
+				return
+			}
+			if err != nil {
+				closeWith(websocket.ClosePolicyViolation, err.Error())
+				return
+			}
+		}
+	}()
+
+	send := func(msg collabMessage) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(msg)
+	}
+
+	if err := send(newCollabWelcome(session)); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(h.eventsHeartbeat)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case ev, ok := <-session.Events():
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "join again")
+				return
+			}
+			if err := send(newCollabEventMessage(ev)); err != nil {
+				return
+			}
+		}
+	}
+}
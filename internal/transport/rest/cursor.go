@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"Personal-Notes/internal/repository"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// noteCursor is serialized into the opaque cursor handed to clients. It
+// records the ordering it was issued for so it can't be replayed against a
+// different one.
+type noteCursor struct {
+	SortBy      repository.NoteSortField `json:"s"`
+	Desc        bool                     `json:"d"`
+	PinnedFirst bool                     `json:"f,omitempty"`
+	ID          int                      `json:"i"`
+	CreatedAt   time.Time                `json:"c"`
+	UpdatedAt   *time.Time               `json:"u,omitempty"`
+	Title       string                   `json:"t,omitempty"`
+	Pinned      bool                     `json:"p,omitempty"`
+}
+
+func encodeNoteCursor(c *repository.NoteCursor, params repository.NoteListParams) string {
+	raw, _ := json.Marshal(noteCursor{
+		SortBy:      params.SortBy,
+		Desc:        params.Desc,
+		PinnedFirst: params.PinnedFirst,
+		ID:          c.ID,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+		Title:       c.Title,
+		Pinned:      c.Pinned,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeNoteCursor(s string, params repository.NoteListParams) (*repository.NoteCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c noteCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, errInvalidCursor
+	}
+	if c.SortBy != params.SortBy || c.Desc != params.Desc || c.PinnedFirst != params.PinnedFirst {
+		return nil, errInvalidCursor
+	}
+
+	return &repository.NoteCursor{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Title:     c.Title,
+		Pinned:    c.Pinned,
+	}, nil
+}
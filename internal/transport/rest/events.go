@@ -0,0 +1,221 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/service"
+)
+
+const (
+	eventTypeNoteChange = "note_change"
+	eventTypeResync     = "resync"
+
+	// eventWriteTimeout bounds each write to a stream, so a client that
+	// stops reading doesn't hold its subscription forever.
+	eventWriteTimeout = 10 * time.Second
+)
+
+var eventUpgrader = websocket.Upgrader{
+	// Event streams authenticate with a bearer token rather than a cookie,
+	// so another site can't open one on a user's behalf.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// noteEventResponse is a change to a note the user can see. ID is the
+// event id to resume from, and the same sequence number /api/v1/sync uses as
+// its cursor.
+type noteEventResponse struct {
+	ID        int64             `json:"id"`
+	Op        entity.ChangeKind `json:"op"`
+	NoteID    int               `json:"note_id"`
+	ChangedAt time.Time         `json:"changed_at"`
+}
+
+// eventMessage is a WebSocket message: a note change, or a resync telling the
+// client it missed too much and should sync.
+type eventMessage struct {
+	Type string `json:"type"`
+	*noteEventResponse
+}
+
+func newNoteEventResponse(change entity.Change) *noteEventResponse {
+	return &noteEventResponse{
+		ID:        change.Seq,
+		Op:        change.Kind,
+		NoteID:    change.NoteID,
+		ChangedAt: change.CreatedAt,
+	}
+}
+
+// subscribeEvents opens the stream for the request, resuming after the
+// Last-Event-ID header or, as browsers can't set it on a first connect, the
+// last_event_id query parameter. It writes the error response on failure.
+func (h *Handler) subscribeEvents(w http.ResponseWriter, r *http.Request) (*service.NoteEventStream, bool) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var lastEventID int64
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw != "" {
+		var err error
+		if lastEventID, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid last event id")
+			return nil, false
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.requestTimeout)
+	defer cancel()
+
+	stream, err := h.services.NoteEvents.Subscribe(ctx, userID, lastEventID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return nil, false
+	}
+	return stream, true
+}
+
+// nextEvent waits for the next change of stream for at most one heartbeat
+// interval. A zero change with a nil error means the interval passed.
+func (h *Handler) nextEvent(ctx context.Context, stream *service.NoteEventStream) (entity.Change, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, h.eventsHeartbeat)
+	defer cancel()
+
+	change, err := stream.Next(waitCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return entity.Change{}, nil
+	}
+	return change, err
+}
+
+// streamEvents sends the changes to the user's notes as Server-Sent Events.
+// When the server drops the stream the client reconnects, and EventSource
+// sends the id of the last event it got along.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	stream, ok := h.subscribeEvents(w, r)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(frame string) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := fmt.Fprint(w, frame); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if stream.Resync {
+		if err := send("event: " + eventTypeResync + "\ndata: {}\n\n"); err != nil {
+			return
+		}
+	} else if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for {
+		change, err := h.nextEvent(r.Context(), stream)
+		if err != nil {
+			return
+		}
+
+		if change.Seq == 0 {
+			err = send(": heartbeat\n\n")
+		} else {
+			data, _ := json.Marshal(newNoteEventResponse(change))
+			err = send(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", change.Seq, eventTypeNoteChange, data))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// streamEventsWS sends the changes to the user's notes over a WebSocket.
+// When the server drops the stream it closes the socket with "try again
+// later", and the client reconnects with the id of the last event it got.
+func (h *Handler) streamEventsWS(w http.ResponseWriter, r *http.Request) {
+	stream, ok := h.subscribeEvents(w, r)
+	if !ok {
+		return
+	}
+	defer stream.Close()
+
+	conn, err := eventUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered with an error.
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// The client only sends control frames. Reading answers them and notices
+	// when the client goes away or stops answering pings.
+	readTimeout := 2 * h.eventsHeartbeat
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(msg eventMessage) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(msg)
+	}
+
+	if stream.Resync {
+		if err := send(eventMessage{Type: eventTypeResync}); err != nil {
+			return
+		}
+	}
+
+	for {
+		change, err := h.nextEvent(ctx, stream)
+		if errors.Is(err, service.ErrStreamClosed) {
+			msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "resume from the last event")
+			_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(eventWriteTimeout))
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		if change.Seq == 0 {
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout))
+		} else {
+			err = send(eventMessage{Type: eventTypeNoteChange, noteEventResponse: newNoteEventResponse(change)})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
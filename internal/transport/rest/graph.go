@@ -0,0 +1,285 @@
+package rest
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+)
+
+const (
+	graphRelationLink   = "link"
+	graphRelationTagged = "tagged"
+
+	graphNodeNote = "note"
+	graphNodeTag  = "tag"
+)
+
+// graphResponse follows the JSON Graph Format (https://jsongraphformat.info).
+type graphResponse struct {
+	Graph graphBody `json:"graph"`
+}
+
+type graphBody struct {
+	Directed bool                 `json:"directed"`
+	Nodes    map[string]graphNode `json:"nodes"`
+	Edges    []graphEdge          `json:"edges"`
+}
+
+type graphNode struct {
+	Label    string            `json:"label"`
+	Metadata graphNodeMetadata `json:"metadata"`
+}
+
+type graphNodeMetadata struct {
+	Kind       string     `json:"kind"`
+	ID         int        `json:"id"`
+	NotebookID *int       `json:"notebook_id,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	Encrypted  bool       `json:"encrypted,omitempty"`
+}
+
+type graphEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Relation string `json:"relation"`
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// getGraph serves GET /api/v1/graph?format=json|graphml with optional
+// note_id and depth for the neighbourhood of a focal note, comma separated
+// tags and notebook_id, which includes the notebook's descendants. Notes and
+// tags are nodes; wiki links connect notes and tagged edges connect notes to
+// their tags.
+func (h *Handler) getGraph(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "graphml" {
+		writeError(w, http.StatusBadRequest, "invalid format")
+		return
+	}
+
+	params, focusNoteID, depth, err := parseGraphParams(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.OwnerID = userID
+
+	graph, err := h.services.Graph.Build(r.Context(), params, focusNoteID, depth)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	if format == "graphml" {
+		h.writeGraphML(w, r, graph)
+		return
+	}
+	writeJSON(w, http.StatusOK, newGraphResponse(graph))
+}
+
+func parseGraphParams(q url.Values) (repository.GraphParams, *int, int, error) {
+	var (
+		params      repository.GraphParams
+		focusNoteID *int
+		depth       int
+		err         error
+	)
+
+	if v := q.Get("note_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return params, nil, 0, errors.New("invalid note_id")
+		}
+		focusNoteID = &id
+	}
+	if v := q.Get("depth"); v != "" {
+		if depth, err = strconv.Atoi(v); err != nil {
+			return params, nil, 0, errors.New("invalid depth")
+		}
+	}
+	if v := q.Get("notebook_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return params, nil, 0, errors.New("invalid notebook_id")
+		}
+		params.NotebookID = &id
+	}
+	if params.TagIDs, err = parseIDList(q.Get("tags")); err != nil {
+		return params, nil, 0, errors.New("invalid tags")
+	}
+	return params, focusNoteID, depth, nil
+}
+
+func graphNoteNodeID(id int) string {
+	return fmt.Sprintf("%s:%d", graphNodeNote, id)
+}
+
+func graphTagNodeID(id int) string {
+	return fmt.Sprintf("%s:%d", graphNodeTag, id)
+}
+
+func newGraphResponse(graph repository.NoteGraph) graphResponse {
+	body := graphBody{
+		Directed: true,
+		Nodes:    make(map[string]graphNode, len(graph.Notes)+len(graph.Tags)),
+		Edges:    make([]graphEdge, 0, len(graph.Links)+len(graph.Taggings)),
+	}
+	for _, note := range graph.Notes {
+		createdAt := note.CreatedAt
+		body.Nodes[graphNoteNodeID(note.ID)] = graphNode{
+			Label: note.Title,
+			Metadata: graphNodeMetadata{
+				Kind:       graphNodeNote,
+				ID:         note.ID,
+				NotebookID: note.NotebookID,
+				CreatedAt:  &createdAt,
+				UpdatedAt:  note.UpdatedAt,
+				Encrypted:  note.Encrypted,
+			},
+		}
+	}
+	for _, tag := range graph.Tags {
+		body.Nodes[graphTagNodeID(tag.ID)] = graphNode{
+			Label:    tag.Name,
+			Metadata: graphNodeMetadata{Kind: graphNodeTag, ID: tag.ID},
+		}
+	}
+	for _, link := range graph.Links {
+		body.Edges = append(body.Edges, graphEdge{
+			Source:   graphNoteNodeID(link.SourceID),
+			Target:   graphNoteNodeID(link.TargetID),
+			Relation: graphRelationLink,
+		})
+	}
+	for _, t := range graph.Taggings {
+		body.Edges = append(body.Edges, graphEdge{
+			Source:   graphNoteNodeID(t.NoteID),
+			Target:   graphTagNodeID(t.TagID),
+			Relation: graphRelationTagged,
+		})
+	}
+	return graphResponse{Graph: body}
+}
+
+func newGraphML(graph repository.NoteGraph) graphML {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "notebook_id", For: "node", AttrName: "notebook_id", AttrType: "int"},
+			{ID: "encrypted", For: "node", AttrName: "encrypted", AttrType: "boolean"},
+			{ID: "relation", For: "edge", AttrName: "relation", AttrType: "string"},
+		},
+		Graph: graphMLGraph{
+			ID:          "notes",
+			EdgeDefault: "directed",
+			Nodes:       make([]graphMLNode, 0, len(graph.Notes)+len(graph.Tags)),
+			Edges:       make([]graphMLEdge, 0, len(graph.Links)+len(graph.Taggings)),
+		},
+	}
+	for _, note := range graph.Notes {
+		node := graphMLNode{
+			ID: graphNoteNodeID(note.ID),
+			Data: []graphMLData{
+				{Key: "kind", Value: graphNodeNote},
+				{Key: "label", Value: note.Title},
+			},
+		}
+		if note.NotebookID != nil {
+			node.Data = append(node.Data, graphMLData{Key: "notebook_id", Value: strconv.Itoa(*note.NotebookID)})
+		}
+		if note.Encrypted {
+			node.Data = append(node.Data, graphMLData{Key: "encrypted", Value: "true"})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, tag := range graph.Tags {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: graphTagNodeID(tag.ID),
+			Data: []graphMLData{
+				{Key: "kind", Value: graphNodeTag},
+				{Key: "label", Value: tag.Name},
+			},
+		})
+	}
+	addEdge := func(source, target, relation string) {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     fmt.Sprintf("e%d", len(doc.Graph.Edges)),
+			Source: source,
+			Target: target,
+			Data:   []graphMLData{{Key: "relation", Value: relation}},
+		})
+	}
+	for _, link := range graph.Links {
+		addEdge(graphNoteNodeID(link.SourceID), graphNoteNodeID(link.TargetID), graphRelationLink)
+	}
+	for _, t := range graph.Taggings {
+		addEdge(graphNoteNodeID(t.NoteID), graphTagNodeID(t.TagID), graphRelationTagged)
+	}
+	return doc
+}
+
+func (h *Handler) writeGraphML(w http.ResponseWriter, r *http.Request, graph repository.NoteGraph) {
+	w.Header().Set("Content-Type", "application/graphml+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(newGraphML(graph)); err != nil {
+		h.logger.Error("fail[http]: failed to write graphml",
+			logging.NewField("method", r.Method),
+			logging.NewField("path", logPath(r)),
+			logging.NewField("error", err),
+		)
+	}
+}
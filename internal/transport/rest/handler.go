@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/config"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/service"
+)
+
+type TokenParser interface {
+	ParseAccessToken(accessToken string) (int, error)
+}
+
+type Handler struct {
+	services        *service.Services
+	tokens          TokenParser
+	logger          logging.Logger
+	requestTimeout  time.Duration
+	transferTimeout time.Duration
+	maxUploadSize   int64
+	secureCookies   bool
+	eventsHeartbeat time.Duration
+}
+
+func NewHandler(
+	services *service.Services,
+	tokens TokenParser,
+	logger logging.Logger,
+	cfg *config.Config,
+) *Handler {
+	return &Handler{
+		services:        services,
+		tokens:          tokens,
+		logger:          logger,
+		requestTimeout:  cfg.HTTPRequestTimeout,
+		transferTimeout: cfg.AttachmentTransferTimeout,
+		maxUploadSize:   cfg.AttachmentMaxSize,
+		secureCookies:   cfg.CookieSecure,
+		eventsHeartbeat: cfg.EventsHeartbeatInterval,
+	}
+}
+
+func (h *Handler) InitRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /api/v1/auth/register", h.register)
+	mux.HandleFunc("POST /api/v1/auth/login", h.login)
+	mux.HandleFunc("POST /api/v1/auth/refresh", h.refresh)
+	mux.HandleFunc("POST /api/v1/auth/logout", h.logout)
+	mux.Handle("POST /api/v1/auth/logout-all", h.userIdentity(http.HandlerFunc(h.logoutAll)))
+
+	mux.Handle("GET /api/v1/users/me", h.userIdentity(http.HandlerFunc(h.getMe)))
+	mux.Handle("PUT /api/v1/users/me/search-language", h.userIdentity(http.HandlerFunc(h.updateSearchLanguage)))
+	mux.Handle("GET /api/v1/users/me/key", h.userIdentity(http.HandlerFunc(h.getUserKey)))
+	mux.Handle("POST /api/v1/users/me/key", h.userIdentity(http.HandlerFunc(h.createUserKey)))
+	mux.Handle("PUT /api/v1/users/me/key", h.userIdentity(http.HandlerFunc(h.updateUserKey)))
+
+	mux.Handle("POST /api/v1/sync", h.userIdentity(http.HandlerFunc(h.sync)))
+
+	mux.Handle("POST /api/v1/notes", h.userIdentity(http.HandlerFunc(h.createNote)))
+	mux.Handle("GET /api/v1/notes", h.userIdentity(http.HandlerFunc(h.listNotes)))
+	mux.Handle("GET /api/v1/notes/search", h.userIdentity(http.HandlerFunc(h.searchNotes)))
+	mux.Handle("GET /api/v1/notes/shared", h.userIdentity(http.HandlerFunc(h.listSharedNotes)))
+	mux.Handle("GET /api/v1/notes/{id}", h.userIdentity(http.HandlerFunc(h.getNote)))
+	mux.Handle("PUT /api/v1/notes/{id}", h.userIdentity(http.HandlerFunc(h.updateNote)))
+	mux.Handle("DELETE /api/v1/notes/{id}", h.userIdentity(http.HandlerFunc(h.deleteNote)))
+	mux.Handle("GET /api/v1/notes/{id}/tags", h.userIdentity(http.HandlerFunc(h.getNoteTags)))
+	mux.Handle("PUT /api/v1/notes/{id}/tags", h.userIdentity(http.HandlerFunc(h.setNoteTags)))
+	mux.Handle("PATCH /api/v1/notes/state", h.userIdentity(http.HandlerFunc(h.bulkSetNoteState)))
+	mux.Handle("PATCH /api/v1/notes/{id}/state", h.userIdentity(http.HandlerFunc(h.setNoteState)))
+	mux.Handle("PUT /api/v1/notes/{id}/notebook", h.userIdentity(http.HandlerFunc(h.moveNote)))
+
+	mux.Handle("GET /api/v1/notes/{id}/revisions", h.userIdentity(http.HandlerFunc(h.listNoteRevisions)))
+	mux.Handle("GET /api/v1/notes/{id}/revisions/diff", h.userIdentity(http.HandlerFunc(h.diffNoteRevisions)))
+	mux.Handle("GET /api/v1/notes/{id}/revisions/{revision}", h.userIdentity(http.HandlerFunc(h.getNoteRevision)))
+	mux.Handle("POST /api/v1/notes/{id}/revisions/{revision}/restore",
+		h.userIdentity(http.HandlerFunc(h.restoreNoteRevision)))
+
+	mux.Handle("GET /api/v1/notes/{id}/shares", h.userIdentity(http.HandlerFunc(h.listNoteShares)))
+	mux.Handle("POST /api/v1/notes/{id}/shares", h.userIdentity(http.HandlerFunc(h.inviteNoteShare)))
+	mux.Handle("PATCH /api/v1/notes/{id}/shares/{user_id}", h.userIdentity(http.HandlerFunc(h.updateNoteShare)))
+	mux.Handle("DELETE /api/v1/notes/{id}/shares/{user_id}", h.userIdentity(http.HandlerFunc(h.revokeNoteShare)))
+
+	mux.Handle("GET /api/v1/notes/{id}/links", h.userIdentity(http.HandlerFunc(h.listShareLinks)))
+	mux.Handle("POST /api/v1/notes/{id}/links", h.userIdentity(http.HandlerFunc(h.createShareLink)))
+	mux.Handle("DELETE /api/v1/notes/{id}/links/{link_id}", h.userIdentity(http.HandlerFunc(h.revokeShareLink)))
+
+	mux.HandleFunc("GET /api/v1/public/notes/{token}", h.getPublicNote)
+	mux.HandleFunc("GET /s/{token}", h.viewSharePage)
+	mux.HandleFunc("POST /s/{token}", h.viewSharePage)
+
+	mux.Handle("GET /api/v1/notes/{id}/attachments", h.userIdentity(http.HandlerFunc(h.listAttachments)))
+	mux.Handle("DELETE /api/v1/notes/{id}/attachments/{attachment_id}",
+		h.userIdentity(http.HandlerFunc(h.deleteAttachment)))
+	mux.Handle("GET /api/v1/attachments/usage", h.userIdentity(http.HandlerFunc(h.getStorageUsage)))
+
+	mux.Handle("GET /api/v1/notes/{id}/backlinks", h.userIdentity(http.HandlerFunc(h.listBacklinks)))
+	mux.Handle("GET /api/v1/links/broken", h.userIdentity(http.HandlerFunc(h.listBrokenLinks)))
+	mux.Handle("GET /api/v1/graph", h.userIdentity(http.HandlerFunc(h.getGraph)))
+
+	mux.Handle("GET /api/v1/trash", h.userIdentity(http.HandlerFunc(h.listTrash)))
+	mux.Handle("POST /api/v1/trash/{id}/restore", h.userIdentity(http.HandlerFunc(h.restoreNote)))
+	mux.Handle("DELETE /api/v1/trash/{id}", h.userIdentity(http.HandlerFunc(h.purgeNote)))
+
+	mux.Handle("POST /api/v1/notebooks", h.userIdentity(http.HandlerFunc(h.createNotebook)))
+	mux.Handle("GET /api/v1/notebooks", h.userIdentity(http.HandlerFunc(h.getNotebookTree)))
+	mux.Handle("GET /api/v1/notebooks/{id}", h.userIdentity(http.HandlerFunc(h.getNotebook)))
+	mux.Handle("PATCH /api/v1/notebooks/{id}", h.userIdentity(http.HandlerFunc(h.renameNotebook)))
+	mux.Handle("POST /api/v1/notebooks/{id}/move", h.userIdentity(http.HandlerFunc(h.moveNotebook)))
+	mux.Handle("DELETE /api/v1/notebooks/{id}", h.userIdentity(http.HandlerFunc(h.deleteNotebook)))
+
+	mux.Handle("POST /api/v1/tags", h.userIdentity(http.HandlerFunc(h.createTag)))
+	mux.Handle("GET /api/v1/tags", h.userIdentity(http.HandlerFunc(h.listTags)))
+	mux.Handle("PATCH /api/v1/tags/{id}", h.userIdentity(http.HandlerFunc(h.renameTag)))
+	mux.Handle("DELETE /api/v1/tags/{id}", h.userIdentity(http.HandlerFunc(h.deleteTag)))
+	mux.Handle("POST /api/v1/tags/{id}/merge", h.userIdentity(http.HandlerFunc(h.mergeTag)))
+
+	// Transfers get their own deadline instead of the request timeout, and
+	// event streams stay open for as long as the client listens.
+	root := http.NewServeMux()
+	root.Handle("POST /api/v1/notes/{id}/attachments",
+		h.transfer(h.userIdentity(http.HandlerFunc(h.uploadAttachment))))
+	root.Handle("GET /api/v1/notes/{id}/attachments/{attachment_id}",
+		h.transfer(h.userIdentity(http.HandlerFunc(h.downloadAttachment))))
+	root.Handle("GET /api/v1/events", h.stream(h.streamIdentity(http.HandlerFunc(h.streamEvents))))
+	root.Handle("GET /api/v1/events/ws", h.stream(h.streamIdentity(http.HandlerFunc(h.streamEventsWS))))
+	root.Handle("GET /api/v1/notes/{id}/collab", h.stream(h.streamIdentity(http.HandlerFunc(h.collabNote))))
+	root.Handle("/", h.timeout(mux))
+
+	return h.recoverer(h.requestLogger(root))
+}
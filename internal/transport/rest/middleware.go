@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"Personal-Notes/internal/logging"
+)
+
+type ctxKey int
+
+const userIDCtxKey ctxKey = iota
+
+// secretPathPrefixes are followed by a share link token, which must not end
+// up in the logs.
+var secretPathPrefixes = []string{shareLinkPathPrefix, "/api/v1/public/notes/"}
+
+// logPath returns the request path with any share link token redacted.
+func logPath(r *http.Request) string {
+	for _, prefix := range secretPathPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return prefix + "[redacted]"
+		}
+	}
+	return r.URL.Path
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades, which look for http.Hijacker, take over
+// the connection.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (h *Handler) recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				h.logger.Error("fail[http]: panic recovered",
+					logging.NewField("method", r.Method),
+					logging.NewField("path", logPath(r)),
+					logging.NewField("panic", fmt.Sprint(rec)),
+				)
+				writeError(w, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		h.logger.Info("done[http]: request handled",
+			logging.NewField("method", r.Method),
+			logging.NewField("path", logPath(r)),
+			logging.NewField("status", rec.status),
+			logging.NewField("duration", time.Since(start)),
+		)
+	})
+}
+
+func (h *Handler) timeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.requestTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// transfer replaces the request timeout and the server's read and write
+// timeouts for uploads and downloads, which take much longer than API calls.
+func (h *Handler) transfer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Now().Add(h.transferTimeout)
+
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline)
+
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// stream lifts the server's read and write timeouts for event streams, which
+// set a deadline on each write instead.
+func (h *Handler) stream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) userIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		accessToken, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || accessToken == "" {
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		userID, err := h.tokens.ParseAccessToken(accessToken)
+		if err != nil {
+			h.logger.Warn("fail[http]: invalid access token",
+				logging.NewField("path", logPath(r)),
+				logging.NewField("error", err),
+			)
+			writeError(w, http.StatusUnauthorized, "invalid access token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDCtxKey, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// streamIdentity is userIdentity for event streams. Browsers can't set
+// headers on EventSource or WebSocket connections, so the access token may
+// come in the access_token query parameter instead.
+func (h *Handler) streamIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if accessToken := r.URL.Query().Get("access_token"); accessToken != "" {
+				r = r.Clone(r.Context())
+				r.Header.Set("Authorization", "Bearer "+accessToken)
+			}
+		}
+		h.userIdentity(next).ServeHTTP(w, r)
+	})
+}
+
+func userIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDCtxKey).(int)
+	return userID, ok
+}
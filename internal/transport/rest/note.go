@@ -0,0 +1,631 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/repository"
+)
+
+// noteRequest creates or updates a note. An encrypted note carries
+// ciphertext in title and body, and on creation its wrapped note key.
+type noteRequest struct {
+	NotebookID   *int    `json:"notebook_id"`
+	Title        string  `json:"title"`
+	Body         *string `json:"body"`
+	Version      *int    `json:"version"`
+	RewriteLinks bool    `json:"rewrite_links"`
+	Encrypted    bool    `json:"encrypted"`
+	NoteKey      []byte  `json:"note_key"`
+}
+
+type noteResponse struct {
+	ID         int        `json:"id"`
+	OwnerID    int        `json:"owner_id"`
+	NotebookID *int       `json:"notebook_id"`
+	Title      string     `json:"title"`
+	Body       *string    `json:"body"`
+	Version    int        `json:"version"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	PinnedAt   *time.Time `json:"pinned_at"`
+	ArchivedAt *time.Time `json:"archived_at"`
+	StarredAt  *time.Time `json:"starred_at"`
+	Encrypted  bool       `json:"encrypted"`
+	NoteKey    []byte     `json:"note_key,omitempty"`
+	BodyHTML   *string    `json:"body_html,omitempty"`
+}
+
+type noteStateRequest struct {
+	Pinned   *bool `json:"pinned"`
+	Archived *bool `json:"archived"`
+	Starred  *bool `json:"starred"`
+}
+
+type bulkNoteStateRequest struct {
+	IDs []int `json:"ids"`
+	noteStateRequest
+}
+
+type bulkNoteStateResponse struct {
+	Notes []noteResponse `json:"notes"`
+}
+
+type noteTrashResponse struct {
+	Notes []noteResponse `json:"notes"`
+}
+
+type noteConflictResponse struct {
+	Error   string       `json:"error"`
+	Current noteResponse `json:"current"`
+}
+
+type noteListResponse struct {
+	Notes      []noteResponse     `json:"notes"`
+	NextCursor *string            `json:"next_cursor"`
+	TagCounts  []tagCountResponse `json:"tag_counts"`
+}
+
+type noteSearchHitResponse struct {
+	Note           noteResponse `json:"note"`
+	Rank           float32      `json:"rank"`
+	TitleHighlight string       `json:"title_highlight"`
+	Snippet        string       `json:"snippet"`
+}
+
+type noteSearchResponse struct {
+	Results []noteSearchHitResponse `json:"results"`
+}
+
+func newNoteResponse(note entity.Note) noteResponse {
+	return noteResponse{
+		ID:         note.ID,
+		OwnerID:    note.OwnerID,
+		NotebookID: note.NotebookID,
+		Title:      note.Title,
+		Body:       note.Body,
+		Version:    note.Version,
+		CreatedAt:  note.CreatedAt,
+		UpdatedAt:  note.UpdatedAt,
+		DeletedAt:  note.DeletedAt,
+		PinnedAt:   note.PinnedAt,
+		ArchivedAt: note.ArchivedAt,
+		StarredAt:  note.StarredAt,
+		Encrypted:  note.Encrypted,
+		NoteKey:    note.NoteKey,
+	}
+}
+
+func (h *Handler) createNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req noteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	note, err := h.services.Note.Create(r.Context(), entity.Note{
+		OwnerID:    userID,
+		NotebookID: req.NotebookID,
+		Title:      req.Title,
+		Body:       req.Body,
+		Encrypted:  req.Encrypted,
+		NoteKey:    req.NoteKey,
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(note))
+	writeJSON(w, http.StatusCreated, newNoteResponse(note))
+}
+
+func (h *Handler) getNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	asHTML, err := parseBodyFormat(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	note, err := h.services.Note.GetByID(r.Context(), id, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	etag := noteETag(note)
+	if asHTML {
+		etag = fmt.Sprintf(`"%d-html"`, note.Version)
+	}
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match == etag || match == "*" {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	resp := newNoteResponse(note)
+	if asHTML {
+		html, err := h.services.Note.RenderHTML(note)
+		if err != nil {
+			h.handleServiceError(w, r, err)
+			return
+		}
+		resp.BodyHTML = &html
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseBodyFormat reports whether ?format=html asks for the note body
+// rendered from markdown to sanitized HTML in addition to the raw body.
+func parseBodyFormat(query url.Values) (bool, error) {
+	switch query.Get("format") {
+	case "", "raw":
+		return false, nil
+	case "html":
+		return true, nil
+	default:
+		return false, errors.New("invalid format")
+	}
+}
+
+// listNotes serves GET /api/v1/notes?sort=&order=&limit=&cursor=
+// with optional created_from, created_to, updated_from and updated_to
+// RFC 3339 bounds, notebook_id, comma separated tags_any and tags_all tag
+// ids, pinned and starred flags and archived=exclude|only|include. Pinned
+// notes are listed first unless pinned_first=false.
+func (h *Handler) listNotes(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	params, err := parseNoteListParams(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.OwnerID = userID
+
+	page, err := h.services.Note.List(r.Context(), params)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := noteListResponse{
+		Notes:     make([]noteResponse, 0, len(page.Notes)),
+		TagCounts: newTagCountResponses(page.TagCounts),
+	}
+	for _, note := range page.Notes {
+		resp.Notes = append(resp.Notes, newNoteResponse(note))
+	}
+	if page.NextCursor != nil {
+		cursor := encodeNoteCursor(page.NextCursor, params)
+		resp.NextCursor = &cursor
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// searchNotes serves GET /api/v1/notes/search?q=&limit=&offset=. The query
+// supports "quoted phrases" and prefix* terms; highlights are HTML with
+// matches wrapped in <mark>.
+func (h *Handler) searchNotes(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	q := r.URL.Query()
+	limit, offset := 0, 0
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+	}
+
+	hits, err := h.services.Note.Search(r.Context(), userID, q.Get("q"), limit, offset)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := noteSearchResponse{Results: make([]noteSearchHitResponse, 0, len(hits))}
+	for _, hit := range hits {
+		resp.Results = append(resp.Results, noteSearchHitResponse{
+			Note:           newNoteResponse(hit.Note),
+			Rank:           hit.Rank,
+			TitleHighlight: hit.TitleHighlight,
+			Snippet:        hit.Snippet,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// updateNote writes a note if it is still at the version the client names in
+// If-Match or the body, and answers 409 with the current note otherwise.
+func (h *Handler) updateNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	var req noteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	version, err := expectedNoteVersion(r, req.Version)
+	if err != nil {
+		writeNoteVersionError(w, err)
+		return
+	}
+
+	note, err := h.services.Note.Update(r.Context(), entity.Note{
+		ID:        id,
+		OwnerID:   userID,
+		Title:     req.Title,
+		Body:      req.Body,
+		Version:   version,
+		Encrypted: req.Encrypted,
+	}, req.RewriteLinks)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			writeNoteConflict(w, note)
+			return
+		}
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(note))
+	writeJSON(w, http.StatusOK, newNoteResponse(note))
+}
+
+func (h *Handler) setNoteState(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	var req noteStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	notes, err := h.services.Note.SetState(r.Context(), userID, []int{id}, req.change())
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(notes[0]))
+	writeJSON(w, http.StatusOK, newNoteResponse(notes[0]))
+}
+
+// bulkSetNoteState changes the states of many notes at once; either all of
+// them change or none does.
+func (h *Handler) bulkSetNoteState(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req bulkNoteStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	notes, err := h.services.Note.SetState(r.Context(), userID, req.IDs, req.change())
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := bulkNoteStateResponse{Notes: make([]noteResponse, 0, len(notes))}
+	for _, note := range notes {
+		resp.Notes = append(resp.Notes, newNoteResponse(note))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (req noteStateRequest) change() repository.NoteStateChange {
+	return repository.NoteStateChange{
+		Pinned:   req.Pinned,
+		Archived: req.Archived,
+		Starred:  req.Starred,
+	}
+}
+
+// deleteNote moves a note to the trash if it is still at the version in
+// If-Match.
+func (h *Handler) deleteNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	version, err := expectedNoteVersion(r, nil)
+	if err != nil {
+		writeNoteVersionError(w, err)
+		return
+	}
+
+	if err := h.services.Note.Delete(r.Context(), id, userID, version); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listTrash(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	notes, err := h.services.Note.ListTrash(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := noteTrashResponse{Notes: make([]noteResponse, 0, len(notes))}
+	for _, note := range notes {
+		resp.Notes = append(resp.Notes, newNoteResponse(note))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) restoreNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	note, err := h.services.Note.Restore(r.Context(), id, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(note))
+	writeJSON(w, http.StatusOK, newNoteResponse(note))
+}
+
+// purgeNote permanently deletes a note that is in the trash.
+func (h *Handler) purgeNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	if err := h.services.Note.Purge(r.Context(), id, userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// noteETag returns the entity tag of a note, which changes with its version.
+func noteETag(note entity.Note) string {
+	return fmt.Sprintf(`"%d"`, note.Version)
+}
+
+// errNoteVersionRequired rejects a write to a note that doesn't say which
+// version it was made against, which would overwrite whatever is there.
+var errNoteVersionRequired = errors.New("If-Match header or version is required")
+
+// expectedNoteVersion returns the note version a write is conditional on,
+// taken from the If-Match header or the version field of the body. A write
+// must name one: without, or with If-Match: *, errNoteVersionRequired is
+// returned.
+func expectedNoteVersion(r *http.Request, bodyVersion *int) (int, error) {
+	version := 0
+	if bodyVersion != nil {
+		if *bodyVersion < 1 {
+			return 0, errors.New("invalid version")
+		}
+		version = *bodyVersion
+	}
+
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		if version == 0 {
+			return 0, errNoteVersionRequired
+		}
+		return version, nil
+	}
+
+	unquoted, ok := strings.CutPrefix(match, `"`)
+	if ok {
+		unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	}
+	headerVersion, err := strconv.Atoi(unquoted)
+	if !ok || err != nil || headerVersion < 1 {
+		return 0, errors.New("invalid If-Match header")
+	}
+	if version != 0 && version != headerVersion {
+		return 0, errors.New("If-Match header and version do not agree")
+	}
+	return headerVersion, nil
+}
+
+// writeNoteVersionError reports a write expectedNoteVersion refused.
+func writeNoteVersionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNoteVersionRequired) {
+		writeError(w, http.StatusPreconditionRequired, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// writeNoteConflict reports a failed conditional write together with the
+// current server copy of the note.
+func writeNoteConflict(w http.ResponseWriter, current entity.Note) {
+	w.Header().Set("ETag", noteETag(current))
+	writeJSON(w, http.StatusConflict, noteConflictResponse{
+		Error:   "note was modified by another request",
+		Current: newNoteResponse(current),
+	})
+}
+
+func pathID(r *http.Request) (int, error) {
+	return strconv.Atoi(r.PathValue("id"))
+}
+
+// parseIDList parses a comma separated list of ids such as "1,2,3".
+func parseIDList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ",")
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseNoteListParams(q url.Values) (repository.NoteListParams, error) {
+	var err error
+	params := repository.NoteListParams{
+		SortBy: repository.NoteSortField(q.Get("sort")),
+	}
+	if params.SortBy == "" {
+		params.SortBy = repository.NoteSortCreatedAt
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+		params.Desc = true
+	case "asc":
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return params, errors.New("invalid limit")
+		}
+		params.Limit = limit
+	}
+
+	switch q.Get("pinned_first") {
+	case "", "true":
+		params.PinnedFirst = true
+	case "false":
+	default:
+		return params, errors.New("pinned_first must be true or false")
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeNoteCursor(v, params)
+		if err != nil {
+			return params, err
+		}
+		params.After = cursor
+	}
+
+	if v := q.Get("notebook_id"); v != "" {
+		notebookID, err := strconv.Atoi(v)
+		if err != nil {
+			return params, errors.New("invalid notebook_id")
+		}
+		params.NotebookID = &notebookID
+	}
+
+	flags := []struct {
+		key string
+		dst **bool
+	}{
+		{"pinned", &params.Pinned},
+		{"starred", &params.Starred},
+	}
+	for _, f := range flags {
+		v := q.Get(f.key)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return params, fmt.Errorf("invalid %s: expected true or false", f.key)
+		}
+		*f.dst = &b
+	}
+	params.Archived = repository.ArchivedFilter(q.Get("archived"))
+
+	if params.AnyTagIDs, err = parseIDList(q.Get("tags_any")); err != nil {
+		return params, errors.New("invalid tags_any")
+	}
+	if params.AllTagIDs, err = parseIDList(q.Get("tags_all")); err != nil {
+		return params, errors.New("invalid tags_all")
+	}
+
+	bounds := []struct {
+		key string
+		dst **time.Time
+	}{
+		{"created_from", &params.CreatedFrom},
+		{"created_to", &params.CreatedTo},
+		{"updated_from", &params.UpdatedFrom},
+		{"updated_to", &params.UpdatedTo},
+	}
+	for _, b := range bounds {
+		v := q.Get(b.key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return params, fmt.Errorf("invalid %s: expected RFC 3339 timestamp", b.key)
+		}
+		*b.dst = &t
+	}
+
+	return params, nil
+}
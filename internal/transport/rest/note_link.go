@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"net/http"
+
+	"Personal-Notes/internal/repository"
+)
+
+type backlinkListResponse struct {
+	Notes []noteResponse `json:"notes"`
+}
+
+type brokenLinkResponse struct {
+	SourceNoteID int     `json:"source_note_id"`
+	SourceTitle  string  `json:"source_title"`
+	TargetNoteID *int    `json:"target_note_id"`
+	TargetTitle  *string `json:"target_title"`
+}
+
+type brokenLinkListResponse struct {
+	Links []brokenLinkResponse `json:"links"`
+}
+
+func newBrokenLinkResponse(item repository.BrokenLink) brokenLinkResponse {
+	return brokenLinkResponse{
+		SourceNoteID: item.Link.SourceNoteID,
+		SourceTitle:  item.SourceTitle,
+		TargetNoteID: item.Link.TargetNoteID,
+		TargetTitle:  item.Link.TargetTitle,
+	}
+}
+
+// listBacklinks returns the notes linking to a note with [[title]] or
+// [[id:N]]. Clients can use it to offer rewriting the links before a rename.
+func (h *Handler) listBacklinks(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	notes, err := h.services.NoteLink.Backlinks(r.Context(), id, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := backlinkListResponse{Notes: make([]noteResponse, 0, len(notes))}
+	for _, note := range notes {
+		resp.Notes = append(resp.Notes, newNoteResponse(note))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) listBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	links, err := h.services.NoteLink.ListBroken(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := brokenLinkListResponse{Links: make([]brokenLinkResponse, 0, len(links))}
+	for _, link := range links {
+		resp.Links = append(resp.Links, newBrokenLinkResponse(link))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
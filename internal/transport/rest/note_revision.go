@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/internal/service"
+)
+
+type noteRevisionResponse struct {
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title"`
+	Body      *string   `json:"body,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type noteRevisionListResponse struct {
+	Revisions []noteRevisionResponse `json:"revisions"`
+}
+
+type diffSegmentResponse struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type revisionDiffResponse struct {
+	From     int                   `json:"from"`
+	To       int                   `json:"to"`
+	Mode     string                `json:"mode"`
+	Unified  *string               `json:"unified,omitempty"`
+	Segments []diffSegmentResponse `json:"segments,omitempty"`
+}
+
+func newNoteRevisionResponse(revision entity.NoteRevision) noteRevisionResponse {
+	return noteRevisionResponse{
+		Revision:  revision.Revision,
+		Title:     revision.Title,
+		Body:      revision.Body,
+		CreatedAt: revision.CreatedAt,
+	}
+}
+
+func newRevisionDiffResponse(diff service.RevisionDiff) revisionDiffResponse {
+	resp := revisionDiffResponse{
+		From: diff.From,
+		To:   diff.To,
+		Mode: string(diff.Mode),
+	}
+	if diff.Mode == service.DiffModeWord {
+		resp.Segments = make([]diffSegmentResponse, 0, len(diff.Segments))
+		for _, seg := range diff.Segments {
+			resp.Segments = append(resp.Segments, diffSegmentResponse{Op: string(seg.Op), Text: seg.Text})
+		}
+	} else {
+		resp.Unified = &diff.Unified
+	}
+	return resp
+}
+
+func (h *Handler) listNoteRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	revisions, err := h.services.NoteRevision.List(r.Context(), noteID, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := noteRevisionListResponse{Revisions: make([]noteRevisionResponse, 0, len(revisions))}
+	for _, revision := range revisions {
+		resp.Revisions = append(resp.Revisions, newNoteRevisionResponse(revision))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) getNoteRevision(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	revision, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid revision")
+		return
+	}
+
+	resp, err := h.services.NoteRevision.Get(r.Context(), noteID, userID, revision)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newNoteRevisionResponse(resp))
+}
+
+// diffNoteRevisions compares the revisions given by the from and to query
+// parameters. mode is unified (the default) or word.
+func (h *Handler) diffNoteRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	q := r.URL.Query()
+	from, err := strconv.Atoi(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+	to, err := strconv.Atoi(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+
+	diff, err := h.services.NoteRevision.Diff(r.Context(), noteID, userID, from, to, service.DiffMode(q.Get("mode")))
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newRevisionDiffResponse(diff))
+}
+
+func (h *Handler) restoreNoteRevision(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	revision, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid revision")
+		return
+	}
+
+	version, err := expectedNoteVersion(r, nil)
+	if err != nil {
+		writeNoteVersionError(w, err)
+		return
+	}
+
+	note, err := h.services.NoteRevision.Restore(r.Context(), noteID, userID, revision, version)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			writeNoteConflict(w, note)
+			return
+		}
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", noteETag(note))
+	writeJSON(w, http.StatusOK, newNoteResponse(note))
+}
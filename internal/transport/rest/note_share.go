@@ -0,0 +1,173 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/repository"
+)
+
+type inviteNoteShareRequest struct {
+	Email string           `json:"email"`
+	Role  entity.ShareRole `json:"role"`
+}
+
+type updateNoteShareRequest struct {
+	Role entity.ShareRole `json:"role"`
+}
+
+type noteShareResponse struct {
+	UserID    int        `json:"user_id"`
+	Email     string     `json:"email,omitempty"`
+	Role      string     `json:"role"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type noteShareListResponse struct {
+	Shares []noteShareResponse `json:"shares"`
+}
+
+type sharedNoteResponse struct {
+	noteResponse
+	Role string `json:"role"`
+}
+
+type sharedNoteListResponse struct {
+	Notes []sharedNoteResponse `json:"notes"`
+}
+
+func newNoteShareResponse(share entity.NoteShare, email string) noteShareResponse {
+	return noteShareResponse{
+		UserID:    share.UserID,
+		Email:     email,
+		Role:      string(share.Role),
+		CreatedAt: share.CreatedAt,
+		UpdatedAt: share.UpdatedAt,
+	}
+}
+
+func newNoteShareListResponse(items []repository.NoteShareItem) noteShareListResponse {
+	resp := noteShareListResponse{Shares: make([]noteShareResponse, 0, len(items))}
+	for _, item := range items {
+		resp.Shares = append(resp.Shares, newNoteShareResponse(item.Share, item.Email))
+	}
+	return resp
+}
+
+// listSharedNotes returns the notes other users have shared with the caller.
+func (h *Handler) listSharedNotes(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	shared, err := h.services.NoteShare.ListSharedWith(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := sharedNoteListResponse{Notes: make([]sharedNoteResponse, 0, len(shared))}
+	for _, s := range shared {
+		resp.Notes = append(resp.Notes, sharedNoteResponse{
+			noteResponse: newNoteResponse(s.Note),
+			Role:         string(s.Role),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) listNoteShares(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	items, err := h.services.NoteShare.List(r.Context(), noteID, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newNoteShareListResponse(items))
+}
+
+func (h *Handler) inviteNoteShare(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	var req inviteNoteShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	item, err := h.services.NoteShare.Invite(r.Context(), noteID, userID, req.Email, req.Role)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newNoteShareResponse(item.Share, item.Email))
+}
+
+func (h *Handler) updateNoteShare(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	shareUserID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var req updateNoteShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	share, err := h.services.NoteShare.UpdateRole(r.Context(), noteID, userID, shareUserID, req.Role)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newNoteShareResponse(share, ""))
+}
+
+func (h *Handler) revokeNoteShare(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	shareUserID, err := strconv.Atoi(r.PathValue("user_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err := h.services.NoteShare.Revoke(r.Context(), noteID, userID, shareUserID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
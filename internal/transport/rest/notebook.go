@@ -0,0 +1,210 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/service"
+)
+
+type createNotebookRequest struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id"`
+}
+
+type renameNotebookRequest struct {
+	Name string `json:"name"`
+}
+
+type moveNotebookRequest struct {
+	ParentID *int `json:"parent_id"`
+}
+
+type moveNoteRequest struct {
+	NotebookID *int `json:"notebook_id"`
+}
+
+type notebookResponse struct {
+	ID        int        `json:"id"`
+	ParentID  *int       `json:"parent_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type notebookNodeResponse struct {
+	notebookResponse
+	NoteCount int                    `json:"note_count"`
+	Children  []notebookNodeResponse `json:"children"`
+}
+
+type notebookTreeResponse struct {
+	Notebooks []notebookNodeResponse `json:"notebooks"`
+}
+
+func newNotebookResponse(notebook entity.Notebook) notebookResponse {
+	return notebookResponse{
+		ID:        notebook.ID,
+		ParentID:  notebook.ParentID,
+		Name:      notebook.Name,
+		CreatedAt: notebook.CreatedAt,
+		UpdatedAt: notebook.UpdatedAt,
+	}
+}
+
+func newNotebookNodeResponses(nodes []*service.NotebookNode) []notebookNodeResponse {
+	resp := make([]notebookNodeResponse, 0, len(nodes))
+	for _, node := range nodes {
+		resp = append(resp, notebookNodeResponse{
+			notebookResponse: newNotebookResponse(node.Notebook),
+			NoteCount:        node.NoteCount,
+			Children:         newNotebookNodeResponses(node.Children),
+		})
+	}
+	return resp
+}
+
+func (h *Handler) createNotebook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req createNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	notebook, err := h.services.Notebook.Create(r.Context(), entity.Notebook{
+		OwnerID:  userID,
+		ParentID: req.ParentID,
+		Name:     req.Name,
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newNotebookResponse(notebook))
+}
+
+func (h *Handler) getNotebookTree(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	tree, err := h.services.Notebook.Tree(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, notebookTreeResponse{Notebooks: newNotebookNodeResponses(tree)})
+}
+
+func (h *Handler) getNotebook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid notebook id")
+		return
+	}
+
+	notebook, err := h.services.Notebook.GetByID(r.Context(), id, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newNotebookResponse(notebook))
+}
+
+func (h *Handler) renameNotebook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid notebook id")
+		return
+	}
+
+	var req renameNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	notebook, err := h.services.Notebook.Rename(r.Context(), entity.Notebook{
+		ID:      id,
+		OwnerID: userID,
+		Name:    req.Name,
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newNotebookResponse(notebook))
+}
+
+func (h *Handler) moveNotebook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid notebook id")
+		return
+	}
+
+	var req moveNotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.services.Notebook.Move(r.Context(), id, userID, req.ParentID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteNotebook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid notebook id")
+		return
+	}
+
+	if err := h.services.Notebook.Delete(r.Context(), id, userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) moveNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	var req moveNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.services.Notebook.MoveNote(r.Context(), id, userID, req.NotebookID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/internal/service"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+func (h *Handler) handleServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrValidation):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, service.ErrInvalidCredentials.Error())
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		writeError(w, http.StatusUnauthorized, service.ErrInvalidRefreshToken.Error())
+	case errors.Is(err, service.ErrRefreshTokenReused):
+		writeError(w, http.StatusUnauthorized, service.ErrRefreshTokenReused.Error())
+	case errors.Is(err, service.ErrTooManyAttempts):
+		writeError(w, http.StatusTooManyRequests, service.ErrTooManyAttempts.Error())
+	case errors.Is(err, service.ErrTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, repository.ErrQuota):
+		writeError(w, http.StatusRequestEntityTooLarge, repository.ErrQuota.Error())
+	case errors.Is(err, repository.ErrForbidden):
+		writeError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, http.StatusNotFound, "resource not found")
+	case errors.Is(err, repository.ErrAlreadyExist):
+		writeError(w, http.StatusConflict, "resource already exists")
+	case errors.Is(err, repository.ErrConflict):
+		writeError(w, http.StatusConflict, "resource was modified by another request")
+	case errors.Is(err, repository.ErrCycle):
+		writeError(w, http.StatusConflict, "notebook can't be moved into its own subtree")
+	case errors.Is(err, repository.ErrDecrypt):
+		writeError(w, http.StatusInternalServerError, repository.ErrDecrypt.Error())
+	case errors.Is(err, repository.ErrTimeout):
+		writeError(w, http.StatusGatewayTimeout, "request timed out")
+	case errors.Is(err, repository.ErrDB):
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	default:
+		h.logger.Error("fail[http]: unexpected service error",
+			logging.NewField("method", r.Method),
+			logging.NewField("path", logPath(r)),
+			logging.NewField("error", err),
+		)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
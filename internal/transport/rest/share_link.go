@@ -0,0 +1,305 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/repository"
+	"Personal-Notes/internal/service"
+)
+
+const (
+	shareLinkPathPrefix     = "/s/"
+	shareLinkPasswordHeader = "X-Share-Password"
+	maxShareLinkFormBytes   = 4 << 10
+)
+
+var sharePageTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Note}}{{.Note.Title}}{{else}}Shared note{{end}}</title>
+<style>
+body { max-width: 42rem; margin: 2rem auto; padding: 0 1rem; font-family: system-ui, sans-serif; line-height: 1.5; }
+pre { overflow-x: auto; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.25rem 0.5rem; }
+img { max-width: 100%; }
+</style>
+</head>
+<body>
+{{- if .Note}}
+<article>
+<h1>{{.Note.Title}}</h1>
+{{.BodyHTML}}
+</article>
+{{- else if .PasswordRequired}}
+<form method="post">
+<p>This note is protected by a password.</p>
+{{- if .WrongPassword}}
+<p>The password is not correct.</p>
+{{- end}}
+<input type="password" name="password" aria-label="Password" autofocus required>
+<button type="submit">Open</button>
+</form>
+{{- else}}
+<p>{{.Message}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+type createShareLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password"`
+}
+
+type shareLinkResponse struct {
+	ID          int        `json:"id"`
+	Token       string     `json:"token,omitempty"`
+	Path        string     `json:"path,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	HasPassword bool       `json:"has_password"`
+	ViewCount   int64      `json:"view_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+type shareLinkListResponse struct {
+	Links []shareLinkResponse `json:"links"`
+}
+
+type publicNoteResponse struct {
+	Title     string     `json:"title"`
+	Body      *string    `json:"body"`
+	BodyHTML  *string    `json:"body_html,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type sharePageData struct {
+	Note             *publicNoteResponse
+	BodyHTML         template.HTML
+	PasswordRequired bool
+	WrongPassword    bool
+	Message          string
+}
+
+func newShareLinkResponse(link entity.ShareLink) shareLinkResponse {
+	return shareLinkResponse{
+		ID:          link.ID,
+		ExpiresAt:   link.ExpiresAt,
+		HasPassword: link.PasswordHash != nil,
+		ViewCount:   link.ViewCount,
+		CreatedAt:   link.CreatedAt,
+		RevokedAt:   link.RevokedAt,
+	}
+}
+
+func newPublicNoteResponse(note entity.Note) publicNoteResponse {
+	return publicNoteResponse{
+		Title:     note.Title,
+		Body:      note.Body,
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+	}
+}
+
+// createShareLink publishes a note. The token in the response is shown only
+// once; afterwards the link can be listed and revoked by its id.
+func (h *Handler) createShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	var req createShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	link, token, err := h.services.ShareLink.Create(r.Context(), noteID, userID, req.ExpiresAt, req.Password)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := newShareLinkResponse(link)
+	resp.Token = token
+	resp.Path = shareLinkPathPrefix + token
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (h *Handler) listShareLinks(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	links, err := h.services.ShareLink.List(r.Context(), noteID, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := shareLinkListResponse{Links: make([]shareLinkResponse, 0, len(links))}
+	for _, link := range links {
+		resp.Links = append(resp.Links, newShareLinkResponse(link))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) revokeShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	noteID, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	linkID, err := strconv.Atoi(r.PathValue("link_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid link id")
+		return
+	}
+
+	if err := h.services.ShareLink.Revoke(r.Context(), linkID, noteID, userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getPublicNote serves the JSON variant of a public link. The password of a
+// protected link is sent in the X-Share-Password header, ?format=html adds
+// the rendered body.
+func (h *Handler) getPublicNote(w http.ResponseWriter, r *http.Request) {
+	setPublicHeaders(w)
+
+	asHTML, err := parseBodyFormat(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	note, err := h.services.ShareLink.Open(r.Context(), r.PathValue("token"),
+		r.Header.Get(shareLinkPasswordHeader), clientAddr(r))
+	if err != nil {
+		if errors.Is(err, service.ErrShareLinkPassword) {
+			writeError(w, http.StatusUnauthorized, service.ErrShareLinkPassword.Error())
+			return
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "share link not found")
+			return
+		}
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	resp := newPublicNoteResponse(note)
+	if asHTML {
+		html, err := h.services.Note.RenderHTML(note)
+		if err != nil {
+			h.handleServiceError(w, r, err)
+			return
+		}
+		resp.BodyHTML = &html
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// viewSharePage serves the HTML variant of a public link. A protected link
+// shows a password form that posts back to the same URL.
+func (h *Handler) viewSharePage(w http.ResponseWriter, r *http.Request) {
+	setPublicHeaders(w)
+
+	var password string
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxShareLinkFormBytes)
+		if err := r.ParseForm(); err != nil {
+			h.renderSharePage(w, r, http.StatusBadRequest, sharePageData{Message: "The request could not be read."})
+			return
+		}
+		password = r.PostForm.Get("password")
+	}
+
+	note, err := h.services.ShareLink.Open(r.Context(), r.PathValue("token"), password, clientAddr(r))
+	var html string
+	if err == nil {
+		html, err = h.services.Note.RenderHTML(note)
+	}
+	switch {
+	case err == nil:
+		resp := newPublicNoteResponse(note)
+		// html is sanitized by the renderer and must not be escaped again.
+		h.renderSharePage(w, r, http.StatusOK, sharePageData{Note: &resp, BodyHTML: template.HTML(html)})
+	case errors.Is(err, service.ErrShareLinkPassword):
+		h.renderSharePage(w, r, http.StatusUnauthorized, sharePageData{
+			PasswordRequired: true,
+			WrongPassword:    password != "",
+		})
+	case errors.Is(err, service.ErrTooManyAttempts):
+		h.renderSharePage(w, r, http.StatusTooManyRequests, sharePageData{
+			Message: "Too many attempts. Try again in a minute.",
+		})
+	case errors.Is(err, repository.ErrNotFound):
+		h.renderSharePage(w, r, http.StatusNotFound, sharePageData{Message: "This link is not available."})
+	default:
+		h.logger.Error("fail[http]: failed to open share link",
+			logging.NewField("method", r.Method),
+			logging.NewField("path", logPath(r)),
+			logging.NewField("error", err),
+		)
+		h.renderSharePage(w, r, http.StatusInternalServerError, sharePageData{Message: "Something went wrong."})
+	}
+}
+
+func (h *Handler) renderSharePage(w http.ResponseWriter, r *http.Request, status int, data sharePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := sharePageTemplate.Execute(w, data); err != nil {
+		h.logger.Error("fail[http]: failed to render share page",
+			logging.NewField("path", logPath(r)),
+			logging.NewField("error", err),
+		)
+	}
+}
+
+// clientAddr returns the address a request came from, without its port.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// setPublicHeaders keeps public pages out of caches and search engines and
+// stops the token in the URL from leaking through the Referer header.
+func setPublicHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:; form-action 'self'")
+}
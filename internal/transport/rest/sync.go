@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/logging"
+	"Personal-Notes/internal/service"
+)
+
+// syncRequest carries the cursor of the client's last sync, zero on the
+// first one, and the mutations it made since.
+type syncRequest struct {
+	Cursor    int64                 `json:"cursor"`
+	Mutations []syncMutationRequest `json:"mutations"`
+}
+
+// syncMutationRequest is a create, update or delete of a note. Creates use
+// the note fields, updates the note id, version, title and body, deletes the
+// note id and version. A create needs a client_id unique among the client's
+// creates, so one sent again returns the note it made the first time.
+type syncMutationRequest struct {
+	ClientID   string            `json:"client_id"`
+	Op         entity.ChangeKind `json:"op"`
+	NoteID     int               `json:"note_id"`
+	Version    int               `json:"version"`
+	NotebookID *int              `json:"notebook_id"`
+	Title      string            `json:"title"`
+	Body       *string           `json:"body"`
+	Encrypted  bool              `json:"encrypted"`
+	NoteKey    []byte            `json:"note_key"`
+}
+
+type syncResultResponse struct {
+	ClientID string             `json:"client_id"`
+	Status   service.SyncStatus `json:"status"`
+	Note     *noteResponse      `json:"note"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// syncChangeResponse is the latest change of a note. Note is null for a
+// tombstone.
+type syncChangeResponse struct {
+	Seq       int64             `json:"seq"`
+	Op        entity.ChangeKind `json:"op"`
+	NoteID    int               `json:"note_id"`
+	ChangedAt time.Time         `json:"changed_at"`
+	Note      *noteResponse     `json:"note"`
+}
+
+// syncResponse has a result for each mutation applied. A sync the server
+// can't finish still answers with the results so far and has_more set; the
+// mutations without a result weren't applied and go in the next sync.
+type syncResponse struct {
+	Cursor  int64                `json:"cursor"`
+	HasMore bool                 `json:"has_more"`
+	Results []syncResultResponse `json:"results"`
+	Changes []syncChangeResponse `json:"changes"`
+}
+
+func (req syncMutationRequest) mutation() service.SyncMutation {
+	return service.SyncMutation{
+		ClientID: req.ClientID,
+		Kind:     req.Op,
+		Note: entity.Note{
+			ID:         req.NoteID,
+			NotebookID: req.NotebookID,
+			Title:      req.Title,
+			Body:       req.Body,
+			Version:    req.Version,
+			Encrypted:  req.Encrypted,
+			NoteKey:    req.NoteKey,
+		},
+	}
+}
+
+// sync applies a batch of offline mutations and returns the server changes
+// since the client's cursor.
+func (h *Handler) sync(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	mutations := make([]service.SyncMutation, 0, len(req.Mutations))
+	for _, m := range req.Mutations {
+		mutations = append(mutations, m.mutation())
+	}
+
+	batch, err := h.services.Sync.Sync(r.Context(), userID, req.Cursor, mutations)
+	if err != nil && len(batch.Results) == 0 {
+		h.handleServiceError(w, r, err)
+		return
+	}
+	if err != nil {
+		h.logger.Warn("fail[http]: sync stopped after some mutations were applied",
+			logging.NewField("user_id", userID),
+			logging.NewField("applied", len(batch.Results)),
+			logging.NewField("mutations", len(mutations)),
+			logging.NewField("error", err),
+		)
+		batch.HasMore = true
+	}
+
+	resp := syncResponse{
+		Cursor:  batch.Cursor,
+		HasMore: batch.HasMore,
+		Results: make([]syncResultResponse, 0, len(batch.Results)),
+		Changes: make([]syncChangeResponse, 0, len(batch.Changes)),
+	}
+	for _, result := range batch.Results {
+		resp.Results = append(resp.Results, syncResultResponse{
+			ClientID: result.ClientID,
+			Status:   result.Status,
+			Note:     optionalNoteResponse(result.Note),
+			Error:    result.Error,
+		})
+	}
+	for _, change := range batch.Changes {
+		resp.Changes = append(resp.Changes, syncChangeResponse{
+			Seq:       change.Change.Seq,
+			Op:        change.Change.Kind,
+			NoteID:    change.Change.NoteID,
+			ChangedAt: change.Change.CreatedAt,
+			Note:      optionalNoteResponse(change.Note),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func optionalNoteResponse(note *entity.Note) *noteResponse {
+	if note == nil {
+		return nil
+	}
+	resp := newNoteResponse(*note)
+	return &resp
+}
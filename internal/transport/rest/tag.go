@@ -0,0 +1,210 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/entity"
+	"Personal-Notes/internal/repository"
+)
+
+type tagRequest struct {
+	Name string `json:"name"`
+}
+
+type mergeTagRequest struct {
+	Into int `json:"into"`
+}
+
+type noteTagsRequest struct {
+	TagIDs []int `json:"tag_ids"`
+}
+
+type tagResponse struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type tagListResponse struct {
+	Tags []tagResponse `json:"tags"`
+}
+
+type tagCountResponse struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func newTagResponse(tag entity.Tag) tagResponse {
+	return tagResponse{
+		ID:        tag.ID,
+		Name:      tag.Name,
+		CreatedAt: tag.CreatedAt,
+		UpdatedAt: tag.UpdatedAt,
+	}
+}
+
+func newTagListResponse(tags []entity.Tag) tagListResponse {
+	resp := tagListResponse{Tags: make([]tagResponse, 0, len(tags))}
+	for _, tag := range tags {
+		resp.Tags = append(resp.Tags, newTagResponse(tag))
+	}
+	return resp
+}
+
+func newTagCountResponses(counts []repository.TagCount) []tagCountResponse {
+	resp := make([]tagCountResponse, 0, len(counts))
+	for _, tc := range counts {
+		resp = append(resp, tagCountResponse{
+			ID:    tc.Tag.ID,
+			Name:  tc.Tag.Name,
+			Count: tc.Count,
+		})
+	}
+	return resp
+}
+
+func (h *Handler) createTag(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	tag, err := h.services.Tag.Create(r.Context(), entity.Tag{
+		OwnerID: userID,
+		Name:    req.Name,
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newTagResponse(tag))
+}
+
+func (h *Handler) listTags(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	tags, err := h.services.Tag.List(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newTagListResponse(tags))
+}
+
+func (h *Handler) renameTag(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tag id")
+		return
+	}
+
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	tag, err := h.services.Tag.Rename(r.Context(), entity.Tag{
+		ID:      id,
+		OwnerID: userID,
+		Name:    req.Name,
+	})
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newTagResponse(tag))
+}
+
+func (h *Handler) mergeTag(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tag id")
+		return
+	}
+
+	var req mergeTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.services.Tag.Merge(r.Context(), id, req.Into, userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteTag(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tag id")
+		return
+	}
+
+	if err := h.services.Tag.Delete(r.Context(), id, userID); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getNoteTags(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	tags, err := h.services.Tag.ListByNoteID(r.Context(), id, userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newTagListResponse(tags))
+}
+
+func (h *Handler) setNoteTags(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+
+	var req noteTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.services.Tag.SetNoteTags(r.Context(), id, userID, req.TagIDs); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/entity"
+)
+
+type userResponse struct {
+	ID             int        `json:"id"`
+	Name           string     `json:"name"`
+	Email          string     `json:"email"`
+	SearchLanguage string     `json:"search_language"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastLoginAt    *time.Time `json:"last_login_at"`
+}
+
+type searchLanguageRequest struct {
+	Language string `json:"language"`
+}
+
+func newUserResponse(user entity.User) userResponse {
+	return userResponse{
+		ID:             user.ID,
+		Name:           user.Name,
+		Email:          user.Email,
+		SearchLanguage: user.SearchLanguage,
+		CreatedAt:      user.CreatedAt,
+		LastLoginAt:    user.LastLoginAt,
+	}
+}
+
+func (h *Handler) getMe(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	user, err := h.services.User.GetByID(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+func (h *Handler) updateSearchLanguage(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req searchLanguageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.services.User.UpdateSearchLanguage(r.Context(), userID, req.Language); err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Personal-Notes/internal/entity"
+)
+
+// userKeyRequest is the user key envelope as produced by the e2ee client
+// package. The byte fields are base64 encoded.
+type userKeyRequest struct {
+	KDF         string `json:"kdf"`
+	Salt        []byte `json:"salt"`
+	Memory      int    `json:"memory"`
+	Iterations  int    `json:"iterations"`
+	Parallelism int    `json:"parallelism"`
+	WrappedKey  []byte `json:"wrapped_key"`
+}
+
+type userKeyResponse struct {
+	KDF         string     `json:"kdf"`
+	Salt        []byte     `json:"salt"`
+	Memory      int        `json:"memory"`
+	Iterations  int        `json:"iterations"`
+	Parallelism int        `json:"parallelism"`
+	WrappedKey  []byte     `json:"wrapped_key"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+func newUserKeyResponse(key entity.UserKey) userKeyResponse {
+	return userKeyResponse{
+		KDF:         key.KDF,
+		Salt:        key.KDFSalt,
+		Memory:      key.KDFMemory,
+		Iterations:  key.KDFIterations,
+		Parallelism: key.KDFParallelism,
+		WrappedKey:  key.WrappedKey,
+		CreatedAt:   key.CreatedAt,
+		UpdatedAt:   key.UpdatedAt,
+	}
+}
+
+func (req userKeyRequest) userKey(userID int) entity.UserKey {
+	return entity.UserKey{
+		UserID:         userID,
+		KDF:            req.KDF,
+		KDFSalt:        req.Salt,
+		KDFMemory:      req.Memory,
+		KDFIterations:  req.Iterations,
+		KDFParallelism: req.Parallelism,
+		WrappedKey:     req.WrappedKey,
+	}
+}
+
+func (h *Handler) getUserKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	key, err := h.services.UserKey.Get(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserKeyResponse(key))
+}
+
+func (h *Handler) createUserKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req userKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, err := h.services.UserKey.Create(r.Context(), req.userKey(userID))
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newUserKeyResponse(key))
+}
+
+// updateUserKey replaces the envelope after a passphrase change. The client
+// must wrap the same user key, or its encrypted notes can't be read anymore.
+func (h *Handler) updateUserKey(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+
+	var req userKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, err := h.services.UserKey.Update(r.Context(), req.userKey(userID))
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserKeyResponse(key))
+}
@@ -0,0 +1,87 @@
+package wikilink
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTitleLength matches the maximum length of a note title.
+const MaxTitleLength = 255
+
+var (
+	linkPattern = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+	idPattern   = regexp.MustCompile(`^id:([0-9]{1,9})$`)
+)
+
+// Link is a reference from a note body to another note, written either as
+// [[Note Title]] or as [[id:123]]. Both forms may carry a label after a pipe,
+// as in [[Note Title|label]]. Exactly one of TargetID and TargetTitle is set.
+type Link struct {
+	TargetID    *int
+	TargetTitle *string
+}
+
+// Parse returns the links in body in order of first appearance. Title links
+// differing only in case are the same link.
+func Parse(body string) []Link {
+	var links []Link
+	seenIDs := make(map[int]bool)
+	seenTitles := make(map[string]bool)
+
+	for _, match := range linkPattern.FindAllStringSubmatch(body, -1) {
+		target, _ := splitLabel(match[1])
+		if target == "" || utf8.RuneCountInString(target) > MaxTitleLength {
+			continue
+		}
+
+		if m := idPattern.FindStringSubmatch(target); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			if !seenIDs[id] {
+				seenIDs[id] = true
+				links = append(links, Link{TargetID: &id})
+			}
+			continue
+		}
+
+		key := strings.ToLower(target)
+		if !seenTitles[key] {
+			seenTitles[key] = true
+			links = append(links, Link{TargetTitle: &target})
+		}
+	}
+	return links
+}
+
+// RenameTitle rewrites the title links to oldTitle in body so that they point
+// to newTitle, keeping their labels. It returns the new body and the number
+// of rewritten links.
+func RenameTitle(body string, oldTitle string, newTitle string) (string, int) {
+	oldTitle = strings.TrimSpace(oldTitle)
+	newTitle = strings.TrimSpace(newTitle)
+
+	count := 0
+	renamed := linkPattern.ReplaceAllStringFunc(body, func(link string) string {
+		target, label := splitLabel(link[2 : len(link)-2])
+		if !strings.EqualFold(target, oldTitle) {
+			return link
+		}
+		count++
+		if label != "" {
+			return "[[" + newTitle + "|" + label + "]]"
+		}
+		return "[[" + newTitle + "]]"
+	})
+	return renamed, count
+}
+
+// ValidTitle reports whether a link to title can be written as [[title]].
+func ValidTitle(title string) bool {
+	return !strings.ContainsAny(title, "[]|\n") && !idPattern.MatchString(strings.TrimSpace(title))
+}
+
+func splitLabel(inner string) (string, string) {
+	target, label, _ := strings.Cut(inner, "|")
+	return strings.TrimSpace(target), label
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Personal-Notes/internal/logging"
+)
+
+type JobFunc func(ctx context.Context) error
+
+type Runner struct {
+	// stopping is cancelled when Stop is called, jobs when its deadline
+	// passes.
+	stopping   context.Context
+	stop       context.CancelFunc
+	jobs       context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+	logger     logging.Logger
+}
+
+func NewRunner(logger logging.Logger) *Runner {
+	stopping, stop := context.WithCancel(context.Background())
+	jobs, cancelJobs := context.WithCancel(context.Background())
+	return &Runner{
+		stopping:   stopping,
+		stop:       stop,
+		jobs:       jobs,
+		cancelJobs: cancelJobs,
+		logger:     logger,
+	}
+}
+
+// Every runs job once per interval until the runner is stopped. A run that
+// is in progress when Stop is called is left to finish; its context is only
+// cancelled if it is still running when the deadline of Stop passes.
+func (r *Runner) Every(name string, interval time.Duration, job JobFunc) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		r.logger.Info("init[worker]: job scheduled",
+			logging.NewField("job", name),
+			logging.NewField("interval", interval),
+		)
+
+		for {
+			select {
+			case <-r.stopping.Done():
+				return
+			case <-ticker.C:
+				// A tick that came in along with Stop doesn't start a run.
+				if r.stopping.Err() != nil {
+					return
+				}
+				r.run(r.jobs, name, job)
+			}
+		}
+	}()
+}
+
+// Go runs a long-lived job, such as a listener, once. It gets a context that
+// is cancelled when the runner is stopped and should return then.
+func (r *Runner) Go(name string, job JobFunc) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		r.logger.Info("init[worker]: job started", logging.NewField("job", name))
+		r.run(r.stopping, name, job)
+	}()
+}
+
+func (r *Runner) run(ctx context.Context, name string, job JobFunc) {
+	start := time.Now()
+
+	if err := job(ctx); err != nil {
+		r.logger.Error("fail[worker]: job failed",
+			logging.NewField("job", name),
+			logging.NewField("duration", time.Since(start)),
+			logging.NewField("error", err),
+		)
+		return
+	}
+
+	r.logger.Debug("done[worker]: job finished",
+		logging.NewField("job", name),
+		logging.NewField("duration", time.Since(start)),
+	)
+}
+
+// Stop stops scheduling runs, cancels the long-lived jobs and waits for the
+// runs in progress to finish. Those still running when ctx expires are
+// cancelled and ctx's error is returned.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.stop()
+	defer r.cancelJobs()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
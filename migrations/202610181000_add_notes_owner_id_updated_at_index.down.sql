@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_notes_owner_id_created_at;
+DROP INDEX IF EXISTS idx_notes_owner_id_updated_at;
@@ -0,0 +1,2 @@
+CREATE INDEX idx_notes_owner_id_updated_at ON notes (owner_id, updated_at);
+CREATE INDEX idx_notes_owner_id_created_at ON notes (owner_id, created_at);
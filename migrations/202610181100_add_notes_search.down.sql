@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS search_language;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS search_language;
@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN search_language REGCONFIG NOT NULL DEFAULT 'simple';
+
+ALTER TABLE notes
+    ADD COLUMN search_language REGCONFIG NOT NULL DEFAULT 'simple';
+
+UPDATE notes n
+SET search_language = u.search_language
+FROM users u
+WHERE u.id = n.owner_id;
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector(search_language, title), 'A') ||
+        setweight(to_tsvector(search_language, COALESCE(body, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
@@ -0,0 +1,23 @@
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    owner_id INT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP,
+    CONSTRAINT fk_tags_owner_id
+        FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT uq_tags_owner_id_name
+        UNIQUE (owner_id, name)
+);
+
+CREATE TABLE note_tags (
+    note_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (note_id, tag_id),
+    CONSTRAINT fk_note_tags_note_id
+        FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_tags_tag_id
+        FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_note_tags_tag_id ON note_tags (tag_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_notes_notebook_id;
+
+ALTER TABLE notes
+    DROP CONSTRAINT IF EXISTS fk_notes_notebook_id,
+    DROP COLUMN IF EXISTS notebook_id;
+
+DROP TABLE IF EXISTS notebooks;
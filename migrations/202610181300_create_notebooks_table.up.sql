@@ -0,0 +1,23 @@
+CREATE TABLE notebooks (
+    id SERIAL PRIMARY KEY,
+    owner_id INT NOT NULL,
+    parent_id INT,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP,
+    CONSTRAINT fk_notebooks_owner_id
+        FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_notebooks_parent_id
+        FOREIGN KEY (parent_id) REFERENCES notebooks(id) ON DELETE CASCADE,
+    CONSTRAINT chk_notebooks_parent_id_not_self
+        CHECK (parent_id <> id)
+);
+
+CREATE INDEX idx_notebooks_owner_id_parent_id ON notebooks (owner_id, parent_id);
+
+ALTER TABLE notes
+    ADD COLUMN notebook_id INT,
+    ADD CONSTRAINT fk_notes_notebook_id
+        FOREIGN KEY (notebook_id) REFERENCES notebooks(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_notes_notebook_id ON notes (notebook_id);
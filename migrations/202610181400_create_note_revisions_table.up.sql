@@ -0,0 +1,19 @@
+CREATE TABLE note_revisions (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    revision INT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_note_revisions_note_id
+        FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT uq_note_revisions_note_id_revision
+        UNIQUE (note_id, revision)
+);
+
+CREATE INDEX idx_note_revisions_created_at ON note_revisions (created_at);
+
+INSERT INTO note_revisions (note_id, owner_id, revision, title, body, created_at)
+SELECT id, owner_id, 1, title, body, COALESCE(updated_at, created_at)
+FROM notes;
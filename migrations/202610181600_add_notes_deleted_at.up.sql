@@ -0,0 +1,4 @@
+ALTER TABLE notes
+    ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_notes_deleted_at ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_notes_owner_id_starred_at;
+DROP INDEX IF EXISTS idx_notes_owner_id_pinned_at;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS starred_at,
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS pinned_at;
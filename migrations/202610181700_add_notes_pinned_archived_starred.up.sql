@@ -0,0 +1,7 @@
+ALTER TABLE notes
+    ADD COLUMN pinned_at TIMESTAMP,
+    ADD COLUMN archived_at TIMESTAMP,
+    ADD COLUMN starred_at TIMESTAMP;
+
+CREATE INDEX idx_notes_owner_id_pinned_at ON notes (owner_id, pinned_at) WHERE pinned_at IS NOT NULL;
+CREATE INDEX idx_notes_owner_id_starred_at ON notes (owner_id, starred_at) WHERE starred_at IS NOT NULL;
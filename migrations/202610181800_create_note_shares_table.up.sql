@@ -0,0 +1,16 @@
+CREATE TABLE note_shares (
+    note_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP,
+    PRIMARY KEY (note_id, user_id),
+    CONSTRAINT fk_note_shares_note_id
+        FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_shares_user_id
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_note_shares_role
+        CHECK (role IN ('viewer', 'commenter', 'editor'))
+);
+
+CREATE INDEX idx_note_shares_user_id ON note_shares (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE share_links (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    password_hash TEXT,
+    expires_at TIMESTAMP,
+    view_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    CONSTRAINT fk_share_links_note_id
+        FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_share_links_owner_id
+        FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_share_links_note_id ON share_links (note_id);
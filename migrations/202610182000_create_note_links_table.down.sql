@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_notes_owner_id_lower_title;
+DROP TABLE IF EXISTS note_links;
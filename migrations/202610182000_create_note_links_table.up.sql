@@ -0,0 +1,34 @@
+CREATE TABLE note_links (
+    id SERIAL PRIMARY KEY,
+    source_note_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    target_note_id INT,
+    target_title VARCHAR(255),
+    CONSTRAINT fk_note_links_source_note_id
+        FOREIGN KEY (source_note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_links_owner_id
+        FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_note_links_target
+        CHECK ((target_note_id IS NULL) <> (target_title IS NULL))
+);
+
+-- target_note_id has no foreign key on purpose: a link to a purged note is
+-- kept and reported as broken.
+CREATE INDEX idx_note_links_source_note_id ON note_links (source_note_id);
+CREATE INDEX idx_note_links_target_note_id ON note_links (target_note_id) WHERE target_note_id IS NOT NULL;
+CREATE INDEX idx_note_links_owner_id_target_title ON note_links (owner_id, lower(target_title))
+    WHERE target_title IS NOT NULL;
+CREATE INDEX idx_notes_owner_id_lower_title ON notes (owner_id, lower(title)) WHERE deleted_at IS NULL;
+
+-- Backfill the links of existing notes, parsed the same way as the
+-- application does.
+INSERT INTO note_links (source_note_id, owner_id, target_note_id, target_title)
+SELECT DISTINCT n.id, n.owner_id,
+    CASE WHEN r.ref ~ '^id:[0-9]{1,9}$' THEN substr(r.ref, 4)::int END,
+    CASE WHEN r.ref !~ '^id:[0-9]{1,9}$' THEN r.ref END
+FROM notes n,
+    LATERAL (
+        SELECT btrim(split_part(m[1], '|', 1)) AS ref
+        FROM regexp_matches(n.body, '\[\[([^\[\]\n]+)\]\]', 'g') AS m
+    ) r
+WHERE n.body IS NOT NULL AND r.ref <> '' AND char_length(r.ref) <= 255;
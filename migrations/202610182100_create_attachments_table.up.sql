@@ -0,0 +1,23 @@
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    -- note_id and owner_id are cleared when the note or its owner is deleted,
+    -- which leaves the row for the garbage collector to delete the blob.
+    note_id INT,
+    owner_id INT,
+    blob_key VARCHAR(128) UNIQUE NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    sha256 CHAR(64),
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    CONSTRAINT fk_attachments_note_id
+        FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE SET NULL,
+    CONSTRAINT fk_attachments_owner_id
+        FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_attachments_note_id ON attachments (note_id);
+CREATE INDEX idx_attachments_owner_id ON attachments (owner_id) WHERE completed_at IS NOT NULL;
+CREATE INDEX idx_attachments_orphaned ON attachments (id)
+    WHERE note_id IS NULL OR owner_id IS NULL OR completed_at IS NULL;
@@ -0,0 +1,27 @@
+-- Encrypted notes can't be kept without their keys, so they go first.
+DELETE FROM notes WHERE encrypted;
+
+ALTER TABLE note_revisions
+    ALTER COLUMN title TYPE VARCHAR(255);
+
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE notes
+    DROP CONSTRAINT IF EXISTS chk_notes_title_length,
+    DROP CONSTRAINT IF EXISTS chk_notes_note_key,
+    DROP COLUMN IF EXISTS note_key,
+    DROP COLUMN IF EXISTS encrypted,
+    ALTER COLUMN title TYPE VARCHAR(255);
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector(search_language, title), 'A') ||
+        setweight(to_tsvector(search_language, COALESCE(body, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
+
+DROP TABLE IF EXISTS user_keys;
@@ -0,0 +1,43 @@
+CREATE TABLE user_keys (
+    user_id INT PRIMARY KEY,
+    kdf VARCHAR(32) NOT NULL,
+    kdf_salt BYTEA NOT NULL,
+    kdf_memory INT NOT NULL,
+    kdf_iterations INT NOT NULL,
+    kdf_parallelism SMALLINT NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP,
+    CONSTRAINT fk_user_keys_user_id
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- The title of an encrypted note is ciphertext, which is longer than the
+-- plaintext limit. The generated search vector depends on the title, so it is
+-- dropped while the type changes and comes back empty for encrypted notes.
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN search_vector;
+
+ALTER TABLE notes
+    ALTER COLUMN title TYPE TEXT,
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN note_key BYTEA,
+    ADD CONSTRAINT chk_notes_note_key
+        CHECK ((note_key IS NOT NULL) = encrypted),
+    ADD CONSTRAINT chk_notes_title_length
+        CHECK (encrypted OR char_length(title) <= 255);
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN encrypted THEN ''::tsvector ELSE
+            setweight(to_tsvector(search_language, title), 'A') ||
+            setweight(to_tsvector(search_language, COALESCE(body, '')), 'B')
+        END
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
+
+ALTER TABLE note_revisions
+    ALTER COLUMN title TYPE TEXT;
@@ -0,0 +1,44 @@
+-- Encrypted bodies can only be decrypted by the application, so refuse to
+-- drop them.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM notes WHERE body_key_id IS NOT NULL)
+        OR EXISTS (SELECT 1 FROM note_revisions WHERE body_key_id IS NOT NULL) THEN
+        RAISE EXCEPTION 'note bodies are encrypted at rest';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_note_revisions_plain_body;
+
+ALTER TABLE note_revisions
+    DROP CONSTRAINT IF EXISTS chk_note_revisions_body_ciphertext,
+    DROP CONSTRAINT IF EXISTS fk_note_revisions_body_key_id,
+    DROP COLUMN IF EXISTS body_key_id,
+    DROP COLUMN IF EXISTS body_ciphertext;
+
+DROP INDEX IF EXISTS idx_notes_plain_body;
+DROP INDEX IF EXISTS idx_notes_body_key_id;
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE notes
+    DROP CONSTRAINT IF EXISTS chk_notes_body_ciphertext,
+    DROP CONSTRAINT IF EXISTS fk_notes_body_key_id,
+    DROP COLUMN IF EXISTS body_search_language,
+    DROP COLUMN IF EXISTS body_search,
+    DROP COLUMN IF EXISTS body_key_id,
+    DROP COLUMN IF EXISTS body_ciphertext;
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN encrypted THEN ''::tsvector ELSE
+            setweight(to_tsvector(search_language, title), 'A') ||
+            setweight(to_tsvector(search_language, COALESCE(body, '')), 'B')
+        END
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
+
+DROP TABLE IF EXISTS data_keys;
@@ -0,0 +1,49 @@
+CREATE TABLE data_keys (
+    id SERIAL PRIMARY KEY,
+    master_key_version INT NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    rewrapped_at TIMESTAMP
+);
+
+CREATE INDEX idx_data_keys_master_key_version ON data_keys (master_key_version);
+
+-- An encrypted body is stored in body_ciphertext under the data key
+-- body_key_id, with body left NULL. The database can't index it any more, so
+-- the application writes its lexemes to body_search instead.
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN search_vector;
+
+ALTER TABLE notes
+    ADD COLUMN body_ciphertext BYTEA,
+    ADD COLUMN body_key_id INT,
+    ADD COLUMN body_search TSVECTOR,
+    ADD COLUMN body_search_language REGCONFIG,
+    ADD CONSTRAINT fk_notes_body_key_id
+        FOREIGN KEY (body_key_id) REFERENCES data_keys(id),
+    ADD CONSTRAINT chk_notes_body_ciphertext
+        CHECK ((body_ciphertext IS NULL) = (body_key_id IS NULL) AND (body IS NULL OR body_key_id IS NULL));
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN encrypted THEN ''::tsvector ELSE
+            setweight(to_tsvector(search_language, title), 'A') ||
+            setweight(COALESCE(body_search, to_tsvector(search_language, COALESCE(body, ''))), 'B')
+        END
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
+CREATE INDEX idx_notes_body_key_id ON notes (body_key_id) WHERE body_key_id IS NOT NULL;
+CREATE INDEX idx_notes_plain_body ON notes (id) WHERE body IS NOT NULL;
+
+ALTER TABLE note_revisions
+    ADD COLUMN body_ciphertext BYTEA,
+    ADD COLUMN body_key_id INT,
+    ADD CONSTRAINT fk_note_revisions_body_key_id
+        FOREIGN KEY (body_key_id) REFERENCES data_keys(id),
+    ADD CONSTRAINT chk_note_revisions_body_ciphertext
+        CHECK ((body_ciphertext IS NULL) = (body_key_id IS NULL) AND (body IS NULL OR body_key_id IS NULL));
+
+CREATE INDEX idx_note_revisions_plain_body ON note_revisions (id) WHERE body IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS changes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS change_seq;
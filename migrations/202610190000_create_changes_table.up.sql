@@ -0,0 +1,34 @@
+-- change_seq is the last sequence number handed out in the user's change
+-- feed. Taking the next one locks the user row until commit, so the changes
+-- of a user become visible in sequence order.
+ALTER TABLE users
+    ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+
+-- A change outlives its note: the delete of a purged note stays as a
+-- tombstone for clients that have not synced since.
+CREATE TABLE changes (
+    user_id INT NOT NULL,
+    seq BIGINT NOT NULL,
+    note_id INT NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, seq),
+    CONSTRAINT fk_changes_user_id
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_changes_kind
+        CHECK (kind IN ('create', 'update', 'delete'))
+);
+
+-- Existing notes start the feed, so a first sync returns all of them.
+INSERT INTO changes (user_id, seq, note_id, kind, created_at)
+SELECT owner_id,
+    ROW_NUMBER() OVER (PARTITION BY owner_id ORDER BY id),
+    id,
+    CASE WHEN deleted_at IS NULL THEN 'create' ELSE 'delete' END,
+    COALESCE(deleted_at, updated_at, created_at)
+FROM notes;
+
+UPDATE users u
+SET change_seq = c.seq
+FROM (SELECT user_id, MAX(seq) AS seq FROM changes GROUP BY user_id) c
+WHERE c.user_id = u.id;
@@ -0,0 +1,5 @@
+-- Drops the changes of notes the user doesn't own. Purged notes are gone from
+-- notes, so their changes stay; the sequence numbers are left as they are.
+DELETE FROM changes c
+USING notes n
+WHERE n.id = c.note_id AND n.owner_id <> c.user_id;
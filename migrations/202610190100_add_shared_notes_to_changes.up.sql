@@ -0,0 +1,17 @@
+-- Notes shared with a user join their change feed, so a next sync or event
+-- stream picks them up like the user's own.
+INSERT INTO changes (user_id, seq, note_id, kind, created_at)
+SELECT s.user_id,
+    u.change_seq + ROW_NUMBER() OVER (PARTITION BY s.user_id ORDER BY s.note_id),
+    s.note_id,
+    'create',
+    s.created_at
+FROM note_shares s
+JOIN users u ON u.id = s.user_id
+JOIN notes n ON n.id = s.note_id
+WHERE n.deleted_at IS NULL;
+
+UPDATE users u
+SET change_seq = c.seq
+FROM (SELECT user_id, MAX(seq) AS seq FROM changes GROUP BY user_id) c
+WHERE c.user_id = u.id;
@@ -0,0 +1,19 @@
+-- The collaborative editing state of a note body in the pkg/crdt encoding,
+-- encrypted under the data key state_key_id when that is set. The body in
+-- notes is materialized from it every so often; base_version is the note
+-- version whose body the marked text of the state matches. generation is
+-- bumped by every write, so a stale writer can't overwrite a newer state.
+CREATE TABLE note_documents (
+    note_id INT PRIMARY KEY,
+    state BYTEA NOT NULL,
+    state_key_id INT,
+    base_version INT NOT NULL,
+    generation BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_note_documents_note_id
+        FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_documents_state_key_id
+        FOREIGN KEY (state_key_id) REFERENCES data_keys(id)
+);
+
+CREATE INDEX idx_note_documents_plain_state ON note_documents (note_id) WHERE state_key_id IS NULL;
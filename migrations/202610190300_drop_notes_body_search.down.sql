@@ -0,0 +1,20 @@
+-- The lexemes of encrypted bodies are gone; they are rebuilt as each body is
+-- written again.
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE notes
+    ADD COLUMN body_search TSVECTOR,
+    ADD COLUMN body_search_language REGCONFIG;
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN encrypted THEN ''::tsvector ELSE
+            setweight(to_tsvector(search_language, title), 'A') ||
+            setweight(COALESCE(body_search, to_tsvector(search_language, COALESCE(body, ''))), 'B')
+        END
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
@@ -0,0 +1,22 @@
+-- body_search held the lexemes and positions of every body encrypted at rest,
+-- which gave its words away to anyone reading the database or a backup.
+-- Encrypted bodies aren't indexed any more: search matches the titles of
+-- those notes only.
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN search_vector;
+
+ALTER TABLE notes
+    DROP COLUMN body_search,
+    DROP COLUMN body_search_language;
+
+ALTER TABLE notes
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN encrypted THEN ''::tsvector ELSE
+            setweight(to_tsvector(search_language, title), 'A') ||
+            setweight(to_tsvector(search_language, COALESCE(body, '')), 'B')
+        END
+    ) STORED;
+
+CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector);
@@ -0,0 +1,13 @@
+-- The note each create synced by a client made, by the id the client gave
+-- the create, so a create sent again after a lost response returns the note
+-- instead of making another. A purged note keeps its row, so the create isn't
+-- replayed either.
+CREATE TABLE sync_creates (
+    user_id INT NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    note_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, client_id),
+    CONSTRAINT fk_sync_creates_user_id
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
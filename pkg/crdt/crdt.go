@@ -0,0 +1,443 @@
+// Package crdt is the text CRDT behind collaborative editing of note bodies,
+// shared by the server and Go clients. It is a replicated growable array
+// (RGA): every character, one Unicode code point, gets an ID that never
+// changes and is inserted after the character it was typed behind. Replicas
+// that apply the same inserts and deletes end up with the same text whatever
+// order concurrent ones arrive in, as long as each update comes after the
+// updates it builds on.
+//
+// IDs are Lamport timestamps: a replica stamps an insert with a clock higher
+// than any it has seen, and the peer number the server handed its session
+// breaks ties. Deleted characters stay as tombstones so later inserts can
+// still refer to them.
+package crdt
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ServerPeer is the peer of the server's own edits, such as merging a body
+// written outside collaborative editing. Sessions get peers from 1 up.
+const ServerPeer uint32 = 0
+
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// ID identifies a character. The zero ID stands for the start of the text.
+type ID struct {
+	Peer  uint32 `json:"peer"`
+	Clock uint64 `json:"clock"`
+}
+
+func (id ID) IsZero() bool {
+	return id == ID{}
+}
+
+// greater orders concurrent inserts after the same character: the later
+// clock goes first, ties broken by the higher peer.
+func (id ID) greater(other ID) bool {
+	if id.Clock != other.Clock {
+		return id.Clock > other.Clock
+	}
+	return id.Peer > other.Peer
+}
+
+// Insert puts Text after the character After. The characters of Text get
+// the IDs of ID's peer with consecutive clocks from ID.Clock, each following
+// the one before.
+type Insert struct {
+	ID    ID     `json:"id"`
+	After ID     `json:"after"`
+	Text  string `json:"text"`
+}
+
+// Span is Len characters of one peer with consecutive clocks from ID.Clock.
+type Span struct {
+	ID  ID     `json:"id"`
+	Len uint64 `json:"len"`
+}
+
+func (s Span) contains(id ID) bool {
+	return id.Peer == s.ID.Peer && id.Clock >= s.ID.Clock && id.Clock-s.ID.Clock < s.Len
+}
+
+// Update is a batch of edits: the inserts in order, then the deletes.
+type Update struct {
+	Inserts []Insert `json:"inserts,omitempty"`
+	Deletes []Span   `json:"deletes,omitempty"`
+}
+
+func (u Update) IsEmpty() bool {
+	return len(u.Inserts) == 0 && len(u.Deletes) == 0
+}
+
+type item struct {
+	id      ID
+	r       rune
+	deleted bool
+	// base marks the characters of the text last marked with Mark.
+	base bool
+}
+
+// Doc is a replica of a text. It is not safe for concurrent use.
+type Doc struct {
+	items []item
+	// clocks holds the highest clock of each peer, so a peer can't reuse
+	// an ID.
+	clocks map[uint32]uint64
+	clock  uint64
+	peers  uint32
+}
+
+func New() *Doc {
+	return &Doc{clocks: make(map[uint32]uint64)}
+}
+
+// FromText returns a document holding text as the server's edit, marked.
+func FromText(text string) *Doc {
+	d := New()
+	if text != "" {
+		// A valid string after the start of an empty document always
+		// applies.
+		_ = d.Apply(Update{Inserts: []Insert{{ID: ID{Peer: ServerPeer, Clock: 1}, Text: text}}})
+	}
+	d.Mark()
+	return d
+}
+
+// Text returns the text without the deleted characters.
+func (d *Doc) Text() string {
+	runes := make([]rune, 0, len(d.items))
+	for _, it := range d.items {
+		if !it.deleted {
+			runes = append(runes, it.r)
+		}
+	}
+	return string(runes)
+}
+
+// Size returns the number of characters kept, deleted ones included.
+func (d *Doc) Size() int {
+	return len(d.items)
+}
+
+// Clone returns a copy of the document.
+func (d *Doc) Clone() *Doc {
+	return &Doc{
+		items:  slices.Clone(d.items),
+		clocks: maps.Clone(d.clocks),
+		clock:  d.clock,
+		peers:  d.peers,
+	}
+}
+
+// Clock returns the highest clock in the document. A replica stamps its
+// next insert with a higher one.
+func (d *Doc) Clock() uint64 {
+	return d.clock
+}
+
+// NewPeer hands out the next unused peer number.
+func (d *Doc) NewPeer() uint32 {
+	d.peers++
+	return d.peers
+}
+
+// Changed reports whether the text differs from the one last marked.
+func (d *Doc) Changed() bool {
+	for _, it := range d.items {
+		if it.base == it.deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// Mark records the current text as the base that Merge diffs against.
+func (d *Doc) Mark() {
+	for i := range d.items {
+		d.items[i].base = !d.items[i].deleted
+	}
+}
+
+// Apply applies u, or nothing if any part of it is invalid: an insert whose
+// ID isn't newer than its peer's last one or than the character it follows,
+// or that follows a character the document doesn't have, or a delete of a
+// character it doesn't have.
+func (d *Doc) Apply(u Update) error {
+	if err := d.validate(u); err != nil {
+		return err
+	}
+
+	for _, ins := range u.Inserts {
+		pos := 0
+		if !ins.After.IsZero() {
+			pos = d.find(ins.After) + 1
+		}
+		for pos < len(d.items) && d.items[pos].id.greater(ins.ID) {
+			pos++
+		}
+
+		runes := []rune(ins.Text)
+		added := make([]item, len(runes))
+		for i, r := range runes {
+			added[i] = item{id: ID{Peer: ins.ID.Peer, Clock: ins.ID.Clock + uint64(i)}, r: r}
+		}
+		d.items = slices.Insert(d.items, pos, added...)
+
+		last := ins.ID.Clock + uint64(len(runes)) - 1
+		d.clocks[ins.ID.Peer] = last
+		d.clock = max(d.clock, last)
+	}
+
+	if len(u.Deletes) > 0 {
+		spans := spansByPeer(u.Deletes)
+		for i := range d.items {
+			for _, j := range spans[d.items[i].id.Peer] {
+				if u.Deletes[j].contains(d.items[i].id) {
+					d.items[i].deleted = true
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Doc) validate(u Update) error {
+	// The spans inserted so far, which later inserts and the deletes may
+	// refer to.
+	var added []Span
+	exists := func(id ID) bool {
+		for _, s := range added {
+			if s.contains(id) {
+				return true
+			}
+		}
+		return d.find(id) >= 0
+	}
+	clocks := make(map[uint32]uint64)
+
+	for i, ins := range u.Inserts {
+		if ins.Text == "" || !utf8.ValidString(ins.Text) {
+			return fmt.Errorf("%w: insert %d: text must be non-empty UTF-8", ErrInvalidUpdate, i)
+		}
+		last, ok := clocks[ins.ID.Peer]
+		if !ok {
+			last = d.clocks[ins.ID.Peer]
+		}
+		if ins.ID.Clock <= last || ins.ID.Clock <= ins.After.Clock {
+			return fmt.Errorf("%w: insert %d: clock %d is not new", ErrInvalidUpdate, i, ins.ID.Clock)
+		}
+		if !ins.After.IsZero() && !exists(ins.After) {
+			return fmt.Errorf("%w: insert %d: unknown character %d@%d",
+				ErrInvalidUpdate, i, ins.After.Clock, ins.After.Peer)
+		}
+
+		n := uint64(utf8.RuneCountInString(ins.Text))
+		clocks[ins.ID.Peer] = ins.ID.Clock + n - 1
+		added = append(added, Span{ID: ins.ID, Len: n})
+	}
+
+	if len(u.Deletes) == 0 {
+		return nil
+	}
+	for i, span := range u.Deletes {
+		if span.Len == 0 {
+			return fmt.Errorf("%w: delete %d: empty span", ErrInvalidUpdate, i)
+		}
+	}
+
+	// The characters of each span, counted in one pass over the document.
+	found := make([]uint64, len(u.Deletes))
+	spans := spansByPeer(u.Deletes)
+	for _, it := range d.items {
+		for _, j := range spans[it.id.Peer] {
+			if u.Deletes[j].contains(it.id) {
+				found[j]++
+			}
+		}
+	}
+	for i, span := range u.Deletes {
+		for _, s := range added {
+			found[i] += overlap(span, s)
+		}
+		if found[i] != span.Len {
+			return fmt.Errorf("%w: delete %d: unknown characters", ErrInvalidUpdate, i)
+		}
+	}
+	return nil
+}
+
+// spansByPeer returns the indexes of spans by the peer they belong to.
+func spansByPeer(spans []Span) map[uint32][]int {
+	byPeer := make(map[uint32][]int)
+	for i, s := range spans {
+		byPeer[s.ID.Peer] = append(byPeer[s.ID.Peer], i)
+	}
+	return byPeer
+}
+
+func overlap(a, b Span) uint64 {
+	if a.ID.Peer != b.ID.Peer {
+		return 0
+	}
+	lo := max(a.ID.Clock, b.ID.Clock)
+	hi := min(a.ID.Clock+a.Len, b.ID.Clock+b.Len)
+	if hi <= lo {
+		return 0
+	}
+	return hi - lo
+}
+
+func (d *Doc) find(id ID) int {
+	for i, it := range d.items {
+		if it.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// InsertText types text at rune position pos of the text as peer and
+// returns the applied update for the other replicas.
+func (d *Doc) InsertText(peer uint32, pos int, text string) (Update, error) {
+	var after ID
+	if pos > 0 {
+		i := d.visible(pos - 1)
+		if i < 0 {
+			return Update{}, fmt.Errorf("%w: position %d is past the end", ErrInvalidUpdate, pos)
+		}
+		after = d.items[i].id
+	}
+
+	u := Update{Inserts: []Insert{{ID: ID{Peer: peer, Clock: d.clock + 1}, After: after, Text: text}}}
+	if err := d.Apply(u); err != nil {
+		return Update{}, err
+	}
+	return u, nil
+}
+
+// DeleteText deletes n runes of the text from position pos and returns the
+// applied update for the other replicas.
+func (d *Doc) DeleteText(pos int, n int) (Update, error) {
+	start := d.visible(pos)
+	if n <= 0 || start < 0 || d.visible(pos+n-1) < 0 {
+		return Update{}, fmt.Errorf("%w: %d characters from position %d are out of range", ErrInvalidUpdate, n, pos)
+	}
+
+	var u Update
+	for i := start; n > 0; i++ {
+		if !d.items[i].deleted {
+			u.Deletes = appendSpan(u.Deletes, d.items[i].id)
+			n--
+		}
+	}
+	if err := d.Apply(u); err != nil {
+		return Update{}, err
+	}
+	return u, nil
+}
+
+// visible returns the index of the character at rune position pos of the
+// text, or -1 if the text is shorter.
+func (d *Doc) visible(pos int) int {
+	if pos < 0 {
+		return -1
+	}
+	for i, it := range d.items {
+		if it.deleted {
+			continue
+		}
+		if pos == 0 {
+			return i
+		}
+		pos--
+	}
+	return -1
+}
+
+// Merge brings in text, an edit of the marked text made outside the
+// document, as the server's update, keeping the edits made in the document
+// since it was marked. The inserted text and what's left of the marked one
+// become the new mark, so the mark again matches text. The applied update is
+// returned for the other replicas.
+func (d *Doc) Merge(text string) Update {
+	var base []int
+	var baseRunes []rune
+	for i, it := range d.items {
+		if it.base {
+			base = append(base, i)
+			baseRunes = append(baseRunes, it.r)
+		}
+	}
+
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMainRunes(baseRunes, []rune(text), false)
+
+	var u Update
+	clock := d.clock
+	pos := 0
+	for _, diff := range diffs {
+		n := utf8.RuneCountInString(diff.Text)
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			pos += n
+		case diffmatchpatch.DiffDelete:
+			for _, i := range base[pos : pos+n] {
+				u.Deletes = appendSpan(u.Deletes, d.items[i].id)
+			}
+			pos += n
+		case diffmatchpatch.DiffInsert:
+			var after ID
+			if pos > 0 {
+				after = d.items[base[pos-1]].id
+			}
+			u.Inserts = append(u.Inserts, Insert{
+				ID:    ID{Peer: ServerPeer, Clock: clock + 1},
+				After: after,
+				Text:  diff.Text,
+			})
+			clock += uint64(n)
+		}
+	}
+	if u.IsEmpty() {
+		return u
+	}
+
+	// The update refers to characters of the document only and its clocks
+	// are newer than any in it, so it applies.
+	_ = d.Apply(u)
+
+	for i := range d.items {
+		it := &d.items[i]
+		for _, ins := range u.Inserts {
+			if (Span{ID: ins.ID, Len: uint64(utf8.RuneCountInString(ins.Text))}).contains(it.id) {
+				it.base = true
+			}
+		}
+		for _, span := range u.Deletes {
+			if span.contains(it.id) {
+				it.base = false
+			}
+		}
+	}
+	return u
+}
+
+// appendSpan adds id to spans, extending the last span if id follows it.
+func appendSpan(spans []Span, id ID) []Span {
+	if n := len(spans); n > 0 {
+		last := &spans[n-1]
+		if last.ID.Peer == id.Peer && last.ID.Clock+last.Len == id.Clock {
+			last.Len++
+			return spans
+		}
+	}
+	return append(spans, Span{ID: id, Len: 1})
+}
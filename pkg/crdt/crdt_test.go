@@ -0,0 +1,391 @@
+package crdt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// edit is a local edit of a replica: an insert of text at pos, or a delete
+// of n characters from pos when text is empty.
+type edit struct {
+	pos  int
+	text string
+	n    int
+}
+
+func (e edit) apply(t *testing.T, d *Doc, peer uint32) Update {
+	t.Helper()
+
+	var (
+		u   Update
+		err error
+	)
+	if e.text != "" {
+		u, err = d.InsertText(peer, e.pos, e.text)
+	} else {
+		u, err = d.DeleteText(e.pos, e.n)
+	}
+	if err != nil {
+		t.Fatalf("peer %d: %+v: %v", peer, e, err)
+	}
+	return u
+}
+
+// replicas returns n replicas of a document holding base, as sessions get
+// it when they join.
+func replicas(t *testing.T, base string, n int) []*Doc {
+	t.Helper()
+
+	state := FromText(base).Encode()
+	docs := make([]*Doc, n)
+	for i := range docs {
+		d, err := Decode(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[i] = d
+	}
+	return docs
+}
+
+// permutations returns every order of 0..n-1.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var perms [][]int
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			perm := append(append(append([]int{}, p[:i]...), n-1), p[i:]...)
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+func TestConcurrentEditsConverge(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		edits [][]edit // edits[i] are made by peer i+1, in order
+		want  string
+	}{
+		{
+			name:  "inserts at the same place order by peer",
+			base:  "ac",
+			edits: [][]edit{{{pos: 1, text: "b"}}, {{pos: 1, text: "x"}}},
+			want:  "axbc",
+		},
+		{
+			name:  "inserts into an empty text",
+			base:  "",
+			edits: [][]edit{{{pos: 0, text: "hello"}}, {{pos: 0, text: "world"}}},
+			want:  "worldhello",
+		},
+		{
+			name: "the later clock goes first",
+			base: "ac",
+			edits: [][]edit{
+				{{pos: 2, text: "zz"}, {pos: 1, text: "b"}},
+				{{pos: 1, text: "x"}},
+			},
+			want: "abxczz",
+		},
+		{
+			name:  "insert into deleted text",
+			base:  "hello",
+			edits: [][]edit{{{pos: 1, n: 3}}, {{pos: 2, text: "X"}}},
+			want:  "hXo",
+		},
+		{
+			name:  "overlapping deletes",
+			base:  "hello",
+			edits: [][]edit{{{pos: 0, n: 2}}, {{pos: 1, n: 2}}},
+			want:  "lo",
+		},
+		{
+			name: "insert after a character deleted concurrently",
+			base: "abc",
+			edits: [][]edit{
+				{{pos: 1, n: 1}},
+				{{pos: 2, text: "123"}, {pos: 4, n: 1}},
+			},
+			want: "a12c",
+		},
+		{
+			name: "three replicas",
+			base: "abc",
+			edits: [][]edit{
+				{{pos: 0, text: "1"}},
+				{{pos: 1, n: 1}},
+				{{pos: 3, text: "2"}, {pos: 0, text: "0"}},
+			},
+			want: "01ac2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := len(tt.edits)
+			for _, order := range permutations(n) {
+				docs := replicas(t, tt.base, n)
+				updates := make([][]Update, n)
+				for i, edits := range tt.edits {
+					for _, e := range edits {
+						updates[i] = append(updates[i], e.apply(t, docs[i], uint32(i+1)))
+					}
+				}
+
+				// Every replica gets the others' updates, each replica's in
+				// the order it made them, the replicas in order.
+				for i, d := range docs {
+					for _, from := range order {
+						if from == i {
+							continue
+						}
+						for _, u := range updates[from] {
+							if err := d.Apply(u); err != nil {
+								t.Fatalf("order %v: replica %d applying update of %d: %v", order, i+1, from+1, err)
+							}
+						}
+					}
+					if got := d.Text(); got != tt.want {
+						t.Fatalf("order %v: replica %d has %q, want %q", order, i+1, got, tt.want)
+					}
+				}
+				for i := 1; i < n; i++ {
+					if !bytes.Equal(docs[i].Encode(), docs[0].Encode()) {
+						t.Fatalf("order %v: replicas 1 and %d differ", order, i+1)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRejectsInvalidUpdates(t *testing.T) {
+	server := func(clock uint64) ID { return ID{Peer: ServerPeer, Clock: clock} }
+	peer := func(clock uint64) ID { return ID{Peer: 1, Clock: clock} }
+
+	tests := []struct {
+		name string
+		u    Update
+	}{
+		{"empty text", Update{Inserts: []Insert{{ID: peer(4), After: server(3)}}}},
+		{"invalid UTF-8", Update{Inserts: []Insert{{ID: peer(4), After: server(3), Text: "\xff"}}}},
+		{"reused clock", Update{Inserts: []Insert{{ID: server(2), After: server(3), Text: "x"}}}},
+		{"clock not after the character", Update{Inserts: []Insert{{ID: peer(2), After: server(3), Text: "x"}}}},
+		{"unknown character", Update{Inserts: []Insert{{ID: peer(9), After: ID{Peer: 5, Clock: 1}, Text: "x"}}}},
+		{"clock reused within the update", Update{Inserts: []Insert{
+			{ID: peer(4), After: server(3), Text: "xy"},
+			{ID: peer(5), After: server(1), Text: "z"},
+		}}},
+		{"empty delete", Update{Deletes: []Span{{ID: server(1)}}}},
+		{"delete of an unknown character", Update{Deletes: []Span{{ID: ID{Peer: 5, Clock: 1}, Len: 1}}}},
+		{"delete past the known characters", Update{Deletes: []Span{{ID: server(2), Len: 5}}}},
+		{"valid insert before an invalid delete", Update{
+			Inserts: []Insert{{ID: peer(4), After: server(3), Text: "x"}},
+			Deletes: []Span{{ID: peer(4), Len: 2}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := FromText("abc")
+			before := d.Encode()
+
+			if err := d.Apply(tt.u); !errors.Is(err, ErrInvalidUpdate) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidUpdate)
+			}
+			if !bytes.Equal(d.Encode(), before) {
+				t.Fatalf("a rejected update changed the document to %q", d.Text())
+			}
+		})
+	}
+
+	t.Run("insert and delete of it in one update", func(t *testing.T) {
+		d := FromText("abc")
+		u := Update{
+			Inserts: []Insert{{ID: peer(4), After: server(3), Text: "xy"}},
+			Deletes: []Span{{ID: peer(4), Len: 1}, {ID: server(1), Len: 1}},
+		}
+		if err := d.Apply(u); err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Text(); got != "bcy" {
+			t.Fatalf("got %q, want %q", got, "bcy")
+		}
+	})
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  func(t *testing.T) *Doc
+	}{
+		{"empty", func(*testing.T) *Doc { return New() }},
+		{"from text", func(*testing.T) *Doc { return FromText("héllo, 世界") }},
+		{"edited by peers", func(t *testing.T) *Doc {
+			d := FromText("hello world")
+			edit{pos: 5, text: " big"}.apply(t, d, d.NewPeer())
+			edit{pos: 0, text: "¡"}.apply(t, d, d.NewPeer())
+			return d
+		}},
+		{"tombstones", func(t *testing.T) *Doc {
+			d := FromText("hello")
+			edit{pos: 5, text: " world"}.apply(t, d, d.NewPeer())
+			// One deleted run in the marked text, kept for Merge, and one
+			// typed since, whose text is dropped.
+			edit{pos: 0, n: 2}.apply(t, d, 1)
+			edit{pos: 4, n: 3}.apply(t, d, 1)
+			return d
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.doc(t)
+			state := d.Encode()
+
+			got, err := Decode(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Text() != d.Text() || got.Clock() != d.Clock() || got.Changed() != d.Changed() {
+				t.Fatalf("decoded %q at clock %d changed %t, want %q at clock %d changed %t",
+					got.Text(), got.Clock(), got.Changed(), d.Text(), d.Clock(), d.Changed())
+			}
+			if !bytes.Equal(got.Encode(), state) {
+				t.Fatal("encoding the decoded document gives another state")
+			}
+			if got.NewPeer() != d.NewPeer() {
+				t.Fatal("decoded document hands out another peer")
+			}
+
+			// Both go on the same from here.
+			u := edit{pos: 0, text: "x"}.apply(t, d, 1)
+			if err := got.Apply(u); err != nil {
+				t.Fatal(err)
+			}
+			if got.Text() != d.Text() {
+				t.Fatalf("after an edit decoded %q, want %q", got.Text(), d.Text())
+			}
+			got.Merge("merged")
+			d.Merge("merged")
+			if got.Text() != d.Text() {
+				t.Fatalf("after a merge decoded %q, want %q", got.Text(), d.Text())
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsMalformedState(t *testing.T) {
+	valid := FromText("hello").Encode()
+
+	tests := []struct {
+		name  string
+		state []byte
+	}{
+		{"empty", nil},
+		{"unknown version", append([]byte{Version + 1}, valid[1:]...)},
+		{"truncated", valid[:len(valid)-2]},
+		{"run without text", valid[:len(valid)-6]},
+		{"zero clock", []byte{Version, 0, 1, 0, 0, 1, 0, 1, 'a'}},
+		{"text shorter than the run", []byte{Version, 0, 1, 0, 1, 2, 0, 1, 'a'}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.state); !errors.Is(err, ErrMalformed) {
+				t.Fatalf("got %v, want %v", err, ErrMalformed)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		// edits are made in the document since it was marked at base.
+		base  string
+		edits []edit
+		// text is the body as written outside the document, an edit of base.
+		text string
+		want string
+	}{
+		{
+			name:  "no change outside",
+			base:  "hello world",
+			edits: []edit{{pos: 5, text: " big"}},
+			text:  "hello world",
+			want:  "hello big world",
+		},
+		{
+			name:  "edits on both sides",
+			base:  "hello world",
+			edits: []edit{{pos: 5, text: " big"}},
+			text:  "hello world!",
+			want:  "hello big world!",
+		},
+		{
+			name:  "delete outside next to an edit",
+			base:  "alpha beta gamma",
+			edits: []edit{{pos: 10, text: "!"}},
+			text:  "beta gamma",
+			want:  "beta! gamma",
+		},
+		{
+			name:  "delete on both sides",
+			base:  "abcdef",
+			edits: []edit{{pos: 1, n: 2}},
+			text:  "abef",
+			want:  "aef",
+		},
+		{
+			name: "everything replaced outside",
+			base: "old",
+			text: "new",
+			want: "new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := replicas(t, tt.base, 2)
+			server, session := docs[0], docs[1]
+			for _, e := range tt.edits {
+				u := e.apply(t, session, 1)
+				if err := server.Apply(u); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			u := server.Merge(tt.text)
+			if got := server.Text(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for _, ins := range u.Inserts {
+				if ins.ID.Peer != ServerPeer {
+					t.Fatalf("merge inserted as peer %d", ins.ID.Peer)
+				}
+			}
+
+			// The participants get the merge as an update.
+			if err := session.Apply(u); err != nil {
+				t.Fatal(err)
+			}
+			if session.Text() != server.Text() {
+				t.Fatalf("session has %q after the merge, want %q", session.Text(), server.Text())
+			}
+
+			// The mark now matches text, so merging it again changes nothing.
+			if again := server.Merge(tt.text); !again.IsEmpty() {
+				t.Fatalf("merging the same text again gave %+v", again)
+			}
+			if server.Changed() != (tt.want != tt.text) {
+				t.Fatalf("changed is %t with %q against %q", server.Changed(), tt.want, tt.text)
+			}
+		})
+	}
+}
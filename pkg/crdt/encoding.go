@@ -0,0 +1,172 @@
+package crdt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Version is the format version in the first byte of an encoded document.
+const Version byte = 1
+
+const (
+	flagDeleted byte = 1 << iota
+	flagBase
+)
+
+var ErrMalformed = errors.New("malformed document")
+
+// Encode returns the document in its compact form: the version byte, the
+// number of peers handed out and the number of runs as uvarints, then the
+// runs in text order. A run is characters of one peer with consecutive
+// clocks and the same flags: its peer, first clock and length as uvarints, a
+// flags byte and, unless the characters are deleted and not marked, the
+// length of their UTF-8 text as a uvarint followed by the text. Typed text
+// makes long runs, and the text of tombstones isn't kept.
+func (d *Doc) Encode() []byte {
+	type run struct {
+		start, end int
+		flags      byte
+	}
+	var runs []run
+	for i, it := range d.items {
+		flags := it.flags()
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			prev := d.items[i-1].id
+			if last.flags == flags && prev.Peer == it.id.Peer && prev.Clock+1 == it.id.Clock {
+				last.end = i + 1
+				continue
+			}
+		}
+		runs = append(runs, run{start: i, end: i + 1, flags: flags})
+	}
+
+	buf := []byte{Version}
+	buf = binary.AppendUvarint(buf, uint64(d.peers))
+	buf = binary.AppendUvarint(buf, uint64(len(runs)))
+	for _, r := range runs {
+		first := d.items[r.start].id
+		buf = binary.AppendUvarint(buf, uint64(first.Peer))
+		buf = binary.AppendUvarint(buf, first.Clock)
+		buf = binary.AppendUvarint(buf, uint64(r.end-r.start))
+		buf = append(buf, r.flags)
+		if r.flags&flagDeleted != 0 && r.flags&flagBase == 0 {
+			continue
+		}
+		var text []byte
+		for _, it := range d.items[r.start:r.end] {
+			text = utf8.AppendRune(text, it.r)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(text)))
+		buf = append(buf, text...)
+	}
+	return buf
+}
+
+func (it item) flags() byte {
+	var flags byte
+	if it.deleted {
+		flags |= flagDeleted
+	}
+	if it.base {
+		flags |= flagBase
+	}
+	return flags
+}
+
+// Decode reads a document written by Encode.
+func Decode(data []byte) (*Doc, error) {
+	if len(data) == 0 || data[0] != Version {
+		return nil, fmt.Errorf("%w: unknown version", ErrMalformed)
+	}
+	r := reader{data: data[1:]}
+
+	d := New()
+	d.peers = uint32(r.uvarint())
+	runs := r.uvarint()
+	for range runs {
+		if r.err != nil {
+			break
+		}
+		peer := uint32(r.uvarint())
+		clock := r.uvarint()
+		n := r.uvarint()
+		flags := r.byte()
+		if r.err != nil || n == 0 || clock == 0 {
+			return nil, fmt.Errorf("%w: bad run", ErrMalformed)
+		}
+
+		var text []rune
+		if flags&flagDeleted == 0 || flags&flagBase != 0 {
+			text = []rune(string(r.bytes(r.uvarint())))
+			if uint64(len(text)) != n {
+				return nil, fmt.Errorf("%w: run text doesn't match its length", ErrMalformed)
+			}
+		}
+		for i := range n {
+			it := item{
+				id:      ID{Peer: peer, Clock: clock + i},
+				deleted: flags&flagDeleted != 0,
+				base:    flags&flagBase != 0,
+			}
+			if text != nil {
+				it.r = text[i]
+			}
+			d.items = append(d.items, it)
+		}
+
+		last := clock + n - 1
+		d.clocks[peer] = max(d.clocks[peer], last)
+		d.clock = max(d.clock, last)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return d, nil
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad uvarint", ErrMalformed)
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = fmt.Errorf("%w: truncated", ErrMalformed)
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)) < n {
+		r.err = fmt.Errorf("%w: truncated", ErrMalformed)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
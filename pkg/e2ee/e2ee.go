@@ -0,0 +1,319 @@
+// Package e2ee is the reference client for end-to-end encrypted notes. The
+// server only ever stores what this package produces: ciphertext for the
+// title and body of a note, the note's key wrapped by the user key, and the
+// user key wrapped by a key derived from the user's passphrase.
+//
+// Every sealed value is a version byte, a random 24 byte nonce and the
+// XChaCha20-Poly1305 ciphertext with its tag. The associated data binds a
+// value to its purpose, so a title can't be swapped for a body and a note
+// key can't be passed off as a user key. Titles and bodies travel as
+// standard base64 strings, wrapped keys as raw bytes.
+package e2ee
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// Version is the format version in the first byte of every sealed value.
+	Version byte = 1
+
+	KeySize   = chacha20poly1305.KeySize
+	NonceSize = chacha20poly1305.NonceSizeX
+	Overhead  = 1 + NonceSize + chacha20poly1305.Overhead
+
+	// WrappedKeySize is the size of a wrapped user or note key.
+	WrappedKeySize = Overhead + KeySize
+
+	KDFArgon2id = "argon2id"
+	SaltSize    = 16
+
+	// The default argon2id parameters follow the second recommendation of
+	// RFC 9106: 64 MiB of memory and three passes.
+	DefaultMemory      = 64 * 1024
+	DefaultIterations  = 3
+	DefaultParallelism = 4
+
+	// Envelopes outside these bounds are refused, so a tampered envelope
+	// can't make a client spend unbounded time or memory.
+	MinMemory      = 19 * 1024
+	MaxMemory      = 4 * 1024 * 1024
+	MaxIterations  = 16
+	MaxParallelism = 16
+)
+
+var (
+	ErrWrongPassphrase = errors.New("e2ee: wrong passphrase")
+	ErrDecrypt         = errors.New("e2ee: message authentication failed")
+	ErrFormat          = errors.New("e2ee: malformed ciphertext")
+	ErrEnvelope        = errors.New("e2ee: unsupported key envelope")
+)
+
+var (
+	adUserKey = []byte("personal-notes/user-key")
+	adNoteKey = []byte("personal-notes/note-key")
+	adTitle   = []byte("personal-notes/note-title")
+	adBody    = []byte("personal-notes/note-body")
+)
+
+// Envelope is the user key envelope the server keeps for a user. It holds
+// everything needed to unlock the user key except the passphrase.
+type Envelope struct {
+	KDF         string `json:"kdf"`
+	Salt        []byte `json:"salt"`
+	Memory      uint32 `json:"memory"`
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint8  `json:"parallelism"`
+	WrappedKey  []byte `json:"wrapped_key"`
+}
+
+// Validate checks that the envelope uses a supported KDF with parameters
+// within bounds and holds a wrapped key of the right size.
+func (e Envelope) Validate() error {
+	switch {
+	case e.KDF != KDFArgon2id:
+		return fmt.Errorf("%w: kdf %q", ErrEnvelope, e.KDF)
+	case len(e.Salt) < SaltSize || len(e.Salt) > 4*SaltSize:
+		return fmt.Errorf("%w: salt must be %d to %d bytes", ErrEnvelope, SaltSize, 4*SaltSize)
+	case e.Memory < MinMemory || e.Memory > MaxMemory:
+		return fmt.Errorf("%w: memory must be %d to %d KiB", ErrEnvelope, MinMemory, MaxMemory)
+	case e.Iterations < 1 || e.Iterations > MaxIterations:
+		return fmt.Errorf("%w: iterations must be 1 to %d", ErrEnvelope, MaxIterations)
+	case e.Parallelism < 1 || e.Parallelism > MaxParallelism:
+		return fmt.Errorf("%w: parallelism must be 1 to %d", ErrEnvelope, MaxParallelism)
+	case !ValidWrappedKey(e.WrappedKey):
+		return fmt.Errorf("%w: wrapped key", ErrEnvelope)
+	}
+	return nil
+}
+
+// UserKey encrypts the keys of a user's notes. It never leaves the client
+// unwrapped.
+type UserKey struct {
+	aead cipher.AEAD
+	key  []byte
+}
+
+// NewUserKey generates a user key and wraps it with passphrase. The returned
+// envelope is what the server stores.
+func NewUserKey(passphrase string) (*UserKey, Envelope, error) {
+	key, err := randomBytes(KeySize)
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+	k, err := newUserKey(key)
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+	env, err := k.Wrap(passphrase)
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+	return k, env, nil
+}
+
+// Unlock unwraps the user key in env with passphrase. A wrong passphrase and
+// a tampered envelope both give ErrWrongPassphrase.
+func Unlock(passphrase string, env Envelope) (*UserKey, error) {
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	kek, err := chacha20poly1305.NewX(deriveKey(passphrase, env))
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(kek, env.WrappedKey, adUserKey)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return newUserKey(key)
+}
+
+// Wrap returns a new envelope of the key under passphrase with a fresh salt
+// and the default parameters. Changing the passphrase only needs a new
+// envelope: the user key and therefore the note keys stay the same.
+func (k *UserKey) Wrap(passphrase string) (Envelope, error) {
+	salt, err := randomBytes(SaltSize)
+	if err != nil {
+		return Envelope{}, err
+	}
+	env := Envelope{
+		KDF:         KDFArgon2id,
+		Salt:        salt,
+		Memory:      DefaultMemory,
+		Iterations:  DefaultIterations,
+		Parallelism: DefaultParallelism,
+	}
+	kek, err := chacha20poly1305.NewX(deriveKey(passphrase, env))
+	if err != nil {
+		return Envelope{}, err
+	}
+	env.WrappedKey, err = seal(kek, k.key, adUserKey)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return env, nil
+}
+
+// NewNoteKey generates the key of a new note and returns it together with
+// its wrapped form, which is sent to the server along with the note.
+func (k *UserKey) NewNoteKey() (*NoteKey, []byte, error) {
+	key, err := randomBytes(KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := seal(k.aead, key, adNoteKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nk, err := newNoteKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nk, wrapped, nil
+}
+
+// OpenNoteKey unwraps the note key the server returned with a note.
+func (k *UserKey) OpenNoteKey(wrapped []byte) (*NoteKey, error) {
+	if !ValidWrappedKey(wrapped) {
+		return nil, ErrFormat
+	}
+	key, err := open(k.aead, wrapped, adNoteKey)
+	if err != nil {
+		return nil, err
+	}
+	return newNoteKey(key)
+}
+
+// NoteKey encrypts the title and body of one note.
+type NoteKey struct {
+	aead cipher.AEAD
+}
+
+// EncryptNote returns the ciphertext of title and body. A nil body stays nil.
+func (k *NoteKey) EncryptNote(title string, body *string) (string, *string, error) {
+	encTitle, err := k.encrypt(title, adTitle)
+	if err != nil {
+		return "", nil, err
+	}
+	if body == nil {
+		return encTitle, nil, nil
+	}
+	encBody, err := k.encrypt(*body, adBody)
+	if err != nil {
+		return "", nil, err
+	}
+	return encTitle, &encBody, nil
+}
+
+// DecryptNote reverses EncryptNote.
+func (k *NoteKey) DecryptNote(title string, body *string) (string, *string, error) {
+	decTitle, err := k.decrypt(title, adTitle)
+	if err != nil {
+		return "", nil, err
+	}
+	if body == nil {
+		return decTitle, nil, nil
+	}
+	decBody, err := k.decrypt(*body, adBody)
+	if err != nil {
+		return "", nil, err
+	}
+	return decTitle, &decBody, nil
+}
+
+func (k *NoteKey) encrypt(plaintext string, ad []byte) (string, error) {
+	sealed, err := seal(k.aead, []byte(plaintext), ad)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *NoteKey) decrypt(ciphertext string, ad []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || !validSealed(sealed) {
+		return "", ErrFormat
+	}
+	plaintext, err := open(k.aead, sealed, ad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ValidCiphertext reports whether s has the form of an encrypted title or
+// body. It can't tell whether s decrypts.
+func ValidCiphertext(s string) bool {
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	return err == nil && validSealed(sealed)
+}
+
+// ValidWrappedKey reports whether b has the form of a wrapped key.
+func ValidWrappedKey(b []byte) bool {
+	return len(b) == WrappedKeySize && b[0] == Version
+}
+
+// CiphertextLen returns the length of the ciphertext of an n byte plaintext.
+func CiphertextLen(n int) int {
+	return base64.StdEncoding.EncodedLen(Overhead + n)
+}
+
+func newUserKey(key []byte) (*UserKey, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return &UserKey{aead: aead, key: key}, nil
+}
+
+func newNoteKey(key []byte) (*NoteKey, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return &NoteKey{aead: aead}, nil
+}
+
+func deriveKey(passphrase string, env Envelope) []byte {
+	return argon2.IDKey([]byte(passphrase), env.Salt, env.Iterations, env.Memory, env.Parallelism, KeySize)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte, ad []byte) ([]byte, error) {
+	out := make([]byte, 1+NonceSize, Overhead+len(plaintext))
+	out[0] = Version
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, out[1:], plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, ad []byte) ([]byte, error) {
+	if !validSealed(sealed) {
+		return nil, ErrFormat
+	}
+	plaintext, err := aead.Open(nil, sealed[1:1+NonceSize], sealed[1+NonceSize:], ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func validSealed(sealed []byte) bool {
+	return len(sealed) >= Overhead && sealed[0] == Version
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}